@@ -0,0 +1,44 @@
+package leakcheck
+
+import "sync"
+
+// Bounds of a boundedCache: past cacheMaxEntries entries, it is trimmed down
+// to cacheKeepEntries
+const (
+	cacheMaxEntries  = 100
+	cacheKeepEntries = 50
+)
+
+// boundedCache is a map safe for concurrent use that keeps its size in check
+// by dropping entries, in no particular order, when it grows too large. The
+// zero value is an empty cache.
+type boundedCache[V any] struct {
+	mu      sync.RWMutex
+	entries map[string]V
+}
+
+// get returns the value cached for key, if any
+func (c *boundedCache[V]) get(key string) (V, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	value, ok := c.entries[key]
+	return value, ok
+}
+
+// put caches value for key, first trimming the cache if it is full
+func (c *boundedCache[V]) put(key string, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]V, 16)
+	}
+	if len(c.entries) > cacheMaxEntries {
+		for k := range c.entries {
+			delete(c.entries, k)
+			if len(c.entries) <= cacheKeepEntries {
+				break
+			}
+		}
+	}
+	c.entries[key] = value
+}
@@ -0,0 +1,77 @@
+package leakcheck
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+// checkstyleVersion is the checkstyle format version reported in the document
+const checkstyleVersion = "5.0"
+
+// checkstyleReport is the root of a checkstyle XML document
+type checkstyleReport struct {
+	XMLName xml.Name         `xml:"checkstyle"`
+	Version string           `xml:"version,attr"`
+	Files   []checkstyleFile `xml:"file"`
+}
+
+// checkstyleFile holds the errors reported in a single file
+type checkstyleFile struct {
+	Name   string            `xml:"name,attr"`
+	Errors []checkstyleError `xml:"error"`
+}
+
+// checkstyleError is a single finding
+type checkstyleError struct {
+	Line     int    `xml:"line,attr"`
+	Column   int    `xml:"column,attr"`
+	Severity string `xml:"severity,attr"`
+	Message  string `xml:"message,attr"`
+	Source   string `xml:"source,attr"`
+}
+
+// checkstyleSeverity maps a severity to the severity of a checkstyle error
+func checkstyleSeverity(severity Severity) string {
+	switch severity {
+	case SeverityHigh:
+		return "error"
+	case SeverityLow:
+		return "info"
+	default:
+		return "warning"
+	}
+}
+
+// WriteCheckstyle writes findings as a checkstyle XML document, as consumed by
+// CI servers such as Jenkins. Findings are grouped by file, with the files in
+// the order they first appear.
+func WriteCheckstyle(w io.Writer, findings []Finding) error {
+	report := checkstyleReport{Version: checkstyleVersion}
+	index := make(map[string]int)
+	for _, finding := range findings {
+		i, ok := index[finding.Position.Filename]
+		if !ok {
+			i = len(report.Files)
+			index[finding.Position.Filename] = i
+			report.Files = append(report.Files, checkstyleFile{Name: finding.Position.Filename})
+		}
+		report.Files[i].Errors = append(report.Files[i].Errors, checkstyleError{
+			Line:     finding.Position.Line,
+			Column:   finding.Position.Column,
+			Severity: checkstyleSeverity(finding.Severity),
+			Message:  finding.Message,
+			Source:   analyzerName + "." + finding.Reason.String(),
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,71 @@
+package leakcheck_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"go/token"
+	"strings"
+	"testing"
+
+	"github.com/rleungx/leakcheck"
+)
+
+func TestWriteCheckstyle(t *testing.T) {
+	findings := []leakcheck.Finding{
+		{
+			TestFunc: "TestA",
+			Reason:   leakcheck.ReasonMissingDefer,
+			Severity: leakcheck.SeverityMedium,
+			Position: token.Position{Filename: "a_test.go", Line: 10, Column: 1},
+			Message:  "test function TestA is not covered by goleak (missing defer goleak.VerifyNone(t))",
+		},
+		{
+			TestFunc: "TestB",
+			Reason:   leakcheck.ReasonNoImport,
+			Severity: leakcheck.SeverityHigh,
+			Position: token.Position{Filename: "b_test.go", Line: 3, Column: 1},
+			Message:  `test function TestB is not covered by goleak (goleak not imported) & "quoted"`,
+		},
+		{
+			TestFunc: "TestC",
+			Reason:   leakcheck.ReasonRedundantDefer,
+			Severity: leakcheck.SeverityLow,
+			Position: token.Position{Filename: "a_test.go", Line: 20, Column: 2},
+			Message:  "defer goleak.VerifyNone in test function TestC is redundant (TestMain already calls goleak.VerifyTestMain)",
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := leakcheck.WriteCheckstyle(&buf, findings); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), xml.Header) {
+		t.Errorf("missing XML header:\n%s", buf.String())
+	}
+
+	var doc struct {
+		Files []struct {
+			Name   string `xml:"name,attr"`
+			Errors []struct {
+				Line     int    `xml:"line,attr"`
+				Severity string `xml:"severity,attr"`
+				Message  string `xml:"message,attr"`
+				Source   string `xml:"source,attr"`
+			} `xml:"error"`
+		} `xml:"file"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("malformed output: %v\n%s", err, buf.String())
+	}
+
+	if len(doc.Files) != 2 || doc.Files[0].Name != "a_test.go" || doc.Files[1].Name != "b_test.go" {
+		t.Fatalf("unexpected files: %+v", doc.Files)
+	}
+	if errs := doc.Files[0].Errors; len(errs) != 2 || errs[1].Line != 20 || errs[0].Severity != "warning" || errs[1].Severity != "info" {
+		t.Errorf("unexpected errors in a_test.go: %+v", errs)
+	}
+	got := doc.Files[1].Errors[0]
+	if got.Message != findings[1].Message || got.Severity != "error" || got.Source != "leakcheck.no-import" {
+		t.Errorf("unexpected error in b_test.go: %+v", got)
+	}
+}
@@ -1,15 +1,25 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"go/token"
+	goversion "go/version"
+	"io"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/rleungx/leakcheck"
-	"golang.org/x/tools/go/analysis/singlechecker"
 )
 
 // Version information, set at build time
@@ -19,60 +29,753 @@ var (
 	date    = "unknown" // -ldflags "-X main.date=2025-01-01T00:00:00Z"
 )
 
+// Exit codes, chosen to match singlechecker for errors and findings
+const (
+	exitError    = 1 // the analysis failed, e.g. packages could not be loaded
+	exitFindings = 3 // default code when findings are reported
+	exitTimeout  = 4 // the analysis exceeded -timeout
+)
+
 func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run runs the command line tool with args, the arguments after the program
+// name, writing documents and listings to stdout and diagnostics to stderr,
+// and returns the exit code. It never exits itself, so that the command line
+// layer can be tested in process with its output captured.
+func run(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("leakcheck", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
 	// Define flags
 	var (
-		excludePackages = flag.String("exclude-packages", "", "comma-separated list of package patterns to exclude (supports regex)")
-		excludeFiles    = flag.String("exclude-files", "", "comma-separated list of file patterns to exclude (supports regex)")
-		concurrency     = flag.Int("concurrency", runtime.NumCPU(), "number of concurrent workers")
-		timeout         = flag.Duration("timeout", 30*time.Minute, "analysis timeout")
-		showHelp        = flag.Bool("h", false, "show help message")
-		showVersion     = flag.Bool("V", false, "show version information")
+		excludePackages = fs.String("exclude-packages", "", "comma-separated list of package patterns to exclude (supports regex)")
+		excludeFiles    = fs.String("exclude-files", "", "comma-separated list of file patterns to exclude (supports regex)")
+		excludeDirs     = fs.String("exclude-dirs", "", "comma-separated list of directories to exclude, matched without regex (e.g. vendor,third_party)")
+		excludeTags     = fs.String("exclude-build-tags", "", "comma-separated list of build tags whose test files are excluded (e.g. integration)")
+		manifestFile    = fs.String("manifest-file", "", "file listing the packages to check, one import path or pattern per line; other packages are skipped")
+		excludeFuncs    = fs.String("exclude-functions", "", "comma-separated list of test function name patterns to exclude (supports regex)")
+		warnUnused      = fs.Bool("warn-unused-excludes", false, "warn about exclude patterns that match nothing")
+		showExcluded    = fs.Bool("show-excluded", false, "print the packages and test files excluded by configuration to stderr after the analysis")
+		concurrency     = fs.Int("concurrency", runtime.NumCPU(), "number of concurrent workers")
+		timeout         = fs.Duration("timeout", 30*time.Minute, "analysis timeout")
+		checkSubtests   = fs.Bool("check-subtests", false, "require goroutine-spawning subtests to have their own goleak coverage")
+		checkParallel   = fs.Bool("check-parallel", false, "warn about parallel tests covered only by a per-test goleak.VerifyNone")
+		checkExamples   = fs.Bool("check-examples", false, "require runnable examples to be covered by goleak.VerifyTestMain")
+		checkHelpers    = fs.Bool("check-helpers", false, "treat deferred calls to package helpers that call goleak.VerifyNone as coverage")
+		testPrefixes    = fs.String("test-prefixes", "", "comma-separated list of function name prefixes that mark a test (default \"Test\")")
+		goleakPaths     = fs.String("goleak-paths", "", "comma-separated list of import paths recognized as goleak (default \"go.uber.org/goleak,github.com/uber-go/goleak\")")
+		verifyFuncs     = fs.String("verify-funcs", "", "comma-separated list of goleak functions that verify a single test (default \"VerifyNone\")")
+		verifyMainFuncs = fs.String("verify-testmain-funcs", "", "comma-separated list of goleak functions that verify every test from TestMain (default \"VerifyTestMain\")")
+		strict          = fs.Bool("strict", false, "require unconditional coverage and enable the subtest and parallel checks")
+		checkSuites     = fs.Bool("check-suites", false, "treat testify suite methods as covered by a TearDownTest calling goleak.VerifyNone(s.T())")
+		checkCommented  = fs.Bool("check-commented-out", false, "hint at commented-out goleak verification in uncovered tests")
+		checkDeferOrder = fs.Bool("check-defer-order", false, "require defer goleak.VerifyNone(t) to be the first defer of the test, so that it runs last")
+		checkRedundant  = fs.Bool("check-redundant", false, "note per-test goleak.VerifyNone defers made redundant by goleak.VerifyTestMain")
+		conditional     = fs.Bool("flag-conditional-coverage", false, "note tests verified only by a defer or t.Cleanup nested in an if, loop or closure")
+		testMainSetup   = fs.Bool("check-testmain-setup", false, "note go statements in TestMain that start goroutines before goleak.VerifyTestMain or m.Run")
+		onlyGoroutines  = fs.Bool("only-goroutine-tests", false, "report missing coverage only for tests containing go statements")
+		requireTests    = fs.Bool("require-tests", false, "report packages without any _test.go file")
+		groupNoImport   = fs.Bool("group-no-import", false, "report the tests of a package that doesn't import goleak as a single finding")
+		goVersion       = fs.String("go-version", "", "Go version the analyzed code targets, e.g. 1.13 (default: the go directive of each package's module)")
+		skipGenerated   = fs.Bool("skip-generated", true, "skip test files with a \"Code generated ... DO NOT EDIT.\" header")
+		includeVendor   = fs.Bool("include-vendor", false, "analyze test files below vendor directories, which are skipped by default")
+		ignoredTopFuncs = fs.String("ignored-top-functions", "", "comma-separated list of functions every goleak verification must ignore with goleak.IgnoreTopFunction")
+		checkOptions    = fs.Bool("check-options", false, "report misused goleak.VerifyNone and goleak.VerifyTestMain options")
+		suggestTestMain = fs.Int("suggest-testmain", 0, "suggest TestMain with goleak.VerifyTestMain when at least this many tests start goroutines (0 disables)")
+		anchorPackages  = fs.Bool("anchor-packages", false, "match plain -exclude-packages patterns against the last import path element only")
+		ignoreBad       = fs.Bool("ignore-bad-patterns", false, "warn about exclusion patterns that aren't valid regular expressions instead of failing")
+		configFile      = fs.String("config", "", "path to a configuration file (default: "+leakcheck.ConfigFileName+" in the current directory or a parent)")
+		configPrint     = fs.Bool("config-print", false, "print the effective configuration as JSON to stdout and exit")
+		minSeverity     = fs.String("min-severity", "low", "report only findings at least this severe: low, medium or high")
+		warningsErrors  = fs.Bool("warnings-as-errors", true, "fail on every reported finding; when false only high severity findings set the exit code")
+		maxFindings     = fs.Int("max-findings", 0, "print at most this many findings, then a count of the rest (0 for no limit)")
+		dedupe          = fs.Bool("dedupe", false, "report each issue once when the internal and external test packages of a directory both report it")
+		exitOnFindings  = fs.Int("exit-on-findings", exitFindings, "exit code used when findings are reported (0 to always succeed)")
+		countOnly       = fs.Bool("count-only", false, "print only the number of findings, nothing when there are none")
+		list            = fs.Bool("list", false, "list every test function with its coverage status")
+		coverage        = fs.Bool("coverage", false, "print the percentage of test functions covered by goleak to stderr after the analysis")
+		verbose         = fs.Bool("v", false, "explain the coverage status of every test function on stderr")
+		pathMode        = fs.String("path-mode", "absolute", "how file paths are reported: absolute, or relative to the current directory")
+		format          = fs.String("format", "text", "output format for findings: text, json, sarif, checkstyle or github")
+		messageTemplate = fs.String("message-template", "", "message of every finding, with the placeholders {message}, {func}, {pkg} and {reason}")
+		summary         = fs.Bool("summary", false, "print per-package counts of findings instead of individual diagnostics")
+		diff            = fs.String("diff", "", "report only findings in functions changed by a unified diff: a file, - for stdin, or a git revision range")
+		testJSON        = fs.String("test-json", "", "report only findings about tests that leaked goroutines in this go test -json output, - for stdin")
+		stdinFilename   = fs.String("stdin-filename", "", "analyze a single file read from stdin instead of packages, reporting positions against this file name")
+		fix             = fs.Bool("fix", false, "rewrite test files in place, adding defer goleak.VerifyNone(t) to every uncovered test")
+		fixBackup       = fs.Bool("fix-backup", true, "with -fix, keep the original of every rewritten file as FILE.orig, never overwriting a backup")
+		stats           = fs.Bool("stats", false, "print per-package timing and counts to stderr after the analysis")
+		showHelp        = fs.Bool("h", false, "show help message")
+		showVersion     = fs.Bool("V", false, "show version information")
 	)
 
 	// Custom usage function
-	flag.Usage = func() {
-		showHelpMessage()
+	fs.Usage = func() {
+		showHelpMessage(stdout)
 	}
 
-	// Parse flags
-	flag.Parse()
+	// Parse flags, with the exit codes of flag.ExitOnError
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
 
 	// Handle help flag
 	if *showHelp {
-		showHelpMessage()
-		return
+		showHelpMessage(stdout)
+		return 0
 	}
 
 	// Handle version flag
 	if *showVersion {
-		fmt.Println(getVersion())
-		return
+		fmt.Fprintln(stdout, getVersion())
+		return 0
 	}
 
 	// If no arguments provided after flags, show help
-	if flag.NArg() == 0 {
-		showHelpMessage()
+	if fs.NArg() == 0 && *stdinFilename == "" && !*configPrint {
+		showHelpMessage(stdout)
+		return 0
+	}
+
+	// Start from the configuration file, if any
+	config, err := loadConfig(*configFile)
+	if err != nil {
+		fmt.Fprintf(stderr, "leakcheck: %v\n", err)
+		return exitError
+	}
+
+	// Flags given on the command line override the configuration file
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "exclude-packages":
+			config.ExcludePackages = *excludePackages
+		case "exclude-files":
+			config.ExcludeFiles = *excludeFiles
+		case "exclude-dirs":
+			config.ExcludeDirs = splitList(*excludeDirs)
+		case "exclude-build-tags":
+			config.ExcludeBuildTags = splitList(*excludeTags)
+		case "exclude-functions":
+			config.ExcludeFunctions = *excludeFuncs
+		case "manifest-file":
+			config.ManifestFile = *manifestFile
+		case "concurrency":
+			config.Concurrency = *concurrency
+		case "timeout":
+			config.Timeout = *timeout
+		case "check-subtests":
+			config.CheckSubtests = *checkSubtests
+		case "check-parallel":
+			config.CheckParallel = *checkParallel
+		case "anchor-packages":
+			config.AnchorPackagePatterns = *anchorPackages
+		case "ignore-bad-patterns":
+			config.IgnoreBadPatterns = *ignoreBad
+		case "suggest-testmain":
+			config.TestMainSuggestThreshold = *suggestTestMain
+		case "check-examples":
+			config.CheckExamples = *checkExamples
+		case "check-helpers":
+			config.CheckHelpers = *checkHelpers
+		case "check-options":
+			config.CheckOptions = *checkOptions
+		case "check-commented-out":
+			config.CheckCommentedOut = *checkCommented
+		case "check-defer-order":
+			config.CheckDeferOrder = *checkDeferOrder
+		case "check-redundant":
+			config.CheckRedundant = *checkRedundant
+		case "flag-conditional-coverage":
+			config.FlagConditionalCoverage = *conditional
+		case "check-testmain-setup":
+			config.CheckTestMainSetup = *testMainSetup
+		case "only-goroutine-tests":
+			config.OnlyGoroutineStartingTests = *onlyGoroutines
+		case "require-tests":
+			config.RequireTests = *requireTests
+		case "group-no-import":
+			config.GroupNoImport = *groupNoImport
+		case "go-version":
+			config.GoVersion = *goVersion
+		case "strict":
+			config.Strict = *strict
+		case "goleak-paths":
+			config.GoleakImportPaths = splitList(*goleakPaths)
+		case "verify-funcs":
+			config.VerifyFuncs = splitList(*verifyFuncs)
+		case "verify-testmain-funcs":
+			config.VerifyTestMainFuncs = splitList(*verifyMainFuncs)
+		case "check-suites":
+			config.CheckSuites = *checkSuites
+		case "test-prefixes":
+			config.TestPrefixes = splitList(*testPrefixes)
+		case "skip-generated":
+			config.SkipGenerated = *skipGenerated
+		case "include-vendor":
+			config.IncludeVendor = *includeVendor
+		case "message-template":
+			config.MessageTemplate = *messageTemplate
+		case "ignored-top-functions":
+			config.IgnoredTopFunctions = splitList(*ignoredTopFuncs)
+		case "max-findings":
+			config.MaxFindings = *maxFindings
+		case "dedupe":
+			config.Dedupe = *dedupe
+		case "warn-unused-excludes":
+			config.WarnUnusedExcludes = *warnUnused
+		}
+	})
+
+	if *configPrint {
+		if err := printConfig(stdout, config); err != nil {
+			fmt.Fprintf(stderr, "leakcheck: -config-print: %v\n", err)
+			return exitError
+		}
+		return 0
+	}
+
+	// Text goes to stderr like go vet, documents to stdout for redirection
+	output := stdout
+	if *format == leakcheck.FormatText {
+		output = stderr
+	}
+	reporter, err := leakcheck.NewReporter(*format, output)
+	if err != nil {
+		fmt.Fprintf(stderr, "leakcheck: -format: %v\n", err)
+		return exitError
+	}
+
+	if *pathMode != "absolute" && *pathMode != "relative" {
+		fmt.Fprintf(stderr, "leakcheck: unknown -path-mode %q, want absolute or relative\n", *pathMode)
+		return exitError
+	}
+
+	threshold, err := leakcheck.ParseSeverity(*minSeverity)
+	if err != nil {
+		fmt.Fprintf(stderr, "leakcheck: -min-severity: %v\n", err)
+		return exitError
+	}
+
+	if config.GoVersion != "" && !goversion.IsValid("go"+strings.TrimPrefix(config.GoVersion, "go")) {
+		fmt.Fprintf(stderr, "leakcheck: -go-version: %q is not a Go version\n", config.GoVersion)
+		return exitError
+	}
+
+	if err := leakcheck.ValidateMessageTemplate(config.MessageTemplate); err != nil {
+		fmt.Fprintf(stderr, "leakcheck: -message-template: %v\n", err)
+		return exitError
+	}
+
+	if err := config.Validate(); err != nil {
+		if !config.IgnoreBadPatterns {
+			fmt.Fprintf(stderr, "leakcheck: %v (fix the pattern or use -ignore-bad-patterns)\n", err)
+			return exitError
+		}
+		printBadPatterns(stderr, err)
+	}
+
+	if config.MaxFindings < 0 {
+		fmt.Fprintln(stderr, "leakcheck: -max-findings must not be negative")
+		return exitError
+	}
+
+	if *exitOnFindings == exitError || *exitOnFindings == exitTimeout || *exitOnFindings < 0 {
+		fmt.Fprintf(stderr, "leakcheck: -exit-on-findings must be a non-negative code other than %d and %d\n", exitError, exitTimeout)
+		return exitError
+	}
+
+	if *stdinFilename != "" {
+		switch {
+		case fs.NArg() > 0:
+			fmt.Fprintln(stderr, "leakcheck: -stdin-filename analyzes a single file and takes no package patterns")
+			return exitError
+		case *diff == "-" || *testJSON == "-":
+			fmt.Fprintln(stderr, "leakcheck: -stdin-filename reads the file from stdin, so -diff and -test-json can't")
+			return exitError
+		case *fix:
+			fmt.Fprintln(stderr, "leakcheck: -fix rewrites files on disk and can't be used with -stdin-filename")
+			return exitError
+		}
+	}
+
+	// Read the diff and test output first, so that bad input fails before the analysis
+	if *diff == "-" && *testJSON == "-" {
+		fmt.Fprintln(stderr, "leakcheck: -diff and -test-json can't both read stdin")
+		return exitError
+	}
+	var changed *leakcheck.ChangedLines
+	if *diff != "" {
+		if changed, err = loadDiff(*diff); err != nil {
+			fmt.Fprintf(stderr, "leakcheck: -diff: %v\n", err)
+			return exitError
+		}
+	}
+	var leaked *leakcheck.LeakedTests
+	if *testJSON != "" {
+		if leaked, err = loadTestJSON(*testJSON); err != nil {
+			fmt.Fprintf(stderr, "leakcheck: -test-json: %v\n", err)
+			return exitError
+		}
+		if leaked.Len() == 0 {
+			fmt.Fprintln(stderr, "leakcheck: note: the test output reports no leaked goroutines")
+		}
+	}
+
+	// Collect findings across all packages so that the exit code reflects the whole run
+	start := time.Now()
+	var results []*leakcheck.Result
+	if *stdinFilename != "" {
+		results, err = analyzeStdin(config, *stdinFilename)
+	} else {
+		results, err = leakcheck.AnalyzePackages(config, fs.Args()...)
+	}
+	if err != nil {
+		var timeoutErr *leakcheck.TimeoutError
+		if errors.As(err, &timeoutErr) {
+			printTimeout(stderr, timeoutErr)
+		} else {
+			fmt.Fprintf(stderr, "leakcheck: %v\n", err)
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			return exitTimeout
+		}
+		return exitError
+	}
+
+	// Rewrite the positions once so that every output format agrees
+	if *pathMode == "relative" {
+		if wd, err := os.Getwd(); err == nil {
+			relativizePaths(results, wd)
+		}
+	}
+
+	var findings []leakcheck.Finding
+	for _, result := range results {
+		for _, finding := range result.Findings {
+			if finding.Severity >= threshold {
+				findings = append(findings, finding)
+			}
+		}
+	}
+
+	// Only new or modified code is gated, leaving the backlog alone
+	if changed != nil {
+		findings = leakcheck.FilterChanged(findings, changed)
+	}
+	// Tests seen leaking at runtime come first
+	if leaked != nil {
+		findings = leakcheck.FilterLeaked(findings, leaked)
+	}
+
+	// Fixed findings are no longer reported
+	if *fix {
+		remaining, err := applyFixes(stderr, findings, config.GoleakImportPaths, *fixBackup)
+		if err != nil {
+			fmt.Fprintf(stderr, "leakcheck: %v\n", err)
+			return exitError
+		}
+		findings = remaining
+	}
+
+	// The cap only shortens the printed list: counts, summaries and the exit
+	// code still reflect every finding
+	shown, omitted := leakcheck.LimitFindings(findings, config.MaxFindings)
+
+	switch {
+	case *countOnly:
+		// Count mode keeps hooks quiet, relying on the exit code
+		if len(findings) > 0 {
+			fmt.Fprintln(stdout, len(findings))
+		}
+	case *list:
+		// List mode prints every test with its coverage status
+		printTests(stdout, results)
+	case *summary:
+		// Summary mode prints per-package counts instead of individual diagnostics
+		printSummary(stdout, findings)
+	default:
+		for _, finding := range shown {
+			reporter.Report(finding)
+		}
+		if err := reporter.Flush(); err != nil {
+			fmt.Fprintf(stderr, "leakcheck: %v\n", err)
+			return exitError
+		}
+		printOmitted(stderr, omitted)
+	}
+
+	if *stats {
+		printStats(stderr, results, time.Since(start))
+	}
+
+	if config.WarnUnusedExcludes {
+		printUnusedExcludes(stderr, leakcheck.UnusedExcludes(config, results))
+	}
+
+	if *showExcluded {
+		printExcluded(stderr, results)
+	}
+
+	if *verbose {
+		printCoverage(stderr, results)
+	}
+
+	if *coverage {
+		printCoveragePercent(stderr, results)
+	}
+
+	// Coverage by a TestMain in another file of the package goes unseen
+	if *stdinFilename != "" && len(findings) > 0 && results[0].MissingTestMain {
+		fmt.Fprintf(stderr, "leakcheck: warning: -stdin-filename can't see a TestMain in the other files of package %s, which may cover these tests\n", results[0].Package)
+	}
+
+	if failsRun(findings, *warningsErrors) {
+		return *exitOnFindings
+	}
+	return 0
+}
+
+// analyzeStdin analyzes the file read from stdin as filename, as the only
+// result of the run
+func analyzeStdin(config *leakcheck.Config, filename string) ([]*leakcheck.Result, error) {
+	src, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return nil, fmt.Errorf("reading stdin: %w", err)
+	}
+	result, err := leakcheck.AnalyzeFile(config, filename, src)
+	if err != nil {
+		return nil, err
+	}
+	return []*leakcheck.Result{result}, nil
+}
+
+// failsRun checks if the reported findings should fail the run: any finding
+// when warnings are treated as errors, otherwise only high severity ones
+func failsRun(findings []leakcheck.Finding, warningsAsErrors bool) bool {
+	for _, finding := range findings {
+		if warningsAsErrors || finding.Severity >= leakcheck.SeverityHigh {
+			return true
+		}
+	}
+	return false
+}
+
+// applyFixes rewrites the files of the fixable findings with
+// leakcheck.FixFile, keeping a backup of each original if backup is set, and
+// returns the findings it could not fix
+func applyFixes(w io.Writer, findings []leakcheck.Finding, importPaths []string, backup bool) ([]leakcheck.Finding, error) {
+	var files []string
+	byFile := make(map[string][]leakcheck.Finding)
+	for _, finding := range findings {
+		if !leakcheck.Fixable(finding) {
+			continue
+		}
+		filename := finding.Position.Filename
+		if _, ok := byFile[filename]; !ok {
+			files = append(files, filename)
+		}
+		byFile[filename] = append(byFile[filename], finding)
+	}
+
+	type location struct {
+		filename string
+		line     int
+	}
+	fixed := make(map[location]bool)
+	for _, filename := range files {
+		info, err := os.Stat(filename)
+		if err != nil {
+			return nil, err
+		}
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		out, fixedFindings, err := leakcheck.FixFile(filename, src, byFile[filename], importPaths)
+		if err != nil {
+			return nil, fmt.Errorf("fixing %s: %w", filename, err)
+		}
+		if out == nil {
+			continue
+		}
+		if backup {
+			if err := writeBackup(filename, src, info.Mode().Perm()); err != nil {
+				return nil, err
+			}
+		}
+		if err := os.WriteFile(filename, out, info.Mode().Perm()); err != nil {
+			return nil, err
+		}
+		for _, finding := range fixedFindings {
+			fixed[location{filename, finding.Position.Line}] = true
+		}
+		fmt.Fprintf(w, "leakcheck: fixed %d test(s) in %s\n", len(fixedFindings), filename)
+	}
+
+	var remaining []leakcheck.Finding
+	for _, finding := range findings {
+		if !fixed[location{finding.Position.Filename, finding.Position.Line}] || !leakcheck.Fixable(finding) {
+			remaining = append(remaining, finding)
+		}
+	}
+	return remaining, nil
+}
+
+// writeBackup saves src, the original of filename, as FILE.orig or, when a
+// previous -fix run left one, as the first free FILE.orig.N, so that no
+// backup is ever overwritten
+func writeBackup(filename string, src []byte, perm os.FileMode) error {
+	name := filename + ".orig"
+	for n := 1; ; n++ {
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+		if errors.Is(err, os.ErrExist) {
+			name = fmt.Sprintf("%s.orig.%d", filename, n)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(src)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		return err
+	}
+}
+
+// printOmitted notes the findings left out by -max-findings, if any
+func printOmitted(w io.Writer, omitted int) {
+	if omitted > 0 {
+		fmt.Fprintf(w, "... and %d more (run with -max-findings=0 to see all)\n", omitted)
+	}
+}
+
+// loadDiff reads the unified diff at path, or from stdin for -. Any other
+// value is taken as a git revision range and diffed with git diff.
+func loadDiff(spec string) (*leakcheck.ChangedLines, error) {
+	if spec == "-" {
+		return leakcheck.ParseDiff(os.Stdin)
+	}
+	if info, err := os.Stat(spec); err == nil && !info.IsDir() {
+		f, err := os.Open(spec)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return leakcheck.ParseDiff(f)
+	}
+
+	cmd := exec.Command("git", "diff", "--no-color", "--no-ext-diff", "-U0", spec, "--")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("git diff %s: %s", spec, msg)
+		}
+		return nil, fmt.Errorf("git diff %s: %w", spec, err)
+	}
+	return leakcheck.ParseDiff(bytes.NewReader(out))
+}
+
+// loadTestJSON reads the go test -json output at path, or from stdin for -
+func loadTestJSON(path string) (*leakcheck.LeakedTests, error) {
+	if path == "-" {
+		return leakcheck.ParseTestJSON(os.Stdin)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return leakcheck.ParseTestJSON(f)
+}
+
+// printUnusedExcludes warns about each exclude pattern that matched nothing
+func printUnusedExcludes(w io.Writer, unused []leakcheck.ExcludePattern) {
+	for _, exclude := range unused {
+		fmt.Fprintf(w, "leakcheck: warning: %s pattern %q matched nothing\n", exclude.Option, exclude.Pattern)
+	}
+}
+
+// printBadPatterns warns about each exclusion pattern rejected by
+// Config.Validate, whose errors are joined
+func printBadPatterns(w io.Writer, err error) {
+	errs := []error{err}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = joined.Unwrap()
+	}
+	for _, err := range errs {
+		fmt.Fprintf(w, "leakcheck: warning: %v; the pattern matches nothing\n", err)
+	}
+}
+
+// printExcluded prints how many packages and test files the configuration
+// excluded, then each of them
+func printExcluded(w io.Writer, results []*leakcheck.Result) {
+	packages, files := leakcheck.Excluded(results)
+	fmt.Fprintf(w, "leakcheck: excluded %d package(s) and %d test file(s)\n", len(packages), len(files))
+	for _, pkg := range packages {
+		fmt.Fprintf(w, "  package %s\n", pkg)
+	}
+	for _, file := range files {
+		fmt.Fprintf(w, "  file %s\n", file)
+	}
+}
+
+// printConfig prints the effective settings of config as indented JSON, which
+// also reads as a configuration file
+func printConfig(w io.Writer, config *leakcheck.Config) error {
+	data, err := json.MarshalIndent(config.Settings(), "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+// loadConfig loads the configuration file at path or, if path is empty, the
+// one found from the current directory. Without a file the defaults apply.
+func loadConfig(path string) (*leakcheck.Config, error) {
+	if path == "" {
+		var err error
+		if path, err = leakcheck.FindConfigFile("."); err != nil {
+			return nil, err
+		}
+		if path == "" {
+			return leakcheck.DefaultConfig(), nil
+		}
+	}
+	return leakcheck.LoadConfigFile(path)
+}
+
+// printStats prints the files, tests and analysis time of every package, then
+// the totals. The total wall time includes loading the packages.
+func printStats(w io.Writer, results []*leakcheck.Result, wall time.Duration) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PACKAGE\tFILES\tTESTS\tTIME")
+	var files, tests int
+	var analysis time.Duration
+	for _, result := range results {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%v\n", result.Package, result.Stats.Files, len(result.Tests), result.Stats.Duration.Round(time.Microsecond))
+		files += result.Stats.Files
+		tests += len(result.Tests)
+		analysis += result.Stats.Duration
+	}
+	fmt.Fprintf(tw, "total\t%d\t%d\t%v\n", files, tests, analysis.Round(time.Microsecond))
+	tw.Flush()
+	fmt.Fprintf(w, "wall time: %v\n", wall.Round(time.Millisecond))
+}
+
+// relativizePaths rewrites the file names of every reported position relative
+// to base. Files outside base keep their absolute path, as with go vet.
+func relativizePaths(results []*leakcheck.Result, base string) {
+	rel := func(pos *token.Position) {
+		if pos.Filename == "" || !filepath.IsAbs(pos.Filename) {
+			return
+		}
+		if path, err := filepath.Rel(base, pos.Filename); err == nil && path != ".." && !strings.HasPrefix(path, ".."+string(filepath.Separator)) {
+			pos.Filename = path
+		}
+	}
+	for _, result := range results {
+		for i := range result.Findings {
+			rel(&result.Findings[i].Position)
+			rel(&result.Findings[i].Insertion)
+		}
+		for i := range result.Tests {
+			rel(&result.Tests[i].Position)
+		}
+		for i, file := range result.ExcludedFiles {
+			pos := token.Position{Filename: file}
+			rel(&pos)
+			result.ExcludedFiles[i] = pos.Filename
+		}
+	}
+}
+
+// printTimeout explains a timeout, listing what was still being analyzed
+func printTimeout(w io.Writer, err *leakcheck.TimeoutError) {
+	fmt.Fprintf(w, "leakcheck: analysis timed out after %v\n", err.Timeout)
+	switch {
+	case err.File != "":
+		fmt.Fprintf(w, "  in progress: %s\n", err.File)
+	case len(err.Packages) > 0:
+		for _, pkg := range err.Packages {
+			fmt.Fprintf(w, "  in progress: %s\n", pkg)
+		}
+	default:
+		fmt.Fprintln(w, "  in progress: loading packages")
+	}
+	fmt.Fprintln(w, "  raise -timeout, or lower -concurrency if packages compete for resources")
+}
+
+// splitList splits a comma-separated flag value, dropping empty elements
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// printTests prints every test function with its coverage status as aligned columns
+func printTests(w io.Writer, results []*leakcheck.Result) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PACKAGE\tTEST\tSTATUS\tPOSITION")
+	for _, result := range results {
+		for _, test := range result.Tests {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", test.Package, test.TestFunc, test.Coverage, test.Position)
+		}
+	}
+	tw.Flush()
+}
+
+// printCoverage explains the coverage status of every test function, one
+// test per line
+func printCoverage(w io.Writer, results []*leakcheck.Result) {
+	for _, result := range results {
+		for _, test := range result.Tests {
+			fmt.Fprintf(w, "leakcheck: %s: %s is %s: %s\n", test.Position, test.TestFunc, test.Coverage, test.Detail)
+		}
+	}
+}
+
+// printCoveragePercent prints the percentage of test functions covered by
+// goleak, with the counts it is computed from
+func printCoveragePercent(w io.Writer, results []*leakcheck.Result) {
+	covered, total := leakcheck.CountCovered(results)
+	if total == 0 {
+		fmt.Fprintln(w, "leakcheck: coverage: no tests")
 		return
 	}
+	fmt.Fprintf(w, "leakcheck: coverage: %.1f%% of tests covered by goleak (%d/%d)\n", 100*float64(covered)/float64(total), covered, total)
+}
 
-	// Create analyzer with configuration
-	config := &leakcheck.Config{
-		ExcludePackages: *excludePackages,
-		ExcludeFiles:    *excludeFiles,
-		Concurrency:     *concurrency,
-		Timeout:         *timeout,
+// printSummary prints the number of findings per package followed by a grand total
+func printSummary(w io.Writer, findings []leakcheck.Finding) {
+	counts := make(map[string]int)
+	for _, finding := range findings {
+		counts[finding.Package]++
 	}
-	configuredAnalyzer := leakcheck.NewWithConfig(config)
 
-	// Prepare os.Args for singlechecker (remove our custom flags)
-	// Keep only the program name and the remaining arguments
-	newArgs := []string{os.Args[0]}
-	newArgs = append(newArgs, flag.Args()...)
-	os.Args = newArgs
+	pkgs := make([]string, 0, len(counts))
+	for pkg := range counts {
+		pkgs = append(pkgs, pkg)
+	}
+	sort.Strings(pkgs)
 
-	// Run the analyzer using singlechecker
-	singlechecker.Main(configuredAnalyzer)
+	for _, pkg := range pkgs {
+		fmt.Fprintf(w, "%s: %d uncovered\n", pkg, counts[pkg])
+	}
+	fmt.Fprintf(w, "total: %d uncovered in %d packages\n", len(findings), len(pkgs))
 }
 
 // getVersion returns the version string
@@ -93,8 +796,8 @@ func getVersion() string {
 	return fmt.Sprintf("leakcheck has version %s built with go%s", version, goVersion)
 }
 
-func showHelpMessage() {
-	fmt.Println(`leakcheck - Goroutine Leak Detection Linter
+func showHelpMessage(w io.Writer) {
+	fmt.Fprintln(w, `leakcheck - Goroutine Leak Detection Linter
 
 A static analysis tool that ensures all Go test functions are properly covered 
 by goleak for goroutine leak detection.
@@ -107,10 +810,199 @@ FLAGS:
             Comma-separated list of package patterns to exclude (supports regex)
     -exclude-files string  
             Comma-separated list of file patterns to exclude (supports regex)
+    -exclude-dirs string
+            Comma-separated list of directories to exclude, e.g. "vendor,third_party".
+            Checked with a plain path comparison, faster than -exclude-files
+            patterns; relative entries match at any depth
+    -exclude-build-tags string
+            Comma-separated list of build tags; test files whose //go:build line
+            mentions one of them are excluded. Tagged files are only loaded when
+            their tags are enabled, e.g. with GOFLAGS=-tags=integration.
+            A negated tag, as in //go:build !integration, doesn't count
+    -exclude-functions string
+            Comma-separated list of test function name patterns to exclude (supports
+            regex and globs, e.g. "TestLegacy*")
+    -manifest-file string
+            File listing the packages to check, one per line as an import path, a
+            glob such as example.com/*/server or a pattern such as example.com/store/...;
+            # starts a comment. Other packages are skipped entirely, and the
+            exclude options still apply to the listed ones
+    -warn-unused-excludes
+            Warn about each -exclude-packages, -exclude-dirs, -exclude-files and
+            -exclude-functions pattern that matched nothing, e.g. because of a typo
+    -show-excluded
+            Print the number of packages and test files excluded by configuration,
+            then each of them, to stderr after the analysis
+    -skip-generated
+            Skip test files with a "Code generated ... DO NOT EDIT." header
+            (default: true; disable with -skip-generated=false)
+    -include-vendor
+            Analyze test files below a vendor directory, e.g. of vendored modules
+            the team owns; they are skipped by default as other modules' code
     -concurrency int
             Number of concurreny (default: number of CPUs)
     -timeout duration
             Analysis timeout (default: 30m0s)
+    -anchor-packages
+            Match plain -exclude-packages patterns against the last import path
+            element only, e.g. "mocks" excludes ".../mocks" but not ".../mockstore"
+    -ignore-bad-patterns
+            Warn about exclusion patterns that aren't valid regular expressions and
+            treat them as matching nothing, instead of failing before the analysis
+    -test-prefixes string
+            Comma-separated function name prefixes that mark a test, e.g. "Test,ITest"
+            for a custom integration harness (default: "Test"). TestMain is always
+            recognized by name.
+    -goleak-paths string
+            Comma-separated import paths recognized as goleak, replacing the defaults
+            (default: "go.uber.org/goleak,github.com/uber-go/goleak")
+    -verify-funcs string
+            Comma-separated goleak functions that verify a single test, replacing the
+            default, e.g. "VerifyNone,VerifyNoneWithContext" for a fork; they must
+            take the *testing.T first (default: "VerifyNone")
+    -verify-testmain-funcs string
+            Comma-separated goleak functions that verify every test from TestMain,
+            replacing the default (default: "VerifyTestMain")
+    -strict
+            Tighten all heuristics: the defer or t.Cleanup covering a test and the
+            goleak.VerifyTestMain call in TestMain must be unconditional, and
+            -check-subtests and -check-parallel are enabled
+    -check-subtests
+            Require t.Run subtests that start goroutines to defer goleak.VerifyNone(t)
+    -check-parallel
+            Warn about t.Parallel() tests that rely only on defer goleak.VerifyNone(t)
+    -check-examples
+            Require runnable ExampleXxx functions to be covered by TestMain with
+            goleak.VerifyTestMain
+    -check-helpers
+            Treat defer helper(t) as coverage when helper is a package-level function,
+            possibly in a non-test file, that calls goleak.VerifyNone(t); t may be
+            declared as testing.TB. A plain helper(t) call covers the test when the
+            helper registers t.Cleanup(func() { goleak.VerifyNone(t) })
+    -check-options
+            Report goleak.IgnoreCurrent() evaluated only when verification runs,
+            goleak.IgnoreTopFunction/IgnoreAnyFunction names that don't exist, and
+            options that goleak doesn't have or the verification call doesn't accept
+    -ignored-top-functions string
+            Comma-separated list of functions the package is expected to leave running,
+            e.g. "example.com/metrics.(*Flusher).run"; every goleak.VerifyNone and
+            goleak.VerifyTestMain call must ignore each with goleak.IgnoreTopFunction
+    -check-suites
+            Check testify suites: TestXxx methods are covered when the suite's
+            TearDownTest or TearDownSuite calls goleak.VerifyNone(s.T())
+    -check-commented-out
+            Hint at uncovered tests whose body contains a commented-out goleak
+            verification, e.g. // defer goleak.VerifyNone(t), left by a refactor
+    -check-defer-order
+            Require defer goleak.VerifyNone(t) to be the first defer of the test, so
+            that it runs after every other deferred cleanup such as cancel()
+    -check-redundant
+            Note each defer goleak.VerifyNone(t) in packages whose TestMain already
+            calls goleak.VerifyTestMain
+    -flag-conditional-coverage
+            Note tests whose only defer goleak.VerifyNone(t) or t.Cleanup is nested
+            in an if, loop or closure, e.g. skipped in -short mode, as
+            conditional-coverage; -strict doesn't count such coverage at all
+    -check-testmain-setup
+            Note each go statement in TestMain before goleak.VerifyTestMain or m.Run,
+            whose goroutine goleak sees as a leak of the tests unless it is stopped
+            first or ignored with goleak.IgnoreCurrent()
+    -go-version string
+            Go version the analyzed code targets, e.g. 1.13, overriding the go
+            directive of each package's module; t.Cleanup only counts as coverage
+            from Go 1.14
+    -only-goroutine-tests
+            Report missing coverage only for tests whose body contains a go statement;
+            goroutines started by called functions are not seen
+    -require-tests
+            Report packages with Go files but no _test.go file in their directory,
+            whose code nothing verifies; excluded packages are left alone
+    -group-no-import
+            Report the uncovered tests of a package that doesn't import goleak as a
+            single finding at its first test file, instead of one per test
+    -suggest-testmain int
+            Suggest adding TestMain with goleak.VerifyTestMain to packages without one
+            that have at least this many goroutine-starting tests (default: 0, disabled)
+    -list
+            List every test function with its status: covered-by-defer,
+            covered-by-testmain, uncovered or excluded
+    -v
+            Explain the status of every test function on stderr, e.g. the line of
+            the covering defer or the pattern excluding it; findings are unchanged
+    -coverage
+            Print the percentage of test functions covered by goleak, by their own
+            verification or by TestMain, and the covered and total counts, e.g. for
+            dashboards; excluded tests are left out of both
+    -count-only
+            Print only the number of findings, and nothing when there are none; the
+            exit code is set as usual
+    -summary
+            Print per-package counts of findings and a total instead of each diagnostic
+    -diff string
+            Report only findings whose function overlaps a line added, modified or
+            deleted by a unified diff, read from a file or from stdin with -diff=-;
+            any other value is a git revision range, e.g. -diff=origin/main...HEAD.
+            Counts and the exit code only reflect these findings
+    -test-json string
+            Report only findings about tests that leaked goroutines at runtime, read
+            from the output of go test -json in this file, or stdin with -test-json=-.
+            Leaking tests are those whose goleak verification failed and those that
+            started a goroutine in goleak's report
+    -stdin-filename string
+            Analyze a single file read from stdin, e.g. an editor buffer, instead of
+            packages, reporting positions against this file name. Only the file's
+            imports are loaded, so a TestMain in another file of the package is not
+            seen; a warning says so when findings are reported
+    -path-mode string
+            Report file paths as absolute (default), or relative to the current
+            directory for reproducible output across machines; files outside it
+            keep their absolute path. Applies to every output format.
+    -format string
+            Output format for findings: text (default) on stderr, or on stdout json
+            for one JSON object per line, sarif for a SARIF 2.1.0 log, e.g. for
+            GitHub code scanning, checkstyle for an XML document grouping the
+            findings by file, e.g. for Jenkins, or github for GitHub Actions
+            workflow commands annotating pull requests
+    -message-template string
+            Message of every finding, e.g. "{message}; see https://wiki/goleak#{reason}".
+            Placeholders: {message} for the default wording, {func} for the test
+            function, {pkg} for the package's import path and {reason} for the
+            reason's identifier, such as missing-defer
+    -config string
+            Configuration file to read (default: .leakcheck.yaml in the current
+            directory or a parent, up to the repository root). Flags override it.
+    -config-print
+            Print the effective configuration, with the configuration file, flags
+            and defaults resolved, as JSON to stdout and exit without analyzing.
+            The output can be used as a configuration file.
+    -fix
+            Rewrite test files in place, adding defer goleak.VerifyNone(t) to every
+            test reported as uncovered and importing goleak where needed. Tests
+            suppressed by a directive or excluded are left alone.
+    -fix-backup
+            With -fix, keep the original of every rewritten file as FILE.orig, or
+            FILE.orig.1 and so on when a backup already exists (default: true)
+    -stats
+            Print the files, tests and analysis time of every package and the totals
+            to stderr, for performance tuning
+    -min-severity string
+            Report only findings at least this severe (default: low, everything):
+            high when no test of a package can be covered (goleak not imported,
+            TestMain without goleak.VerifyTestMain), medium for a single test or
+            option, low for advice such as -suggest-testmain
+    -warnings-as-errors
+            Exit with -exit-on-findings for every reported finding (default: true);
+            with -warnings-as-errors=false only high severity findings fail the run
+    -max-findings int
+            Print at most this many findings across all packages, followed by a
+            count of the rest, to keep CI logs readable on a first run (default: 0,
+            no limit). Counts, summaries and the exit code include every finding.
+    -dedupe
+            Report each issue once when the internal and external test packages of
+            a directory both report it, e.g. goleak not imported with
+            -group-no-import; distinct findings about different tests are all kept
+    -exit-on-findings int
+            Exit code used when findings are reported, 0 to always succeed (default: 3)
     -h  Show this help message
     -V  Show version information
 
@@ -127,8 +1019,29 @@ EXAMPLES:
     # Exclude patterns for large projects
     leakcheck -exclude-packages=".*test.*" ./...
     
+    # Audit the coverage status of every test
+    leakcheck -list ./...
+    
+    # Fail a pre-commit hook without flooding its output
+    leakcheck -count-only ./...
+    
+    # Summarize findings when onboarding a large repository
+    leakcheck -summary ./...
+    
+    # Check the file being edited without loading its package
+    leakcheck -stdin-filename=pkg/server/server_test.go < pkg/server/server_test.go
+    
+    # Document the settings a CI job runs with
+    leakcheck -config-print -strict
+    
     # Quick analysis with timeout
     leakcheck -timeout=5m ./pkg/executor
 
+EXIT CODES:
+    0   No findings
+    1   Analysis failed, e.g. packages could not be loaded
+    3   Findings were reported (see -exit-on-findings)
+    4   Analysis timed out (see -timeout)
+
 For more information, visit: https://github.com/rleungx/leakcheck`)
 }
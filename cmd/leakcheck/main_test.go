@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// chdir changes the working directory to dir for the duration of the test
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := os.Chdir(wd); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+// runCapture runs the command line tool with args and returns its exit code and output
+func runCapture(args ...string) (code int, stdout, stderr string) {
+	var out, errOut bytes.Buffer
+	code = run(args, &out, &errOut)
+	return code, out.String(), errOut.String()
+}
+
+func TestRunText(t *testing.T) {
+	chdir(t, "../../testdata/src")
+
+	code, stdout, stderr := runCapture("-path-mode", "relative", "./basic")
+	if code != exitFindings {
+		t.Errorf("unexpected exit code %d", code)
+	}
+	if stdout != "" {
+		t.Errorf("unexpected stdout %q", stdout)
+	}
+	want := "basic/basic_test.go:16:1: test function TestWithoutGoleak is not covered by goleak (missing defer goleak.VerifyNone(t))\n"
+	if stderr != want {
+		t.Errorf("got stderr %q, want %q", stderr, want)
+	}
+}
+
+func TestRunJSON(t *testing.T) {
+	chdir(t, "../../testdata/src")
+
+	code, stdout, stderr := runCapture("-format", "json", "./basic")
+	if code != exitFindings || stderr != "" {
+		t.Errorf("unexpected exit code %d, stderr %q", code, stderr)
+	}
+	var finding struct {
+		Test string `json:"test"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &finding); err != nil || finding.Test != "TestWithoutGoleak" {
+		t.Errorf("unexpected stdout %q: %v", stdout, err)
+	}
+}
+
+func TestRunWarnUnusedExcludes(t *testing.T) {
+	chdir(t, "../../testdata/src")
+
+	code, _, stderr := runCapture("-warn-unused-excludes", "-exclude-packages", "basic,bsaic", "./basic")
+	if code != 0 {
+		t.Errorf("unexpected exit code %d", code)
+	}
+	if want := "leakcheck: warning: exclude-packages pattern \"bsaic\" matched nothing\n"; stderr != want {
+		t.Errorf("got stderr %q, want %q", stderr, want)
+	}
+}
+
+func TestRunWarnUnusedExcludesConfig(t *testing.T) {
+	chdir(t, "../../testdata/src")
+
+	path := filepath.Join(t.TempDir(), "leakcheck.yaml")
+	if err := os.WriteFile(path, []byte("warn-unused-excludes: true\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	code, _, stderr := runCapture("-config", path, "-exclude-packages", "basic,bsaic", "./basic")
+	if code != 0 {
+		t.Errorf("unexpected exit code %d", code)
+	}
+	if want := "leakcheck: warning: exclude-packages pattern \"bsaic\" matched nothing\n"; stderr != want {
+		t.Errorf("got stderr %q, want %q", stderr, want)
+	}
+}
+
+func TestRunIgnoreBadPatterns(t *testing.T) {
+	chdir(t, "../../testdata/src")
+
+	code, _, stderr := runCapture("-ignore-bad-patterns", "-exclude-packages", "basic,(basic,(basic", "./basic")
+	if code != 0 {
+		t.Errorf("unexpected exit code %d", code)
+	}
+	if want := "leakcheck: warning: exclude-packages: error parsing regexp: missing closing ): `(basic`; the pattern matches nothing\n"; stderr != want {
+		t.Errorf("got stderr %q, want %q", stderr, want)
+	}
+}
+
+func TestRunShowExcluded(t *testing.T) {
+	chdir(t, "../../testdata/src")
+
+	code, _, stderr := runCapture("-show-excluded", "-path-mode", "relative", "-exclude-packages", "basic", "-exclude-files", "exclude_test.go", "-exclude-functions", "TestNormalFile", "./basic", "./exclude_files")
+	if code != 0 {
+		t.Errorf("unexpected exit code %d", code)
+	}
+	want := "leakcheck: excluded 1 package(s) and 1 test file(s)\n" +
+		"  package src/basic\n" +
+		"  file " + filepath.Join("exclude_files", "exclude_test.go") + "\n"
+	if stderr != want {
+		t.Errorf("got stderr %q, want %q", stderr, want)
+	}
+}
+
+func TestRunVerbose(t *testing.T) {
+	chdir(t, "../../testdata/src")
+
+	code, stdout, stderr := runCapture("-v", "-path-mode", "relative", "-exclude-functions", "TestWithoutGoleak", "./basic")
+	if code != 0 || stdout != "" {
+		t.Errorf("got code %d, stdout %q", code, stdout)
+	}
+	file := filepath.Join("basic", "basic_test.go")
+	want := "leakcheck: " + file + ":10:1: TestWithGoleak is covered-by-defer: defers goleak.VerifyNone at line 11\n" +
+		"leakcheck: " + file + ":16:1: TestWithoutGoleak is excluded: the name matches exclude-functions pattern \"TestWithoutGoleak\"\n"
+	if stderr != want {
+		t.Errorf("got stderr %q, want %q", stderr, want)
+	}
+}
+
+func TestRunCoverage(t *testing.T) {
+	chdir(t, "../../testdata/src")
+
+	code, _, stderr := runCapture("-coverage", "./basic", "./multiple_files_with_main")
+	if code != exitFindings {
+		t.Errorf("unexpected exit code %d", code)
+	}
+	if want := "leakcheck: coverage: 83.3% of tests covered by goleak (5/6)\n"; !strings.HasSuffix(stderr, want) {
+		t.Errorf("got stderr %q, want it to end with %q", stderr, want)
+	}
+}
+
+func TestRunConfigPrint(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "leakcheck.yaml")
+	if err := os.WriteFile(path, []byte("check-subtests: true\ntimeout: 10m\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	code, stdout, stderr := runCapture("-config", path, "-timeout", "5m", "-config-print")
+	if code != 0 {
+		t.Fatalf("unexpected exit code %d, stderr %q", code, stderr)
+	}
+	var settings map[string]any
+	if err := json.Unmarshal([]byte(stdout), &settings); err != nil {
+		t.Fatalf("got stdout %q: %v", stdout, err)
+	}
+	// The file, the flags and the defaults all show
+	want := map[string]any{
+		"check-subtests": true,
+		"timeout":        "5m0s",
+		"concurrency":    float64(runtime.NumCPU()),
+		"test-prefixes":  []any{"Test"},
+	}
+	for key, value := range want {
+		if !reflect.DeepEqual(settings[key], value) {
+			t.Errorf("got %s %v, want %v", key, settings[key], value)
+		}
+	}
+}
+
+func TestRunStdin(t *testing.T) {
+	chdir(t, "../../testdata/src")
+
+	file := filepath.Join("multiple_files_with_main", "file1_test.go")
+	stdin, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+	saved := os.Stdin
+	os.Stdin = stdin
+	t.Cleanup(func() { os.Stdin = saved })
+
+	code, _, stderr := runCapture("-path-mode", "relative", "-stdin-filename", file)
+	if code != exitFindings {
+		t.Errorf("unexpected exit code %d", code)
+	}
+	want := file + ":10:1: test function TestFileOneWithMain is not covered by goleak (missing defer goleak.VerifyNone(t))\n" +
+		file + ":16:1: test function TestAnotherInFileOne is not covered by goleak (missing defer goleak.VerifyNone(t))\n" +
+		"leakcheck: warning: -stdin-filename can't see a TestMain in the other files of package src/multiple_files_with_main, which may cover these tests\n"
+	if stderr != want {
+		t.Errorf("got stderr %q, want %q", stderr, want)
+	}
+}
+
+func TestRunDiff(t *testing.T) {
+	chdir(t, "../../testdata/src")
+
+	// The first hunk touches the covered test, the second the uncovered one
+	for _, tt := range []struct {
+		hunk   string
+		code   int
+		stderr string
+	}{
+		{"@@ -11 +11 @@\n-\t// old\n+\t// test logic here\n", 0, ""},
+		{"@@ -17 +17 @@\n-\t// old\n+\t// test logic here\n", exitFindings, "TestWithoutGoleak is not covered"},
+	} {
+		diff := filepath.Join(t.TempDir(), "change.diff")
+		data := "--- a/basic/basic_test.go\n+++ b/basic/basic_test.go\n" + tt.hunk
+		if err := os.WriteFile(diff, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		code, _, stderr := runCapture("-diff", diff, "./basic")
+		if code != tt.code || !strings.Contains(stderr, tt.stderr) || tt.stderr == "" && stderr != "" {
+			t.Errorf("%q: got code %d, stderr %q", tt.hunk, code, stderr)
+		}
+	}
+}
+
+func TestRunTestJSON(t *testing.T) {
+	chdir(t, "../../testdata/src")
+
+	leak := `{"Action":"output","Package":"src/basic","Output":"goleak: Errors on successful test run: found unexpected goroutines:\n"}
+{"Action":"output","Package":"src/basic","Output":"created by src/basic.TestWithoutGoleak in goroutine 7\n"}
+`
+	clean := `{"Action":"pass","Package":"src/basic"}
+`
+	for _, tt := range []struct {
+		output string
+		code   int
+		stderr string
+	}{
+		{leak, exitFindings, "TestWithoutGoleak is not covered"},
+		{clean, 0, "leakcheck: note: the test output reports no leaked goroutines\n"},
+	} {
+		path := filepath.Join(t.TempDir(), "test.json")
+		if err := os.WriteFile(path, []byte(tt.output), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		code, _, stderr := runCapture("-test-json", path, "./basic")
+		if code != tt.code || !strings.Contains(stderr, tt.stderr) {
+			t.Errorf("got code %d, stderr %q", code, stderr)
+		}
+	}
+}
+
+func TestWriteBackup(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "a_test.go")
+
+	// A second -fix run keeps the first backup
+	for _, src := range []string{"first", "second"} {
+		if err := writeBackup(filename, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, want := range map[string]string{filename + ".orig": "first", filename + ".orig.1": "second"} {
+		if got, err := os.ReadFile(name); err != nil || string(got) != want {
+			t.Errorf("got %s %q, %v, want %q", name, got, err, want)
+		}
+	}
+}
+
+func TestRunInvalidArguments(t *testing.T) {
+	for _, tt := range []struct {
+		args   []string
+		code   int
+		stderr string
+	}{
+		{[]string{"-no-such-flag", "./..."}, 2, "flag provided but not defined: -no-such-flag"},
+		{[]string{"-format", "yaml", "./..."}, exitError, "leakcheck: -format: unknown format \"yaml\""},
+		{[]string{"-max-findings", "-1", "./..."}, exitError, "leakcheck: -max-findings must not be negative"},
+		{[]string{"-diff", "no-such-revision...HEAD", "./..."}, exitError, "leakcheck: -diff: git diff no-such-revision...HEAD"},
+		{[]string{"-diff", "-", "-test-json", "-", "./..."}, exitError, "leakcheck: -diff and -test-json can't both read stdin"},
+		{[]string{"-stdin-filename", "a_test.go", "./..."}, exitError, "leakcheck: -stdin-filename analyzes a single file and takes no package patterns"},
+		{[]string{"-stdin-filename", "a_test.go", "-diff", "-"}, exitError, "leakcheck: -stdin-filename reads the file from stdin, so -diff and -test-json can't"},
+		{[]string{"-go-version", "1.x", "./..."}, exitError, "leakcheck: -go-version: \"1.x\" is not a Go version"},
+		{[]string{"-exclude-files", "mock_test.go,(gen", "./..."}, exitError, "leakcheck: exclude-files: error parsing regexp: missing closing ): `(gen`"},
+	} {
+		code, _, stderr := runCapture(tt.args...)
+		if code != tt.code || !strings.Contains(stderr, tt.stderr) {
+			t.Errorf("%v: got code %d, stderr %q", tt.args, code, stderr)
+		}
+	}
+}
+
+func TestRunVersion(t *testing.T) {
+	code, stdout, stderr := runCapture("-V")
+	if code != 0 || stderr != "" || !strings.HasPrefix(stdout, "leakcheck has version ") {
+		t.Errorf("unexpected result %d, stdout %q, stderr %q", code, stdout, stderr)
+	}
+}
@@ -0,0 +1,413 @@
+package leakcheck
+
+import (
+	"errors"
+	"fmt"
+	"go/version"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFileName is the name of the repository-level configuration file
+const ConfigFileName = ".leakcheck.yaml"
+
+// FindConfigFile looks for ConfigFileName in dir and its parents, stopping at
+// the repository root (the first directory containing .git). It returns an
+// empty path if no configuration file is found.
+func FindConfigFile(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		path := filepath.Join(dir, ConfigFileName)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return "", nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// LoadConfigFile reads a YAML configuration file whose keys are the command
+// line flag names, e.g. exclude-files or check-subtests
+func LoadConfigFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var settings map[string]any
+	if err := yaml.Unmarshal(data, &settings); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	config := DefaultConfig()
+	if err := config.ApplySettings(settings); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	// The manifest is usually kept next to the configuration file
+	if config.ManifestFile != "" && !filepath.IsAbs(config.ManifestFile) {
+		config.ManifestFile = filepath.Join(filepath.Dir(path), config.ManifestFile)
+	}
+	return config, nil
+}
+
+// ApplySettings sets the configuration fields named by the keys of settings,
+// as decoded from YAML or JSON. Keys match the command line flag names and
+// unknown keys are rejected.
+func (c *Config) ApplySettings(settings map[string]any) error {
+	// Apply the keys in a fixed order so that errors are reproducible
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := settings[key]
+		var err error
+		switch key {
+		case "exclude-packages":
+			c.ExcludePackages, err = patternsValue(value)
+		case "exclude-files":
+			c.ExcludeFiles, err = patternsValue(value)
+		case "exclude-dirs":
+			c.ExcludeDirs, err = listValue(value)
+		case "concurrency":
+			c.Concurrency, err = intValue(value)
+		case "dedupe":
+			c.Dedupe, err = boolValue(value)
+		case "max-findings":
+			c.MaxFindings, err = intValue(value)
+			if err == nil && c.MaxFindings < 0 {
+				err = errors.New("must not be negative")
+			}
+		case "timeout":
+			c.Timeout, err = durationValue(value)
+		case "anchor-packages":
+			c.AnchorPackagePatterns, err = boolValue(value)
+		case "check-subtests":
+			c.CheckSubtests, err = boolValue(value)
+		case "check-parallel":
+			c.CheckParallel, err = boolValue(value)
+		case "check-examples":
+			c.CheckExamples, err = boolValue(value)
+		case "check-helpers":
+			c.CheckHelpers, err = boolValue(value)
+		case "test-prefixes":
+			c.TestPrefixes, err = listValue(value)
+		case "check-options":
+			c.CheckOptions, err = boolValue(value)
+		case "check-commented-out":
+			c.CheckCommentedOut, err = boolValue(value)
+		case "check-defer-order":
+			c.CheckDeferOrder, err = boolValue(value)
+		case "check-redundant":
+			c.CheckRedundant, err = boolValue(value)
+		case "flag-conditional-coverage":
+			c.FlagConditionalCoverage, err = boolValue(value)
+		case "check-testmain-setup":
+			c.CheckTestMainSetup, err = boolValue(value)
+		case "warn-unused-excludes":
+			c.WarnUnusedExcludes, err = boolValue(value)
+		case "only-goroutine-tests":
+			c.OnlyGoroutineStartingTests, err = boolValue(value)
+		case "group-no-import":
+			c.GroupNoImport, err = boolValue(value)
+		case "manifest-file":
+			c.ManifestFile, err = stringValue(value)
+		case "message-template":
+			if c.MessageTemplate, err = stringValue(value); err == nil {
+				err = ValidateMessageTemplate(c.MessageTemplate)
+			}
+		case "ignore-bad-patterns":
+			c.IgnoreBadPatterns, err = boolValue(value)
+		case "require-tests":
+			c.RequireTests, err = boolValue(value)
+		case "strict":
+			c.Strict, err = boolValue(value)
+		case "goleak-paths":
+			c.GoleakImportPaths, err = listValue(value)
+		case "verify-funcs":
+			c.VerifyFuncs, err = listValue(value)
+		case "verify-testmain-funcs":
+			c.VerifyTestMainFuncs, err = listValue(value)
+		case "check-suites":
+			c.CheckSuites, err = boolValue(value)
+		case "suggest-testmain":
+			c.TestMainSuggestThreshold, err = intValue(value)
+		case "exclude-functions":
+			c.ExcludeFunctions, err = patternsValue(value)
+		case "exclude-build-tags":
+			c.ExcludeBuildTags, err = listValue(value)
+		case "package-rules":
+			c.PackageRules, err = packageRulesValue(value)
+		case "ignored-top-functions":
+			c.IgnoredTopFunctions, err = listValue(value)
+		case "skip-generated":
+			c.SkipGenerated, err = boolValue(value)
+		case "include-vendor":
+			c.IncludeVendor, err = boolValue(value)
+		case "go-version":
+			c.GoVersion, err = goVersionValue(value)
+		default:
+			return fmt.Errorf("unknown setting %q", key)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid value for %q: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// Settings returns the effective configuration keyed like ApplySettings,
+// with the defaults the analyzer fills in resolved, e.g. concurrency as the
+// number of CPUs. Every setting is present but go-version, which is left out
+// when unset so that the go directive of each module applies. Encoded as JSON
+// or YAML, the settings read back as a configuration file.
+func (c *Config) Settings() map[string]any {
+	resolved := *c
+	resolved.setDefaults()
+
+	list := func(items []string) []string {
+		if items == nil {
+			return []string{}
+		}
+		return items
+	}
+	rules := make([]map[string]any, 0, len(resolved.PackageRules))
+	for _, rule := range resolved.PackageRules {
+		rules = append(rules, map[string]any{
+			"packages":          rule.Packages,
+			"exclude-files":     rule.ExcludeFiles,
+			"exclude-functions": rule.ExcludeFunctions,
+		})
+	}
+
+	settings := map[string]any{
+		"exclude-packages":          resolved.ExcludePackages,
+		"exclude-files":             resolved.ExcludeFiles,
+		"exclude-dirs":              list(resolved.ExcludeDirs),
+		"concurrency":               resolved.Concurrency,
+		"max-findings":              resolved.MaxFindings,
+		"dedupe":                    resolved.Dedupe,
+		"timeout":                   resolved.Timeout.String(),
+		"anchor-packages":           resolved.AnchorPackagePatterns,
+		"check-subtests":            resolved.CheckSubtests,
+		"check-parallel":            resolved.CheckParallel,
+		"check-examples":            resolved.CheckExamples,
+		"check-helpers":             resolved.CheckHelpers,
+		"test-prefixes":             list(resolved.TestPrefixes),
+		"check-options":             resolved.CheckOptions,
+		"check-commented-out":       resolved.CheckCommentedOut,
+		"check-defer-order":         resolved.CheckDeferOrder,
+		"check-redundant":           resolved.CheckRedundant,
+		"flag-conditional-coverage": resolved.FlagConditionalCoverage,
+		"check-testmain-setup":      resolved.CheckTestMainSetup,
+		"warn-unused-excludes":      resolved.WarnUnusedExcludes,
+		"only-goroutine-tests":      resolved.OnlyGoroutineStartingTests,
+		"group-no-import":           resolved.GroupNoImport,
+		"manifest-file":             resolved.ManifestFile,
+		"message-template":          resolved.MessageTemplate,
+		"ignore-bad-patterns":       resolved.IgnoreBadPatterns,
+		"require-tests":             resolved.RequireTests,
+		"strict":                    resolved.Strict,
+		"goleak-paths":              list(resolved.GoleakImportPaths),
+		"verify-funcs":              list(resolved.VerifyFuncs),
+		"verify-testmain-funcs":     list(resolved.VerifyTestMainFuncs),
+		"check-suites":              resolved.CheckSuites,
+		"suggest-testmain":          resolved.TestMainSuggestThreshold,
+		"exclude-functions":         resolved.ExcludeFunctions,
+		"exclude-build-tags":        list(resolved.ExcludeBuildTags),
+		"package-rules":             rules,
+		"ignored-top-functions":     list(resolved.IgnoredTopFunctions),
+		"skip-generated":            resolved.SkipGenerated,
+		"include-vendor":            resolved.IncludeVendor,
+	}
+	if resolved.GoVersion != "" {
+		settings["go-version"] = resolved.GoVersion
+	}
+	return settings
+}
+
+// Validate checks that the regular expressions among the exclusion patterns
+// compile. The analysis would otherwise treat an invalid one as matching
+// nothing, so a typo silently excludes nothing. The errors of all invalid
+// patterns are joined, each prefixed with the name of its setting.
+func (c *Config) Validate() error {
+	var errs []error
+	seen := make(map[string]bool)
+	check := func(setting, pattern string) {
+		// Only patterns with metacharacters other than * are compiled as is, see matchesPattern
+		if !containsRegexMetachars(pattern) || seen[setting+"\x00"+pattern] {
+			return
+		}
+		seen[setting+"\x00"+pattern] = true
+		if _, err := regexp.Compile(pattern); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", setting, err))
+		}
+	}
+	checkAll := func(setting, patterns string) {
+		for _, pattern := range strings.Split(patterns, ",") {
+			check(setting, strings.TrimSpace(pattern))
+		}
+	}
+
+	checkAll("exclude-packages", c.ExcludePackages)
+	checkAll("exclude-files", c.ExcludeFiles)
+	checkAll("exclude-functions", c.ExcludeFunctions)
+	for i, rule := range c.PackageRules {
+		check(fmt.Sprintf("package-rules: rule %d: packages", i), strings.TrimSpace(rule.Packages))
+		checkAll(fmt.Sprintf("package-rules: rule %d: exclude-files", i), rule.ExcludeFiles)
+		checkAll(fmt.Sprintf("package-rules: rule %d: exclude-functions", i), rule.ExcludeFunctions)
+	}
+	return errors.Join(errs...)
+}
+
+// goVersionValue accepts a Go version such as "1.21" or "go1.21". It must be
+// quoted in YAML, where 1.20 would otherwise be read as the number 1.2.
+func goVersionValue(value any) (string, error) {
+	v, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("expected a quoted Go version such as \"1.21\", got %T", value)
+	}
+	if !version.IsValid("go" + strings.TrimPrefix(v, "go")) {
+		return "", fmt.Errorf("%q is not a Go version", v)
+	}
+	return v, nil
+}
+
+// packageRulesValue accepts a list of rule blocks, each with a packages key
+// and the exclusion settings it overrides
+func packageRulesValue(value any) ([]PackageRule, error) {
+	items, ok := value.([]any)
+	if !ok {
+		return nil, fmt.Errorf("expected list of rules, got %T", value)
+	}
+	rules := make([]PackageRule, 0, len(items))
+	for i, item := range items {
+		settings, ok := item.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("rule %d: expected map, got %T", i, item)
+		}
+		var rule PackageRule
+		for key, value := range settings {
+			var err error
+			switch key {
+			case "packages":
+				rule.Packages, err = patternsValue(value)
+			case "exclude-files":
+				rule.ExcludeFiles, err = patternsValue(value)
+			case "exclude-functions":
+				rule.ExcludeFunctions, err = patternsValue(value)
+			default:
+				return nil, fmt.Errorf("rule %d: unknown setting %q", i, key)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: invalid value for %q: %w", i, key, err)
+			}
+		}
+		if rule.Packages == "" {
+			return nil, fmt.Errorf("rule %d: missing packages", i)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// patternsValue accepts either a comma-separated string or a list of patterns
+func patternsValue(value any) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case []any:
+		patterns := make([]string, 0, len(v))
+		for _, item := range v {
+			pattern, ok := item.(string)
+			if !ok {
+				return "", fmt.Errorf("expected string pattern, got %T", item)
+			}
+			patterns = append(patterns, pattern)
+		}
+		return strings.Join(patterns, ","), nil
+	default:
+		return "", fmt.Errorf("expected string or list, got %T", value)
+	}
+}
+
+// listValue accepts either a comma-separated string or a list of strings
+func listValue(value any) ([]string, error) {
+	joined, err := patternsValue(value)
+	if err != nil {
+		return nil, err
+	}
+	var items []string
+	for _, item := range strings.Split(joined, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+// intValue accepts any integer type produced by YAML or JSON decoders
+func intValue(value any) (int, error) {
+	switch v := value.(type) {
+	case int:
+		return v, nil
+	case int64:
+		return int(v), nil
+	case uint64:
+		return int(v), nil
+	case float64:
+		if v != float64(int(v)) {
+			return 0, fmt.Errorf("expected integer, got %v", v)
+		}
+		return int(v), nil
+	default:
+		return 0, fmt.Errorf("expected integer, got %T", value)
+	}
+}
+
+// durationValue accepts a duration string such as "10m"
+func durationValue(value any) (time.Duration, error) {
+	v, ok := value.(string)
+	if !ok {
+		return 0, fmt.Errorf("expected duration string, got %T", value)
+	}
+	return time.ParseDuration(v)
+}
+
+// stringValue accepts a string
+func stringValue(value any) (string, error) {
+	v, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("expected string, got %T", value)
+	}
+	return v, nil
+}
+
+// boolValue accepts a boolean
+func boolValue(value any) (bool, error) {
+	v, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("expected boolean, got %T", value)
+	}
+	return v, nil
+}
@@ -0,0 +1,220 @@
+package leakcheck_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rleungx/leakcheck"
+)
+
+func TestLoadConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, leakcheck.ConfigFileName)
+	data := `
+exclude-packages: [vendor, internal]
+exclude-files: mock_test.go
+timeout: 10m
+check-subtests: true
+test-prefixes: [Test, ITest]
+manifest-file: leak-sensitive.txt
+package-rules:
+  - packages: example.com/team
+    exclude-functions: [TestLegacy*, TestSlow*]
+`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := leakcheck.LoadConfigFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ExcludePackages != "vendor,internal" {
+		t.Errorf("unexpected exclude packages %q", config.ExcludePackages)
+	}
+	if config.ExcludeFiles != "mock_test.go" {
+		t.Errorf("unexpected exclude files %q", config.ExcludeFiles)
+	}
+	if config.Timeout != 10*time.Minute {
+		t.Errorf("unexpected timeout %v", config.Timeout)
+	}
+	if !config.CheckSubtests {
+		t.Error("expected check-subtests to be set")
+	}
+	if strings.Join(config.TestPrefixes, ",") != "Test,ITest" {
+		t.Errorf("unexpected test prefixes %q", config.TestPrefixes)
+	}
+	// The manifest is found next to the configuration file
+	if want := filepath.Join(dir, "leak-sensitive.txt"); config.ManifestFile != want {
+		t.Errorf("got manifest file %q, want %q", config.ManifestFile, want)
+	}
+	want := []leakcheck.PackageRule{{Packages: "example.com/team", ExcludeFunctions: "TestLegacy*,TestSlow*"}}
+	if !reflect.DeepEqual(config.PackageRules, want) {
+		t.Errorf("unexpected package rules %+v", config.PackageRules)
+	}
+}
+
+func TestLoadConfigFileErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"unknown key", "exclude-folders: vendor\n", `unknown setting "exclude-folders"`},
+		{"bad value", "check-subtests: maybe\n", `invalid value for "check-subtests"`},
+		{"not a map", "- vendor\n", "cannot unmarshal"},
+		{"negative max findings", "max-findings: -1\n", `invalid value for "max-findings": must not be negative`},
+		{"bad go version", "go-version: \"1.x\"\n", `invalid value for "go-version": "1.x" is not a Go version`},
+		{"unquoted go version", "go-version: 1.20\n", `invalid value for "go-version": expected a quoted Go version`},
+		{"bad manifest file", "manifest-file: [a.txt]\n", `invalid value for "manifest-file": expected string`},
+		{"bad message template", "message-template: \"{message} ({test})\"\n", `invalid value for "message-template": unknown placeholder "{test}"`},
+		{"rule without packages", "package-rules:\n  - exclude-files: mock_test.go\n", "rule 0: missing packages"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), leakcheck.ConfigFileName)
+			if err := os.WriteFile(path, []byte(tt.data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := leakcheck.LoadConfigFile(path)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestSettings(t *testing.T) {
+	config := leakcheck.DefaultConfig()
+	config.ExcludeDirs = []string{"vendor"}
+	config.CheckSubtests = true
+	config.GoVersion = "1.21"
+	config.PackageRules = []leakcheck.PackageRule{{Packages: "example.com/team", ExcludeFunctions: "TestLegacy*"}}
+
+	settings := config.Settings()
+	if got, want := settings["concurrency"], runtime.NumCPU(); got != want {
+		t.Errorf("got concurrency %v, want %v", got, want)
+	}
+	if got, want := settings["timeout"], "30m0s"; got != want {
+		t.Errorf("got timeout %v, want %v", got, want)
+	}
+	if got, want := settings["verify-funcs"], []string{"VerifyNone"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got verify-funcs %v, want %v", got, want)
+	}
+	// Resolving the defaults leaves the configuration itself alone
+	if config.Concurrency != 0 || config.VerifyFuncs != nil {
+		t.Errorf("Settings changed the configuration: %+v", config)
+	}
+
+	// The settings read back as a configuration file
+	data, err := json.Marshal(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	got := &leakcheck.Config{}
+	if err := got.ApplySettings(decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Settings(), settings) {
+		t.Errorf("got settings %v after a round trip, want %v", got.Settings(), settings)
+	}
+	if _, ok := leakcheck.DefaultConfig().Settings()["go-version"]; ok {
+		t.Error("expected no go-version when unset")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config leakcheck.Config
+		want   []string
+	}{
+		{"empty", leakcheck.Config{}, nil},
+		{"plain and glob patterns", leakcheck.Config{ExcludePackages: "vendor,mocks*", ExcludeFiles: "mock_*", ExcludeFunctions: "TestSlow*"}, nil},
+		// The dot makes it a regular expression rather than a glob, which never matched
+		{"glob with metacharacters", leakcheck.Config{ExcludeFiles: "*_mock_test.go"}, []string{"exclude-files: error parsing regexp: missing argument to repetition operator: `*`"}},
+		{"valid regexp", leakcheck.Config{ExcludeFunctions: "^Test(Slow|Flaky)"}, nil},
+		{"invalid regexp", leakcheck.Config{ExcludePackages: "vendor, internal/(gen"}, []string{"exclude-packages: error parsing regexp: missing closing ): `internal/(gen`"}},
+		{"all errors", leakcheck.Config{ExcludeFiles: "[a-", ExcludeFunctions: "Test(Slow"}, []string{"exclude-files: error parsing regexp", "exclude-functions: error parsing regexp"}},
+		{"package rule", leakcheck.Config{PackageRules: []leakcheck.PackageRule{{Packages: "example.com/team"}, {Packages: "example.com/(a|b", ExcludeFiles: "gen_test.go"}}}, []string{"package-rules: rule 1: packages: error parsing regexp"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected errors containing %q", tt.want)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("expected error containing %q, got %v", want, err)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateMessageTemplate(t *testing.T) {
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{"", ""},
+		{"{message}; see https://wiki.example.com/goleak#{reason}", ""},
+		{"{func} in {pkg}: {reason}", ""},
+		{"{message} ({test})", `unknown placeholder "{test}", want {message}, {func}, {pkg} or {reason}`},
+		{"{message", `unclosed placeholder "{message"`},
+	}
+	for _, tt := range tests {
+		err := leakcheck.ValidateMessageTemplate(tt.template)
+		if tt.want == "" && err != nil || tt.want != "" && (err == nil || err.Error() != tt.want) {
+			t.Errorf("ValidateMessageTemplate(%q) = %v, want %q", tt.template, err, tt.want)
+		}
+	}
+}
+
+func TestFindConfigFile(t *testing.T) {
+	root := t.TempDir()
+	nested := filepath.Join(root, "a", "b")
+	if err := os.MkdirAll(nested, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(root, ".git"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	path, err := leakcheck.FindConfigFile(nested)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "" {
+		t.Fatalf("expected no configuration file, got %q", path)
+	}
+
+	want := filepath.Join(root, leakcheck.ConfigFileName)
+	if err := os.WriteFile(want, []byte("check-subtests: true\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	path, err = leakcheck.FindConfigFile(nested)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != want {
+		t.Fatalf("expected %q, got %q", want, path)
+	}
+}
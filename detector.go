@@ -0,0 +1,23 @@
+package leakcheck
+
+// DetectorInfo describes a goroutine leak detector the analyzer recognizes
+type DetectorInfo struct {
+	Name                string   // short name of the detector, e.g. "goleak"
+	ImportPaths         []string // import paths the detector is recognized under
+	VerifyFuncs         []string // functions verifying a single test, called with its *testing.T
+	VerifyTestMainFuncs []string // functions verifying every test of a package from TestMain
+}
+
+// SupportedDetectors returns the leak detectors the analyzer recognizes by
+// default, so that tools can present them. goleak is the only one: forks and
+// vendored copies are configured with Config.GoleakImportPaths,
+// Config.VerifyFuncs and Config.VerifyTestMainFuncs, which this list leaves
+// out.
+func SupportedDetectors() []DetectorInfo {
+	return []DetectorInfo{{
+		Name:                defaultAlias,
+		ImportPaths:         []string{goleakUberPath, goleakGithubPath},
+		VerifyFuncs:         []string{verifyNone},
+		VerifyTestMainFuncs: []string{verifyTestMain},
+	}}
+}
@@ -0,0 +1,210 @@
+package leakcheck
+
+import (
+	"bufio"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ChangedLines records the lines of each file that a unified diff adds or
+// modifies, numbered as in the new version of the file. A deletion that no
+// line replaces marks the line before it, so that removing the verification
+// from a test touches the test.
+type ChangedLines struct {
+	// files maps the slash-separated path of each file in the diff, relative
+	// to the root of the diff, to its changed lines
+	files map[string]map[int]bool
+}
+
+// ParseDiff reads a unified diff, such as the output of git diff, and returns
+// the lines it changes. Deleted files are left out.
+func ParseDiff(r io.Reader) (*ChangedLines, error) {
+	changed := &ChangedLines{files: make(map[string]map[int]bool)}
+	var lines map[int]bool // lines of the current file, nil when skipped
+	var oldLeft, newLeft int
+	var next int     // number of the next line of the new version
+	var deleted bool // lines were deleted and not replaced yet
+
+	// A pure deletion marks the line before it, once the run of changed
+	// lines ends without a replacement
+	flushDeleted := func() {
+		if deleted && lines != nil {
+			lines[max(next-1, 1)] = true
+		}
+		deleted = false
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		// Inside a hunk, as many lines as its header announced
+		if oldLeft > 0 || newLeft > 0 {
+			switch {
+			case strings.HasPrefix(line, "+"):
+				if lines != nil {
+					lines[next] = true
+				}
+				next++
+				newLeft--
+				deleted = false
+			case strings.HasPrefix(line, "-"):
+				oldLeft--
+				deleted = true
+			case strings.HasPrefix(line, " ") || line == "":
+				flushDeleted()
+				next++
+				oldLeft--
+				newLeft--
+			case strings.HasPrefix(line, `\`):
+				// \ No newline at end of file
+			default:
+				return nil, fmt.Errorf("diff line %d: unexpected line in hunk: %q", n, line)
+			}
+			if oldLeft <= 0 && newLeft <= 0 {
+				flushDeleted()
+			}
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "+++ "):
+			name := diffFileName(strings.TrimPrefix(line, "+++ "))
+			if name == "" {
+				lines = nil
+				continue
+			}
+			if lines = changed.files[name]; lines == nil {
+				lines = make(map[int]bool)
+				changed.files[name] = lines
+			}
+		case strings.HasPrefix(line, "@@ "):
+			var err error
+			if next, oldLeft, newLeft, err = parseHunkHeader(line); err != nil {
+				return nil, fmt.Errorf("diff line %d: %w", n, err)
+			}
+			// An empty range starts after the line it names
+			if newLeft == 0 {
+				next++
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return changed, nil
+}
+
+// diffFileName returns the path of a +++ header, without the b/ prefix of
+// git diffs and any trailing timestamp, or "" for /dev/null
+func diffFileName(header string) string {
+	name, _, _ := strings.Cut(header, "\t")
+	name = strings.TrimSpace(name)
+	if unquoted, err := strconv.Unquote(name); err == nil {
+		name = unquoted
+	}
+	if name == "/dev/null" {
+		return ""
+	}
+	if rest, ok := strings.CutPrefix(name, "b/"); ok {
+		name = rest
+	}
+	return filepath.ToSlash(filepath.Clean(name))
+}
+
+// parseHunkHeader parses a hunk header such as @@ -12,3 +12,4 @@ into the
+// first line of the new version and the number of old and new lines
+func parseHunkHeader(header string) (start, oldCount, newCount int, err error) {
+	fields := strings.Fields(header)
+	if len(fields) < 4 || !strings.HasPrefix(fields[1], "-") || !strings.HasPrefix(fields[2], "+") {
+		return 0, 0, 0, fmt.Errorf("malformed hunk header %q", header)
+	}
+	if _, oldCount, err = parseHunkRange(fields[1][1:]); err != nil {
+		return 0, 0, 0, fmt.Errorf("malformed hunk header %q: %w", header, err)
+	}
+	if start, newCount, err = parseHunkRange(fields[2][1:]); err != nil {
+		return 0, 0, 0, fmt.Errorf("malformed hunk header %q: %w", header, err)
+	}
+	return start, oldCount, newCount, nil
+}
+
+// parseHunkRange parses the start,count range of a hunk header, in which the
+// count defaults to 1
+func parseHunkRange(s string) (start, count int, err error) {
+	startText, countText, found := strings.Cut(s, ",")
+	if start, err = strconv.Atoi(startText); err != nil {
+		return 0, 0, err
+	}
+	if !found {
+		return start, 1, nil
+	}
+	count, err = strconv.Atoi(countText)
+	return start, count, err
+}
+
+// linesOf returns the changed lines of filename, matched against the paths of
+// the diff by suffix since those are relative to an unknown root. The longest
+// matching path wins.
+func (c *ChangedLines) linesOf(filename string) map[int]bool {
+	if abs, err := filepath.Abs(filename); err == nil {
+		filename = abs
+	}
+	filename = filepath.ToSlash(filename)
+
+	var best string
+	for name := range c.files {
+		if (filename == name || strings.HasSuffix(filename, "/"+name)) && len(name) > len(best) {
+			best = name
+		}
+	}
+	return c.files[best]
+}
+
+// FilterChanged returns the findings whose enclosing declaration, usually
+// the test function, overlaps a line changed by the diff. The declarations
+// are found by parsing the files of the findings; a finding in a file that
+// can't be parsed only counts its own line.
+func FilterChanged(findings []Finding, changed *ChangedLines) []Finding {
+	fset := token.NewFileSet()
+	files := make(map[string]*ast.File)
+
+	var kept []Finding
+	for _, finding := range findings {
+		filename := finding.Position.Filename
+		lines := changed.linesOf(filename)
+		if len(lines) == 0 {
+			continue
+		}
+
+		file, ok := files[filename]
+		if !ok {
+			// A parse error leaves file nil, recorded so it is tried once
+			file, _ = parser.ParseFile(fset, filename, nil, parser.SkipObjectResolution)
+			files[filename] = file
+		}
+		from, to := finding.Position.Line, finding.Position.Line
+		if file != nil {
+			for _, decl := range file.Decls {
+				start, end := fset.Position(decl.Pos()).Line, fset.Position(decl.End()).Line
+				if start <= from && from <= end {
+					from, to = start, end
+					break
+				}
+			}
+		}
+
+		for line := from; line <= to; line++ {
+			if lines[line] {
+				kept = append(kept, finding)
+				break
+			}
+		}
+	}
+	return kept
+}
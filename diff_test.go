@@ -0,0 +1,98 @@
+package leakcheck_test
+
+import (
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rleungx/leakcheck"
+)
+
+func TestFilterChanged(t *testing.T) {
+	src := `package pkg
+
+import "testing"
+
+func TestModified(t *testing.T) {
+	t.Log("new")
+}
+
+func TestUntouched(t *testing.T) {
+	t.Log("old")
+}
+
+func TestDeletion(t *testing.T) {
+	t.Log("kept")
+}
+
+func TestDeletionAtEnd(t *testing.T) {
+	t.Log("kept")
+}
+`
+	dir := filepath.Join(t.TempDir(), "pkg")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(dir, "pkg_test.go")
+	if err := os.WriteFile(filename, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	diff := `diff --git a/pkg/pkg_test.go b/pkg/pkg_test.go
+--- a/pkg/pkg_test.go
++++ b/pkg/pkg_test.go
+@@ -6 +6 @@ func TestModified(t *testing.T) {
+-	t.Log("old")
++	t.Log("new")
+@@ -11,6 +11,5 @@ func TestUntouched(t *testing.T) {
+ }
+ 
+ func TestDeletion(t *testing.T) {
+-	defer goleak.VerifyNone(t)
+ 	t.Log("kept")
+ }
+@@ -20 +18,0 @@ func TestDeletionAtEnd(t *testing.T) {
+-	defer goleak.VerifyNone(t)
+diff --git a/other_test.go b/other_test.go
+deleted file mode 100644
+--- a/other_test.go
++++ /dev/null
+@@ -1,2 +0,0 @@
+-package other
+-
+`
+	changed, err := leakcheck.ParseDiff(strings.NewReader(diff))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	finding := func(testFunc string, line int) leakcheck.Finding {
+		return leakcheck.Finding{TestFunc: testFunc, Position: token.Position{Filename: filename, Line: line}}
+	}
+	findings := []leakcheck.Finding{
+		finding("", 3), // package-level, on the import
+		finding("TestModified", 5),
+		finding("TestUntouched", 9),
+		finding("TestDeletion", 13),
+		finding("TestDeletionAtEnd", 17),
+		{TestFunc: "TestOther", Position: token.Position{Filename: filepath.Join(dir, "other_test.go"), Line: 3}},
+	}
+	want := []leakcheck.Finding{findings[1], findings[3], findings[4]}
+	if got := leakcheck.FilterChanged(findings, changed); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestParseDiffMalformed(t *testing.T) {
+	for _, diff := range []string{
+		"+++ b/x_test.go\n@@ -1 +1,x @@\n",
+		"+++ b/x_test.go\n@@ -1,2 +1,2 @@\n+added\nnot a hunk line\n",
+	} {
+		if _, err := leakcheck.ParseDiff(strings.NewReader(diff)); err == nil {
+			t.Errorf("expected an error parsing %q", diff)
+		}
+	}
+}
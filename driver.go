@@ -0,0 +1,503 @@
+package leakcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/checker"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/inspector"
+	"golang.org/x/tools/go/packages"
+)
+
+// loadMode matches the mode used by singlechecker, so that the driver sees
+// exactly the same packages as the standard command line tool
+const loadMode = packages.LoadAllSyntax | packages.NeedModule
+
+// Analyze loads the packages matching patterns, including their tests, runs the
+// analyzer configured by config over them and returns the collected findings.
+// Unlike singlechecker it does not print anything, leaving presentation to the caller.
+func Analyze(config *Config, patterns ...string) ([]Finding, error) {
+	results, err := AnalyzePackages(config, patterns...)
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []Finding
+	for _, result := range results {
+		findings = append(findings, result.Findings...)
+	}
+	return findings, nil
+}
+
+// LimitFindings returns the first max of findings, aggregated across packages,
+// and the number of findings left out. A max of zero or less keeps them all.
+func LimitFindings(findings []Finding, max int) ([]Finding, int) {
+	if max <= 0 || len(findings) <= max {
+		return findings, 0
+	}
+	return findings[:max], len(findings) - max
+}
+
+// DedupeFindings returns findings without repeats of the same issue, keeping
+// the first of each in order. Findings repeat when the internal and external
+// test packages of a directory report the same package-level problem, such as
+// goleak not being imported with Config.GroupNoImport. Two findings are the
+// same issue when their fingerprints match once the external test package is
+// folded into the package it tests; findings about a test function must also
+// share a position, so that distinct problems of one test are all kept.
+func DedupeFindings(findings []Finding) []Finding {
+	seen := make(map[string]bool, len(findings))
+	kept := make([]Finding, 0, len(findings))
+	for _, finding := range findings {
+		key := dedupeKey(finding)
+		if !seen[key] {
+			seen[key] = true
+			kept = append(kept, finding)
+		}
+	}
+	return kept
+}
+
+// dedupeKey identifies the issue a finding reports, see DedupeFindings
+func dedupeKey(finding Finding) string {
+	finding.Package = strings.TrimSuffix(finding.Package, "_test")
+	key := finding.Fingerprint()
+	if finding.TestFunc != "" {
+		key += "\x00" + finding.Position.String()
+	}
+	return key
+}
+
+// UnusedExcludes returns the patterns of config's exclude options that
+// matched no package, test file or test function in results, which must come
+// from a run with config.WarnUnusedExcludes set. Patterns of PackageRules
+// are not checked.
+func UnusedExcludes(config *Config, results []*Result) []ExcludePattern {
+	matched := make(map[ExcludePattern]bool)
+	for _, result := range results {
+		for _, exclude := range result.MatchedExcludes {
+			matched[exclude] = true
+		}
+	}
+
+	var unused []ExcludePattern
+	for _, exclude := range configuredExcludes(config) {
+		if !matched[exclude] {
+			unused = append(unused, exclude)
+		}
+	}
+	return unused
+}
+
+// Excluded returns the import paths of the packages and the names of the test
+// files that config excluded in results, each listed once and sorted. A
+// package analyzed both with its internal and external tests counts once.
+func Excluded(results []*Result) (packages, files []string) {
+	for _, result := range results {
+		if result.Excluded {
+			packages = append(packages, strings.TrimSuffix(result.Package, "_test"))
+		}
+		files = append(files, result.ExcludedFiles...)
+	}
+	sort.Strings(packages)
+	sort.Strings(files)
+	return slices.Compact(packages), slices.Compact(files)
+}
+
+// CountCovered returns the number of test functions in results covered by
+// goleak, by their own verification or by TestMain, and the number of tests
+// counted. Excluded tests count in neither.
+func CountCovered(results []*Result) (covered, total int) {
+	for _, result := range results {
+		for _, test := range result.Tests {
+			switch test.Coverage {
+			case CoverageExcluded:
+				continue
+			case CoverageDefer, CoverageTestMain:
+				covered++
+			}
+			total++
+		}
+	}
+	return covered, total
+}
+
+// ProgressFunc is called by AnalyzeContext each time a package has been
+// analyzed, with the number of packages done so far out of total
+type ProgressFunc func(pkgPath string, done, total int)
+
+// AnalyzePackages is like Analyze but returns the full per-package results,
+// including the coverage status of every test, in package load order.
+//
+// Packages are analyzed concurrently, up to config.Concurrency at a time, and
+// config.Timeout bounds the whole run including package loading.
+func AnalyzePackages(config *Config, patterns ...string) ([]*Result, error) {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	// Fill in the defaults first so that the timeout is known
+	config.setDefaults()
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.Timeout)
+	defer cancel()
+
+	return analyzeContext(ctx, config, config.Timeout, nil, patterns...)
+}
+
+// AnalyzeContext is like AnalyzePackages but is bounded by ctx instead of
+// config.Timeout, so that embedding tools can cancel a run. If progress is
+// not nil it is called, never concurrently, as each package completes.
+//
+// Once ctx is done no more packages are started, and the packages already
+// being analyzed are waited for, so that progress is never called after
+// AnalyzeContext returns. When ctx passes its deadline, the TimeoutError
+// reports that deadline, with a zero Timeout.
+func AnalyzeContext(ctx context.Context, config *Config, progress ProgressFunc, patterns ...string) ([]*Result, error) {
+	return analyzeContext(ctx, config, 0, func(pkgPath string, _ []*Result, done, total int) {
+		if progress != nil {
+			progress(pkgPath, done, total)
+		}
+	}, patterns...)
+}
+
+// completionFunc is called by analyzeContext, never concurrently, with the
+// results of each package as it completes, nil when its analysis failed
+type completionFunc func(pkgPath string, results []*Result, done, total int)
+
+// analyzeContext implements AnalyzePackages and AnalyzeContext. timeout is
+// the configured timeout ctx was derived from, or zero when ctx is the
+// caller's, in which case a TimeoutError reports its deadline instead. If
+// completed is not nil it is called as each package is analyzed.
+func analyzeContext(ctx context.Context, config *Config, timeout time.Duration, completed completionFunc, patterns ...string) ([]*Result, error) {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	// Creating the analyzer also fills in the configuration defaults
+	analyzer := NewWithConfig(config)
+
+	pkgs, err := packages.Load(&packages.Config{Context: ctx, Mode: loadMode, Tests: true}, patterns...)
+	if err != nil {
+		return nil, loadFailure(ctx, timeout, err)
+	}
+	if err := loadErrors(pkgs); err != nil {
+		return nil, err
+	}
+
+	// Each package writes only to its own slot, keeping the output in load order
+	type outcome struct {
+		results []*Result
+		err     error
+	}
+	outcomes := make([]outcome, len(pkgs))
+
+	var mu sync.Mutex
+	done := 0
+	inFlight := make(map[string]bool)
+
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+
+		var wg sync.WaitGroup
+		semaphore := make(chan struct{}, config.Concurrency)
+		for i, pkg := range pkgs {
+			// Checked first, as select picks at random when a worker is also free
+			if ctx.Err() != nil {
+				break
+			}
+			select {
+			case <-ctx.Done():
+				wg.Wait()
+				return
+			case semaphore <- struct{}{}:
+			}
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-semaphore }()
+				mu.Lock()
+				inFlight[pkg.ID] = true
+				mu.Unlock()
+
+				outcomes[i].results, outcomes[i].err = analyzePackage(analyzer, pkg)
+
+				mu.Lock()
+				delete(inFlight, pkg.ID)
+				done++
+				if completed != nil {
+					completed(pkg.PkgPath, outcomes[i].results, done, len(pkgs))
+				}
+				mu.Unlock()
+			}()
+		}
+		wg.Wait()
+	}()
+
+	var pending []string
+	select {
+	case <-finished:
+	case <-ctx.Done():
+		// Record the packages that were still being analyzed, then wait
+		// for them so that none outlives the call
+		mu.Lock()
+		for id := range inFlight {
+			pending = append(pending, id)
+		}
+		mu.Unlock()
+		sort.Strings(pending)
+		<-finished
+	}
+	if err := ctx.Err(); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, deadlineError(ctx, timeout, pending, err)
+		}
+		return nil, fmt.Errorf("analysis did not finish: %w", err)
+	}
+
+	var results []*Result
+	for i, outcome := range outcomes {
+		if outcome.err != nil {
+			return nil, fmt.Errorf("analyzing %s: %w", pkgs[i].PkgPath, outcome.err)
+		}
+		results = append(results, outcome.results...)
+	}
+	if config.Dedupe {
+		dedupeResults(results)
+	}
+	return results, nil
+}
+
+// dedupeResults removes the repeats of an issue from the findings of results,
+// keeping the first in load order, like DedupeFindings
+func dedupeResults(results []*Result) {
+	seen := make(map[string]bool)
+	for _, result := range results {
+		result.Findings = slices.DeleteFunc(result.Findings, func(finding Finding) bool {
+			key := dedupeKey(finding)
+			if seen[key] {
+				return true
+			}
+			seen[key] = true
+			return false
+		})
+	}
+}
+
+// dirLoadMode loads just enough of the package of the analyzed file's
+// directory to name it and find its module
+const dirLoadMode = packages.NeedName | packages.NeedModule
+
+// AnalyzeFile runs the analyzer configured by config over a single file, with
+// its content given by src, such as an unsaved buffer of an editor. Only the
+// file's imports are loaded, like Analyze loads dependencies, and the file is
+// type-checked on its own instead of with its whole package: identifiers declared in the other files of
+// the package are left unresolved, and a TestMain declared in one of them
+// isn't seen. Result.MissingTestMain flags the latter, and the note that
+// goleak is imported but never used, which only the whole package can tell,
+// is left out.
+//
+// Positions are reported against filename, made absolute, which also locates
+// the package and its module.
+func AnalyzeFile(config *Config, filename string, src []byte) (*Result, error) {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	// Creating the analyzer also fills in the configuration defaults
+	analyzer := NewWithConfig(config)
+
+	if abs, err := filepath.Abs(filename); err == nil {
+		filename = abs
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, src, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.Timeout)
+	defer cancel()
+
+	// Load errors of the directory's package, e.g. when the file is its only
+	// one, don't prevent checking the file
+	load := &packages.Config{Context: ctx, Mode: dirLoadMode, Dir: filepath.Dir(filename)}
+	dirs, err := packages.Load(load, ".")
+	if err != nil {
+		return nil, loadFailure(ctx, config.Timeout, err)
+	}
+	path, goVersion := file.Name.Name, ""
+	if len(dirs) == 1 && dirs[0].PkgPath != "" {
+		path = dirs[0].PkgPath
+		if file.Name.Name == dirs[0].Name+"_test" {
+			path += "_test"
+		}
+		if module := dirs[0].Module; module != nil && module.GoVersion != "" {
+			goVersion = "go" + module.GoVersion
+		}
+	}
+
+	// The imports are resolved from the same directory, and must load
+	var patterns []string
+	for _, spec := range file.Imports {
+		if importPath, err := strconv.Unquote(spec.Path.Value); err == nil && importPath != "C" && importPath != "unsafe" {
+			patterns = append(patterns, importPath)
+		}
+	}
+	var pkgs []*packages.Package
+	if len(patterns) > 0 {
+		load.Mode = loadMode
+		if pkgs, err = packages.Load(load, patterns...); err != nil {
+			return nil, loadFailure(ctx, config.Timeout, err)
+		}
+		if err := loadErrors(pkgs); err != nil {
+			return nil, err
+		}
+	}
+
+	imports := make(map[string]*types.Package)
+	for _, pkg := range pkgs {
+		imports[pkg.PkgPath] = pkg.Types
+	}
+	checkConfig := &types.Config{
+		GoVersion: goVersion,
+		Importer: importerFunc(func(importPath string) (*types.Package, error) {
+			if importPath == "unsafe" {
+				return types.Unsafe, nil
+			}
+			if pkg := imports[importPath]; pkg != nil {
+				return pkg, nil
+			}
+			// Vendored packages are loaded under their vendor path in GOPATH mode
+			for loaded, pkg := range imports {
+				if strings.HasSuffix(loaded, "/vendor/"+importPath) || loaded == "vendor/"+importPath {
+					return pkg, nil
+				}
+			}
+			return nil, fmt.Errorf("package %s is not loaded", importPath)
+		}),
+		// Errors are expected from the identifiers of the package's other files
+		Error: func(error) {},
+		Sizes: types.SizesFor("gc", runtime.GOARCH),
+	}
+	info := &types.Info{
+		Types:        make(map[ast.Expr]types.TypeAndValue),
+		Defs:         make(map[*ast.Ident]types.Object),
+		Uses:         make(map[*ast.Ident]types.Object),
+		Implicits:    make(map[ast.Node]types.Object),
+		Instances:    make(map[*ast.Ident]types.Instance),
+		Scopes:       make(map[ast.Node]*types.Scope),
+		Selections:   make(map[*ast.SelectorExpr]*types.Selection),
+		FileVersions: make(map[*ast.File]string),
+	}
+	files := []*ast.File{file}
+	pkg, _ := checkConfig.Check(path, fset, files, info)
+
+	pass := &analysis.Pass{
+		Analyzer:   analyzer,
+		Fset:       fset,
+		Files:      files,
+		Pkg:        pkg,
+		TypesInfo:  info,
+		TypesSizes: checkConfig.Sizes,
+		ResultOf:   map[*analysis.Analyzer]interface{}{inspect.Analyzer: inspector.New(files)},
+		Report:     func(analysis.Diagnostic) {},
+	}
+	value, err := analyzer.Run(pass)
+	if err != nil {
+		return nil, err
+	}
+	// Another file of the package may verify with the goleak import
+	result := value.(*Result)
+	result.Findings = slices.DeleteFunc(result.Findings, func(finding Finding) bool {
+		return finding.Reason == ReasonImportUnused
+	})
+	result.MissingTestMain = !declaresTestMain(file)
+	return result, nil
+}
+
+// loadFailure reports a failure of packages.Load, which doesn't wrap the
+// context error when the go list run is cut short
+func loadFailure(ctx context.Context, timeout time.Duration, err error) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return deadlineError(ctx, timeout, nil, ctx.Err())
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("loading packages: %w", ctx.Err())
+	}
+	return err
+}
+
+// deadlineError returns the TimeoutError of err, the context error once ctx
+// passed its deadline, with the packages still being analyzed. A zero
+// timeout means ctx is the caller's, whose deadline is reported instead.
+func deadlineError(ctx context.Context, timeout time.Duration, pending []string, err error) *TimeoutError {
+	timeoutErr := &TimeoutError{Packages: pending, Timeout: timeout, Err: err}
+	if timeout == 0 {
+		timeoutErr.Deadline, _ = ctx.Deadline()
+	}
+	return timeoutErr
+}
+
+// importerFunc adapts a function to types.Importer
+type importerFunc func(path string) (*types.Package, error)
+
+// Import implements types.Importer
+func (f importerFunc) Import(path string) (*types.Package, error) {
+	return f(path)
+}
+
+// declaresTestMain checks if file declares the package's TestMain
+func declaresTestMain(file *ast.File) bool {
+	for _, decl := range file.Decls {
+		if fd, ok := decl.(*ast.FuncDecl); ok && fd.Recv == nil && fd.Name != nil && fd.Name.Name == testMainFunc {
+			return true
+		}
+	}
+	return false
+}
+
+// analyzePackage runs analyzer over a single package and returns its results
+func analyzePackage(analyzer *analysis.Analyzer, pkg *packages.Package) ([]*Result, error) {
+	// Parallelism is controlled by Analyze, so each graph runs sequentially
+	graph, err := checker.Analyze([]*analysis.Analyzer{analyzer}, []*packages.Package{pkg}, &checker.Options{Sequential: true})
+	if err != nil {
+		return nil, err
+	}
+
+	var results []*Result
+	for _, act := range graph.Roots {
+		if act.Err != nil {
+			return nil, act.Err
+		}
+		if result, ok := act.Result.(*Result); ok {
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
+
+// loadErrors joins the errors reported while loading pkgs and their dependencies
+func loadErrors(pkgs []*packages.Package) error {
+	var errs []error
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		for _, err := range pkg.Errors {
+			errs = append(errs, err)
+		}
+	})
+	return errors.Join(errs...)
+}
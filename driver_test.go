@@ -0,0 +1,529 @@
+package leakcheck_test
+
+import (
+	"context"
+	"errors"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rleungx/leakcheck"
+)
+
+// chdir changes the working directory for the duration of the test
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := os.Chdir(wd); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestAnalyze(t *testing.T) {
+	chdir(t, "testdata/src")
+
+	findings, err := leakcheck.Analyze(&leakcheck.Config{}, "./basic", "./no_import")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]leakcheck.Reason, len(findings))
+	for _, finding := range findings {
+		got[finding.TestFunc] = finding.Reason
+	}
+	want := map[string]leakcheck.Reason{
+		"TestWithoutGoleak":        leakcheck.ReasonMissingDefer,
+		"TestWithoutGoleakImport":  leakcheck.ReasonNoImport,
+		"TestAnotherWithoutImport": leakcheck.ReasonNoImport,
+	}
+	if len(findings) != len(want) {
+		t.Fatalf("expected %d findings, got %d: %v", len(want), len(findings), findings)
+	}
+	for name, reason := range want {
+		if got[name] != reason {
+			t.Errorf("finding for %s: got reason %v, want %v", name, got[name], reason)
+		}
+	}
+}
+
+func TestAnalyzePackagesTests(t *testing.T) {
+	chdir(t, "testdata/src")
+
+	config := &leakcheck.Config{ExcludeFiles: "exclude_test.go"}
+	results, err := leakcheck.AnalyzePackages(config, "./basic", "./main_with_verify", "./exclude_files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]leakcheck.Coverage)
+	for _, result := range results {
+		for _, test := range result.Tests {
+			got[test.TestFunc] = test.Coverage
+		}
+	}
+	want := map[string]leakcheck.Coverage{
+		"TestWithGoleak":        leakcheck.CoverageDefer,
+		"TestWithoutGoleak":     leakcheck.CoverageNone,
+		"TestWithVerify":        leakcheck.CoverageTestMain,
+		"TestAnotherWithVerify": leakcheck.CoverageTestMain,
+		"TestExcludeFile":       leakcheck.CoverageExcluded,
+		"TestNormalFile":        leakcheck.CoverageNone,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d tests, got %d: %v", len(want), len(got), got)
+	}
+	for name, coverage := range want {
+		if got[name] != coverage {
+			t.Errorf("status of %s: got %v, want %v", name, got[name], coverage)
+		}
+	}
+}
+
+func TestAnalyzeReplacedGoleak(t *testing.T) {
+	// goleak is replaced by a fork whose package is named leak, so the import
+	// is only recognized, and its name known, through type information
+	chdir(t, "testdata/replaced")
+
+	results, err := leakcheck.AnalyzePackages(&leakcheck.Config{}, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]leakcheck.Coverage)
+	for _, result := range results {
+		for _, test := range result.Tests {
+			got[test.TestFunc] = test.Coverage
+		}
+	}
+	want := map[string]leakcheck.Coverage{
+		"TestWithLeak":    leakcheck.CoverageDefer,
+		"TestWithoutLeak": leakcheck.CoverageNone,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got coverage %v, want %v", got, want)
+	}
+}
+
+func TestLimitFindings(t *testing.T) {
+	chdir(t, "testdata/src")
+
+	findings, err := leakcheck.Analyze(&leakcheck.Config{}, "./basic", "./no_import")
+	if err != nil {
+		t.Fatal(err)
+	}
+	shown, omitted := leakcheck.LimitFindings(findings, 2)
+	if len(shown) != 2 || omitted != len(findings)-2 {
+		t.Fatalf("got %d findings shown and %d omitted out of %d", len(shown), omitted, len(findings))
+	}
+	// The cap keeps the findings in package load order, across packages
+	if !reflect.DeepEqual(shown, findings[:2]) {
+		t.Errorf("unexpected findings shown: %v", shown)
+	}
+
+	if shown, omitted := leakcheck.LimitFindings(findings, 0); len(shown) != len(findings) || omitted != 0 {
+		t.Errorf("zero should not limit the findings, got %d shown and %d omitted", len(shown), omitted)
+	}
+}
+
+func TestUnusedExcludes(t *testing.T) {
+	chdir(t, "testdata/src")
+
+	config := &leakcheck.Config{
+		// Every pattern is checked, even after an earlier one matched
+		ExcludePackages:    "basic, no_such_package, basic",
+		ExcludeDirs:        []string{"no_import", "nodir"},
+		ExcludeFiles:       `basic_test.go,_test\.go$,typo_test.go`,
+		ExcludeFunctions:   "TestWithGoleak,TestTypo",
+		WarnUnusedExcludes: true,
+	}
+	results, err := leakcheck.AnalyzePackages(config, "./basic", "./no_import")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []leakcheck.ExcludePattern{
+		{Option: "exclude-packages", Pattern: "no_such_package"},
+		{Option: "exclude-dirs", Pattern: "nodir"},
+		{Option: "exclude-files", Pattern: "typo_test.go"},
+		{Option: "exclude-functions", Pattern: "TestTypo"},
+	}
+	if got := leakcheck.UnusedExcludes(config, results); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestExcluded(t *testing.T) {
+	chdir(t, "testdata/src")
+
+	config := &leakcheck.Config{
+		ExcludePackages: "xtest_main_external",
+		ExcludeFiles:    "exclude_test.go",
+		SkipGenerated:   true,
+	}
+	results, err := leakcheck.AnalyzePackages(config, "./xtest_main_external", "./exclude_files", "./generated", "./basic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	packages, files := leakcheck.Excluded(results)
+	// The package is analyzed with its internal and external tests, but counts once
+	if want := []string{"src/xtest_main_external"}; !reflect.DeepEqual(packages, want) {
+		t.Errorf("got packages %v, want %v", packages, want)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		filepath.Join(wd, "exclude_files", "exclude_test.go"),
+		filepath.Join(wd, "generated", "generated_test.go"),
+	}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("got files %v, want %v", files, want)
+	}
+}
+
+func TestAnalyzeLoadError(t *testing.T) {
+	chdir(t, "testdata/src")
+
+	if _, err := leakcheck.Analyze(&leakcheck.Config{}, "./does_not_exist"); err == nil {
+		t.Fatal("expected an error for a missing package")
+	}
+}
+
+func TestAnalyzeBadPattern(t *testing.T) {
+	chdir(t, "testdata/src")
+
+	_, err := leakcheck.Analyze(&leakcheck.Config{ExcludePackages: "(basic"}, "./basic")
+	if err == nil || !strings.Contains(err.Error(), "exclude-packages: error parsing regexp") {
+		t.Fatalf("expected an error for the bad pattern, got %v", err)
+	}
+
+	// Ignored, the bad pattern excludes nothing
+	findings, err := leakcheck.Analyze(&leakcheck.Config{ExcludePackages: "(basic", IgnoreBadPatterns: true}, "./basic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 1 || findings[0].TestFunc != "TestWithoutGoleak" {
+		t.Errorf("unexpected findings %v", findings)
+	}
+}
+
+func TestAnalyzeConcurrency(t *testing.T) {
+	chdir(t, "testdata/src")
+
+	patterns := []string{"./basic", "./no_import", "./multiple_files", "./main_without_verify", "./alias"}
+	sequential, err := leakcheck.Analyze(&leakcheck.Config{Concurrency: 1}, patterns...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	concurrent, err := leakcheck.Analyze(&leakcheck.Config{Concurrency: 4}, patterns...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(sequential, concurrent) {
+		t.Fatalf("concurrent findings differ from sequential ones:\n%v\n%v", concurrent, sequential)
+	}
+}
+
+func TestAnalyzeTimeout(t *testing.T) {
+	chdir(t, "testdata/src")
+
+	_, err := leakcheck.Analyze(&leakcheck.Config{Timeout: time.Nanosecond}, "./basic")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	var timeoutErr *leakcheck.TimeoutError
+	if !errors.As(err, &timeoutErr) {
+		t.Fatalf("expected a timeout error, got %T", err)
+	}
+	if timeoutErr.Timeout != time.Nanosecond {
+		t.Errorf("unexpected timeout %v", timeoutErr.Timeout)
+	}
+	if !strings.Contains(err.Error(), "raise -timeout") {
+		t.Errorf("expected a hint in %q", err.Error())
+	}
+}
+
+func TestAnalyzeContextProgress(t *testing.T) {
+	chdir(t, "testdata/src")
+
+	// Each pattern loads the package, its test variant and the test binary
+	var calls, want []int
+	progress := func(pkgPath string, done, total int) {
+		if total != 6 {
+			t.Errorf("unexpected total %d for %s", total, pkgPath)
+		}
+		calls = append(calls, done)
+	}
+	if _, err := leakcheck.AnalyzeContext(context.Background(), &leakcheck.Config{}, progress, "./basic", "./no_import"); err != nil {
+		t.Fatal(err)
+	}
+	for done := 1; done <= 6; done++ {
+		want = append(want, done)
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("unexpected progress %v", calls)
+	}
+}
+
+func TestAnalyzeContextCanceled(t *testing.T) {
+	chdir(t, "testdata/src")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := leakcheck.AnalyzeContext(ctx, &leakcheck.Config{}, nil, "./basic")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected canceled, got %v", err)
+	}
+}
+
+func TestAnalyzeContextCanceledMidway(t *testing.T) {
+	chdir(t, "testdata/src")
+
+	// Cancel once the first of the six packages is analyzed, one at a time
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	calls, returned := 0, false
+	progress := func(pkgPath string, done, total int) {
+		if returned {
+			t.Errorf("progress called for %s after AnalyzeContext returned", pkgPath)
+		}
+		calls++
+		cancel()
+	}
+	_, err := leakcheck.AnalyzeContext(ctx, &leakcheck.Config{Concurrency: 1}, progress, "./basic", "./no_import")
+	returned = true
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected canceled, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("expected no package started after cancelling, got %d progress calls", calls)
+	}
+}
+
+// expiringContext is a context whose deadline passes when it is cancelled
+type expiringContext struct {
+	context.Context
+	deadline time.Time
+}
+
+func (c expiringContext) Deadline() (time.Time, bool) {
+	return c.deadline, true
+}
+
+func (c expiringContext) Err() error {
+	if c.Context.Err() != nil {
+		return context.DeadlineExceeded
+	}
+	return nil
+}
+
+func TestAnalyzeContextDeadline(t *testing.T) {
+	chdir(t, "testdata/src")
+
+	parent, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx := expiringContext{Context: parent, deadline: time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)}
+	progress := func(string, int, int) { cancel() }
+	_, err := leakcheck.AnalyzeContext(ctx, &leakcheck.Config{Concurrency: 1}, progress, "./basic")
+
+	var timeoutErr *leakcheck.TimeoutError
+	if !errors.As(err, &timeoutErr) {
+		t.Fatalf("expected a timeout error, got %v", err)
+	}
+	// The caller's deadline applies, not the configured timeout
+	if timeoutErr.Timeout != 0 || !timeoutErr.Deadline.Equal(ctx.deadline) {
+		t.Errorf("got timeout %v and deadline %v, want the context deadline %v", timeoutErr.Timeout, timeoutErr.Deadline, ctx.deadline)
+	}
+	if msg := err.Error(); !strings.Contains(msg, "context deadline 2030-01-02T03:04:05Z") || strings.Contains(msg, "raise -timeout") {
+		t.Errorf("unexpected message %q", msg)
+	}
+}
+
+func TestAnalyzeModuleGoVersion(t *testing.T) {
+	// the module's go directive predates t.Cleanup, so it doesn't cover tests
+	chdir(t, "testdata/go113")
+
+	results, err := leakcheck.AnalyzePackages(&leakcheck.Config{}, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]leakcheck.Coverage)
+	for _, result := range results {
+		for _, test := range result.Tests {
+			got[test.TestFunc] = test.Coverage
+		}
+	}
+	want := map[string]leakcheck.Coverage{
+		"TestWithCleanup": leakcheck.CoverageNone,
+		"TestWithDefer":   leakcheck.CoverageDefer,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got coverage %v, want %v", got, want)
+	}
+}
+
+func TestAnalyzeFile(t *testing.T) {
+	chdir(t, "testdata/src")
+
+	for _, tt := range []struct {
+		filename        string
+		findings        []string
+		missingTestMain bool
+	}{
+		{filepath.Join("basic", "basic_test.go"), []string{"TestWithoutGoleak"}, true},
+		// The TestMain covering the tests is in main_test.go, which isn't seen
+		{filepath.Join("multiple_files_with_main", "file1_test.go"), []string{"TestFileOneWithMain", "TestAnotherInFileOne"}, true},
+		{filepath.Join("multiple_files_with_main", "main_test.go"), nil, false},
+	} {
+		src, err := os.ReadFile(tt.filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := leakcheck.AnalyzeFile(&leakcheck.Config{}, tt.filename, src)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.filename, err)
+		}
+		var got []string
+		for _, finding := range result.Findings {
+			got = append(got, finding.TestFunc)
+			if filepath.Base(finding.Position.Filename) != filepath.Base(tt.filename) || !filepath.IsAbs(finding.Position.Filename) {
+				t.Errorf("%s: finding at %s", tt.filename, finding.Position)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.findings) || result.MissingTestMain != tt.missingTestMain {
+			t.Errorf("%s: got findings %v and MissingTestMain %v, want %v and %v", tt.filename, got, result.MissingTestMain, tt.findings, tt.missingTestMain)
+		}
+	}
+}
+
+func TestAnalyzeManifest(t *testing.T) {
+	chdir(t, "testdata/src")
+
+	for _, tt := range []struct {
+		name     string
+		manifest string
+		exclude  string
+		want     []string
+	}{
+		{"import path", "# leak-sensitive packages\nsrc/basic\n", "", []string{"TestWithoutGoleak"}},
+		{"pattern", "src/...\n", "", []string{"TestWithoutGoleak", "TestWithoutGoleakImport", "TestAnotherWithoutImport"}},
+		{"glob", "src/no_*\n", "", []string{"TestWithoutGoleakImport", "TestAnotherWithoutImport"}},
+		{"glob within an element", "*/basic\nsrc\n", "", []string{"TestWithoutGoleak"}},
+		{"exclude wins", "src/...\n", "no_import", []string{"TestWithoutGoleak"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			manifest := filepath.Join(t.TempDir(), "manifest.txt")
+			if err := os.WriteFile(manifest, []byte(tt.manifest), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			findings, err := leakcheck.Analyze(&leakcheck.Config{ManifestFile: manifest, ExcludePackages: tt.exclude}, "./basic", "./no_import")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, finding := range findings {
+				got = append(got, finding.TestFunc)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got findings %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	_, err := leakcheck.Analyze(&leakcheck.Config{ManifestFile: "no-such-manifest.txt"}, "./basic")
+	if err == nil || !strings.Contains(err.Error(), "manifest-file: open no-such-manifest.txt") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestAnalyzeVendored(t *testing.T) {
+	chdir(t, "testdata/src")
+
+	for _, tt := range []struct {
+		name          string
+		includeVendor bool
+		want          []string
+	}{
+		{"skipped by default", false, nil},
+		{"included", true, []string{"TestOwned"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			findings, err := leakcheck.Analyze(&leakcheck.Config{IncludeVendor: tt.includeVendor}, "./vendored/vendor/example.com/owned")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, finding := range findings {
+				got = append(got, finding.TestFunc)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got findings %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDedupeFindings(t *testing.T) {
+	chdir(t, "testdata/src")
+
+	// Each test package of the directory reports that goleak isn't imported
+	findings, err := leakcheck.Analyze(&leakcheck.Config{GroupNoImport: true}, "./xtest_no_import")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 2 {
+		t.Fatalf("got %d findings, want one per test package: %v", len(findings), findings)
+	}
+	if got := leakcheck.DedupeFindings(findings); !reflect.DeepEqual(got, findings[:1]) {
+		t.Errorf("got %v, want the first finding only", got)
+	}
+
+	// The driver dedupes by itself with Config.Dedupe
+	deduped, err := leakcheck.Analyze(&leakcheck.Config{GroupNoImport: true, Dedupe: true}, "./xtest_no_import")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(deduped, findings[:1]) {
+		t.Errorf("got %v with Dedupe, want the first finding only", deduped)
+	}
+
+	// Findings about different tests are distinct
+	findings, err = leakcheck.Analyze(nil, "./xtest_no_import")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := leakcheck.DedupeFindings(findings); !reflect.DeepEqual(got, findings) {
+		t.Errorf("got %v, want %v", got, findings)
+	}
+
+	// So are findings of the same reason at different positions of a test
+	option := leakcheck.Finding{Package: "example.com/pkg", TestFunc: "TestOptions", Reason: leakcheck.ReasonInvalidOption, Position: token.Position{Filename: "pkg_test.go", Line: 10}}
+	other := option
+	other.Position.Line = 12
+	if got := leakcheck.DedupeFindings([]leakcheck.Finding{option, other, option}); !reflect.DeepEqual(got, []leakcheck.Finding{option, other}) {
+		t.Errorf("got %v, want both positions once", got)
+	}
+}
+
+func TestCountCovered(t *testing.T) {
+	chdir(t, "testdata/src")
+
+	results, err := leakcheck.AnalyzePackages(&leakcheck.Config{ExcludeFunctions: "TestAnotherWithoutImport"}, "./basic", "./no_import", "./multiple_files_with_main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// One test covered by a defer, four by TestMain; the excluded test counts in neither
+	covered, total := leakcheck.CountCovered(results)
+	if covered != 5 || total != 7 {
+		t.Errorf("got %d/%d covered, want 5/7", covered, total)
+	}
+}
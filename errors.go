@@ -0,0 +1,58 @@
+package leakcheck
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// TimeoutError reports that the analysis ran out of time, with what was in
+// progress at that moment. It unwraps to the context error, usually
+// context.DeadlineExceeded.
+type TimeoutError struct {
+	Packages []string      // packages being analyzed, empty while loading packages
+	File     string        // file the timeout was noticed at, when known
+	Timeout  time.Duration // the configured timeout, zero when the caller's context set the deadline
+	Deadline time.Time     // the deadline of the caller's context, when Timeout is zero
+	Err      error
+}
+
+func (e *TimeoutError) Error() string {
+	var b strings.Builder
+	if e.Timeout == 0 && !e.Deadline.IsZero() {
+		fmt.Fprintf(&b, "analysis passed the context deadline %s", e.Deadline.Format(time.RFC3339))
+	} else {
+		fmt.Fprintf(&b, "analysis timed out after %v", e.Timeout)
+	}
+	switch {
+	case e.File != "":
+		fmt.Fprintf(&b, " in %s", e.File)
+	case len(e.Packages) > 0:
+		fmt.Fprintf(&b, " while analyzing %s", strings.Join(e.Packages, ", "))
+	default:
+		b.WriteString(" while loading packages")
+	}
+	fmt.Fprintf(&b, ": %v", e.Err)
+	// Only the configured timeout can be raised
+	if e.Timeout > 0 {
+		b.WriteString(" (raise -timeout or lower -concurrency)")
+	}
+	return b.String()
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// timeoutError wraps err, the context error of the analysis of pass, with the
+// package and, if not empty, the file in progress
+func timeoutError(pass *analysis.Pass, config *Config, filename string, err error) error {
+	return &TimeoutError{
+		Packages: []string{pass.Pkg.Path()},
+		File:     filename,
+		Timeout:  config.Timeout,
+		Err:      err,
+	}
+}
@@ -0,0 +1,9 @@
+package leakcheck
+
+// Exported for testing
+var (
+	ShouldExcludeFile    = shouldExcludeFileWithConfig
+	ShouldExcludePackage = shouldExcludePackage
+	ImportEdit           = importEdit
+	BuildConstraint      = buildConstraint
+)
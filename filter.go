@@ -0,0 +1,448 @@
+package leakcheck
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build/constraint"
+	"go/token"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// Comment directives that suppress findings
+const (
+	nolintDirective        = "nolint"
+	ignoreDirective        = "leakcheck:ignore"
+	packageIgnoreDirective = "leakcheck:package-ignore"
+	skipMarker             = "leakcheck:skip"
+	analyzerName           = "leakcheck"
+)
+
+// requireDeferDirective marks a test that must verify itself even when
+// TestMain covers its package
+const requireDeferDirective = "leakcheck:require-defer"
+
+// Options declaring exclude patterns, as named in ExcludePattern.Option
+const (
+	optionExcludePackages  = "exclude-packages"
+	optionExcludeDirs      = "exclude-dirs"
+	optionExcludeFiles     = "exclude-files"
+	optionExcludeFunctions = "exclude-functions"
+)
+
+// packageIgnoreFile is the sentinel file whose presence in a package's
+// directory marks the whole package as acknowledged
+const packageIgnoreFile = "leakcheck_ok.go"
+
+// reportFilter decides which findings of a package are reported, applying
+// every suppression source in one place: excluded files, generated files,
+// files with excluded build tags, excluded test function names and comment
+// directives
+type reportFilter struct {
+	fset   *token.FileSet
+	config *Config
+	// suppressed holds, per file, the lines covered by a directive
+	suppressed map[string]map[int]bool
+	// skipped holds the test files skipped as a whole, either generated ones
+	// with SkipGenerated or ones constrained by one of ExcludeBuildTags, with
+	// the reason
+	skipped map[string]string
+	// skippedFuncs holds the functions whose doc comment has a skip marker
+	skippedFuncs []ast.Node
+}
+
+// newReportFilter collects the suppression directives of the package's files
+func newReportFilter(pass *analysis.Pass, config *Config) *reportFilter {
+	filter := &reportFilter{
+		fset:       pass.Fset,
+		config:     config,
+		suppressed: make(map[string]map[int]bool),
+		skipped:    make(map[string]string),
+	}
+	for _, file := range pass.Files {
+		filename := pass.Fset.Position(file.Pos()).Filename
+		if reason := skipReason(file, config); reason != "" && isTestFile(filename) {
+			filter.skipped[filename] = reason
+		}
+		code := codeLines(pass.Fset, file)
+		for _, group := range file.Comments {
+			filter.collectDirectives(group, code)
+		}
+		for _, decl := range file.Decls {
+			if fd, ok := decl.(*ast.FuncDecl); ok && hasSkipMarker(fd.Doc) {
+				filter.skippedFuncs = append(filter.skippedFuncs, fd)
+			}
+		}
+	}
+	return filter
+}
+
+// isSkippedFile checks if file is skipped as a whole, being generated with
+// SkipGenerated or constrained by one of ExcludeBuildTags
+func isSkippedFile(file *ast.File, config *Config) bool {
+	return skipReason(file, config) != ""
+}
+
+// skipReason explains why file is skipped as a whole, or returns "" if it
+// isn't
+func skipReason(file *ast.File, config *Config) string {
+	switch {
+	case config.SkipGenerated && ast.IsGenerated(file):
+		return "the file is generated"
+	case hasBuildTag(file, config.ExcludeBuildTags):
+		return "the file's build constraint mentions one of exclude-build-tags"
+	}
+	return ""
+}
+
+// excludedTestFiles returns the test files of the package excluded by
+// configuration, by directory, name, generated header or build tag
+func excludedTestFiles(pass *analysis.Pass, config *Config) []string {
+	var excluded []string
+	for _, file := range pass.Files {
+		filename := pass.Fset.Position(file.Pos()).Filename
+		if isTestFile(filename) && (shouldExcludeFileWithConfig(filename, config) || isSkippedFile(file, config)) {
+			excluded = append(excluded, filename)
+		}
+	}
+	return excluded
+}
+
+// hasSkipMarker checks if a line of the doc comment doc starts with the skip
+// marker, as in // leakcheck:skip starts a helper process. Unlike a directive
+// it may follow a space, so that it reads as part of the documentation.
+func hasSkipMarker(doc *ast.CommentGroup) bool {
+	if doc == nil {
+		return false
+	}
+	for _, comment := range doc.List {
+		text, ok := strings.CutPrefix(comment.Text, "//")
+		if !ok {
+			continue
+		}
+		rest, ok := strings.CutPrefix(strings.TrimSpace(text), skipMarker)
+		if ok && (rest == "" || strings.HasPrefix(rest, " ")) {
+			return true
+		}
+	}
+	return false
+}
+
+// collectDirectives marks the lines suppressed by the directives in group: the
+// line of the directive itself, for trailing comments, and the line after the
+// comment group, for directives alone on their lines such as in a doc comment.
+// code holds the lines of the file with code on them.
+func (f *reportFilter) collectDirectives(group *ast.CommentGroup, code map[int]bool) {
+	start, end := f.fset.Position(group.Pos()).Line, f.fset.Position(group.End()).Line
+	alone := !code[start] && !code[end]
+	for _, comment := range group.List {
+		if !isSuppressDirective(comment.Text) {
+			continue
+		}
+		pos := f.fset.Position(comment.Pos())
+		lines := f.suppressed[pos.Filename]
+		if lines == nil {
+			lines = make(map[int]bool)
+			f.suppressed[pos.Filename] = lines
+		}
+		lines[pos.Line] = true
+		if alone {
+			lines[end+1] = true
+		}
+	}
+}
+
+// codeLines returns the lines of file on which a node other than a comment
+// starts or ends
+func codeLines(fset *token.FileSet, file *ast.File) map[int]bool {
+	lines := make(map[int]bool)
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case nil, *ast.File:
+			return true
+		case *ast.CommentGroup, *ast.Comment:
+			return false
+		case *ast.Ident:
+			// Partial parses, e.g. of an editor buffer, may leave a declaration unnamed
+			if n == nil {
+				return false
+			}
+		}
+		lines[fset.Position(n.Pos()).Line] = true
+		lines[fset.Position(n.End()).Line] = true
+		return true
+	})
+	return lines
+}
+
+// isPackageIgnored checks if the package is acknowledged as a whole, either by
+// a //leakcheck:package-ignore comment in any of its files or by a
+// leakcheck_ok.go file in its directory. The file is looked up on disk, so
+// that it also covers the external test package and may be excluded from the
+// build; the directive only applies to the package whose files contain it.
+func isPackageIgnored(pass *analysis.Pass) bool {
+	dirs := make(map[string]bool)
+	for _, file := range pass.Files {
+		for _, group := range file.Comments {
+			for _, comment := range group.List {
+				if isPackageIgnoreDirective(comment.Text) {
+					return true
+				}
+			}
+		}
+		if tf := pass.Fset.File(file.Pos()); tf != nil {
+			dirs[filepath.Dir(tf.Name())] = true
+		}
+	}
+	for dir := range dirs {
+		if _, err := os.Stat(filepath.Join(dir, packageIgnoreFile)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// hasTestFilesOnDisk checks if the directory of one of the package's files
+// contains a _test.go file, whatever its build constraints. A directory that
+// can't be read is assumed to have some.
+func hasTestFilesOnDisk(pass *analysis.Pass) bool {
+	dirs := make(map[string]bool)
+	for _, file := range pass.Files {
+		if tf := pass.Fset.File(file.Pos()); tf != nil {
+			dirs[filepath.Dir(tf.Name())] = true
+		}
+	}
+	for dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return true
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() && isTestFile(entry.Name()) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// requiresDefer checks if the doc comment of a test function carries a
+// //leakcheck:require-defer directive, optionally followed by a reason
+func requiresDefer(doc *ast.CommentGroup) bool {
+	if doc == nil {
+		return false
+	}
+	for _, comment := range doc.List {
+		rest, ok := strings.CutPrefix(comment.Text, "//"+requireDeferDirective)
+		if ok && (rest == "" || strings.HasPrefix(rest, " ")) {
+			return true
+		}
+	}
+	return false
+}
+
+// isPackageIgnoreDirective checks if a comment is //leakcheck:package-ignore,
+// optionally followed by a reason
+func isPackageIgnoreDirective(text string) bool {
+	rest, ok := strings.CutPrefix(strings.TrimPrefix(text, "//"), packageIgnoreDirective)
+	return ok && (rest == "" || strings.HasPrefix(rest, " "))
+}
+
+// hasBuildTag checks if the build constraint of file, its //go:build line,
+// mentions one of tags other than negated
+func hasBuildTag(file *ast.File, tags []string) bool {
+	if len(tags) == 0 {
+		return false
+	}
+	expr := buildConstraint(file)
+	if expr == nil {
+		return false
+	}
+	for _, tag := range tags {
+		if mentionsTag(expr, tag, false) {
+			return true
+		}
+	}
+	return false
+}
+
+// constraintCache caches parsed build constraints by the text of their
+// //go:build line, so that analyzing files again, e.g. in watch mode, doesn't
+// parse them again. Unlike a key of file name and modification time, the
+// text needs no stat, which costs more than the parsing, and can't go stale.
+var constraintCache boundedCache[constraint.Expr]
+
+// buildConstraint returns the build constraint of file, nil if it has no
+// //go:build line or the line doesn't parse
+func buildConstraint(file *ast.File) constraint.Expr {
+	for _, group := range file.Comments {
+		// Build constraints must appear before the package clause
+		if group.Pos() >= file.Package {
+			break
+		}
+		for _, comment := range group.List {
+			if constraint.IsGoBuild(comment.Text) {
+				return parseBuildConstraint(comment.Text)
+			}
+		}
+	}
+	return nil
+}
+
+// parseBuildConstraint parses a //go:build line with caching, returning nil
+// if it doesn't parse
+func parseBuildConstraint(line string) constraint.Expr {
+	if expr, ok := constraintCache.get(line); ok {
+		return expr
+	}
+
+	expr, err := constraint.Parse(line)
+	if err != nil {
+		expr = nil
+	}
+	constraintCache.put(line, expr)
+	return expr
+}
+
+// mentionsTag checks if tag appears in expr under an even number of
+// negations, or an odd one if negated is set. A negated tag, as in
+// //go:build !integration, marks the files built without it, such as the
+// unit tests, which must not be excluded along with the tagged ones. Unlike
+// Expr.Eval, it doesn't short-circuit && and ||.
+func mentionsTag(expr constraint.Expr, tag string, negated bool) bool {
+	switch e := expr.(type) {
+	case *constraint.TagExpr:
+		return e.Tag == tag && !negated
+	case *constraint.NotExpr:
+		return mentionsTag(e.X, tag, !negated)
+	case *constraint.AndExpr:
+		return mentionsTag(e.X, tag, negated) || mentionsTag(e.Y, tag, negated)
+	case *constraint.OrExpr:
+		return mentionsTag(e.X, tag, negated) || mentionsTag(e.Y, tag, negated)
+	}
+	return false
+}
+
+// isSuppressDirective checks if a comment is //leakcheck:ignore or a nolint
+// directive that applies to leakcheck, e.g. //nolint or //nolint:leakcheck,errcheck
+func isSuppressDirective(text string) bool {
+	text = strings.TrimPrefix(text, "//")
+	if strings.HasPrefix(text, ignoreDirective) {
+		return true
+	}
+	if !strings.HasPrefix(text, nolintDirective) {
+		return false
+	}
+	rest := strings.TrimPrefix(text, nolintDirective)
+	if rest == "" || strings.HasPrefix(rest, " ") {
+		// A bare nolint suppresses every linter
+		return true
+	}
+	if !strings.HasPrefix(rest, ":") {
+		return false
+	}
+	linters, _, _ := strings.Cut(rest[1:], " ")
+	for _, linter := range strings.Split(linters, ",") {
+		if linter == analyzerName || linter == "all" {
+			return true
+		}
+	}
+	return false
+}
+
+// shouldReport checks if a finding about testFunc may be reported. Findings
+// that aren't about a particular test leave the name empty.
+func (f *reportFilter) shouldReport(testFunc testFuncInfo) bool {
+	return f.exclusion(testFunc) == ""
+}
+
+// exclusion explains why findings about testFunc aren't reported, or returns
+// "" if they are
+func (f *reportFilter) exclusion(testFunc testFuncInfo) string {
+	if reason := f.skipped[testFunc.filename]; reason != "" {
+		return reason
+	}
+	if shouldExcludeTest(testFunc.name, testFunc.filename, f.config) {
+		return testExclusion(testFunc.name, testFunc.filename, f.config)
+	}
+	if testFunc.pos.IsValid() {
+		pos := f.fset.Position(testFunc.pos)
+		if f.suppressed[pos.Filename][pos.Line] {
+			return fmt.Sprintf("suppressed by a //%s or //%s directive", nolintDirective, ignoreDirective)
+		}
+		// Covers every finding inside a function skipped by its doc comment
+		for _, fd := range f.skippedFuncs {
+			if fd.Pos() <= testFunc.pos && testFunc.pos < fd.End() {
+				return fmt.Sprintf("its doc comment has a %s marker", skipMarker)
+			}
+		}
+	}
+	return ""
+}
+
+// configuredExcludes returns every pattern of the top-level exclude options
+func configuredExcludes(config *Config) []ExcludePattern {
+	var patterns []ExcludePattern
+	add := func(option string, values []string) {
+		for _, value := range values {
+			exclude := ExcludePattern{Option: option, Pattern: strings.TrimSpace(value)}
+			if exclude.Pattern != "" && !slices.Contains(patterns, exclude) {
+				patterns = append(patterns, exclude)
+			}
+		}
+	}
+	add(optionExcludePackages, strings.Split(config.ExcludePackages, ","))
+	add(optionExcludeDirs, config.ExcludeDirs)
+	add(optionExcludeFiles, strings.Split(config.ExcludeFiles, ","))
+	add(optionExcludeFunctions, strings.Split(config.ExcludeFunctions, ","))
+	return patterns
+}
+
+// matchedExcludes returns the patterns of configuredExcludes matching the
+// package, one of its test files or one of its test functions. Each pattern
+// is checked on its own, with the same rules as the exclusions themselves.
+func matchedExcludes(pass *analysis.Pass, config *Config) []ExcludePattern {
+	var filenames, testFuncs []string
+	for _, file := range pass.Files {
+		filename := pass.Fset.Position(file.Pos()).Filename
+		if !isTestFile(filename) {
+			continue
+		}
+		filenames = append(filenames, filename)
+		for _, decl := range file.Decls {
+			if fd, ok := decl.(*ast.FuncDecl); ok && fd.Name != nil && isTestFunc(pass.TypesInfo, fd, config.TestPrefixes) {
+				testFuncs = append(testFuncs, fd.Name.Name)
+			}
+		}
+	}
+
+	var matched []ExcludePattern
+	for _, exclude := range configuredExcludes(config) {
+		pattern := exclude.Pattern
+		var match func(string) bool
+		names := filenames
+		switch exclude.Option {
+		case optionExcludePackages:
+			single := &Config{ExcludePackages: pattern, AnchorPackagePatterns: config.AnchorPackagePatterns}
+			match = func(pkgPath string) bool { return shouldExcludePackage(pkgPath, single) }
+			names = []string{pass.Pkg.Path()}
+		case optionExcludeDirs:
+			match = func(filename string) bool { return isInExcludedDir(filename, []string{pattern}) }
+		case optionExcludeFiles:
+			match = func(filename string) bool {
+				return matchesPattern(filename, pattern) || matchesPattern(baseName(filename), pattern)
+			}
+		case optionExcludeFunctions:
+			match = func(testFunc string) bool { return matchesPattern(testFunc, pattern) }
+			names = testFuncs
+		}
+		if slices.ContainsFunc(names, match) {
+			matched = append(matched, exclude)
+		}
+	}
+	return matched
+}
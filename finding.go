@@ -0,0 +1,387 @@
+package leakcheck
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"go/token"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// Result is the value returned by the analyzer for each package. Other
+// analyzers and custom drivers can access it via pass.ResultOf[Analyzer].
+type Result struct {
+	Package  string       // import path of the analyzed package
+	Findings []Finding    // reported problems, in report order
+	Tests    []TestStatus // coverage status of every test function in the package
+	Stats    Stats        // cost of analyzing the package
+
+	// MatchedExcludes lists the exclude patterns matching the package, its
+	// test files or its test functions, only recorded with
+	// Config.WarnUnusedExcludes
+	MatchedExcludes []ExcludePattern
+
+	// Excluded is set when the package has test files but is excluded by
+	// Config.ExcludePackages as a whole, or not listed by Config.ManifestFile
+	Excluded bool
+	// ExcludedFiles lists the test files skipped by configuration: excluded
+	// directories and files, generated files with Config.SkipGenerated and
+	// files constrained by Config.ExcludeBuildTags. Files of an excluded
+	// package are not listed.
+	ExcludedFiles []string
+
+	// MissingTestMain is set by AnalyzeFile when the analyzed file declares
+	// no TestMain: one in another file of the package, which single-file
+	// analysis doesn't see, may still cover the tests reported as uncovered
+	MissingTestMain bool
+
+	// diagnostics holds the diagnostic of each finding until they are
+	// reported, sorted, at the end of the pass
+	diagnostics []analysis.Diagnostic
+}
+
+// ExcludePattern is a single pattern of an exclude option
+type ExcludePattern struct {
+	Option  string // the option declaring the pattern, e.g. "exclude-files"
+	Pattern string
+}
+
+// Stats records the work done analyzing a package, for performance tuning
+type Stats struct {
+	Files    int           // files in the package
+	Duration time.Duration // wall time spent in the analyzer
+}
+
+// TestStatus describes how a single test function is covered by goleak
+type TestStatus struct {
+	TestFunc string
+	Package  string
+	Position token.Position
+	Coverage Coverage
+	Detail   string // why the test has this coverage, e.g. where the covering defer is
+}
+
+// Coverage describes how a test function is covered by goleak
+type Coverage int
+
+// Coverage states of a test function
+const (
+	CoverageNone     Coverage = iota // the test is not covered
+	CoverageDefer                    // the test defers goleak.VerifyNone(t)
+	CoverageTestMain                 // TestMain calls goleak.VerifyTestMain
+	CoverageExcluded                 // the test is excluded by configuration
+)
+
+// String returns a stable identifier for the coverage state
+func (c Coverage) String() string {
+	switch c {
+	case CoverageNone:
+		return "uncovered"
+	case CoverageDefer:
+		return "covered-by-defer"
+	case CoverageTestMain:
+		return "covered-by-testmain"
+	case CoverageExcluded:
+		return "excluded"
+	default:
+		return "unknown"
+	}
+}
+
+// Finding describes a single problem with the goleak coverage of a package,
+// usually a test function that is not covered by goleak.
+//
+// Position is where the problem is. Findings about an uncovered test, such as
+// missing-defer, no-import, testmain-no-verify, require-defer, parallel-defer
+// and suite-no-teardown, are at the func keyword of the test, as are
+// example-no-testmain at the example's, subtest-missing-defer at the
+// subtest's function literal and suggest-testmain at the first test starting
+// goroutines. Findings about a call or statement, such as unreachable-defer,
+// defer-order, redundant-defer, conditional-coverage and the option and
+// TestMain checks, are at that call or statement, commented-out-verify at the
+// comment, the import notes at the goleak import, and no-tests and grouped
+// no-import findings at the package clause of a file.
+type Finding struct {
+	TestFunc string         // name of the test function concerned, empty for package-level findings
+	Package  string         // import path of the package containing the test
+	Position token.Position // position the finding concerns, see above
+	Reason   Reason         // machine-readable category of the finding
+	Severity Severity       // how serious the finding is, derived from Reason
+	Message  string         // human-readable diagnostic message
+
+	// Insertion is the position right after the opening brace of the test
+	// body, where a defer goleak.VerifyNone(t) should be inserted. It is only
+	// set for findings about a test function that has a body.
+	Insertion token.Position
+}
+
+// Fingerprint identifies the finding independently of its position, so that
+// it can be matched across runs after unrelated edits move the test around.
+// It is a hash of the package path, test function and reason: renaming the
+// test or moving it to another package changes it, and findings of the same
+// reason for the same test, or package-level ones of a package, share it.
+func (f Finding) Fingerprint() string {
+	sum := sha256.Sum256([]byte(f.Package + "\x00" + f.TestFunc + "\x00" + f.Reason.String()))
+	return hex.EncodeToString(sum[:16])
+}
+
+// Reason categorizes why a test function is reported
+type Reason int
+
+// Reasons reported by the analyzer
+const (
+	ReasonNoImport                  Reason = iota + 1 // goleak is not imported by the package
+	ReasonMissingDefer                                // the test has no defer goleak.VerifyNone(t)
+	ReasonTestMainNoVerify                            // TestMain exists but doesn't call goleak.VerifyTestMain
+	ReasonSubtestMissingDefer                         // a goroutine-spawning subtest has no defer goleak.VerifyNone(t)
+	ReasonParallelDefer                               // a parallel test relies on defer goleak.VerifyNone(t) only
+	ReasonSuggestTestMain                             // package-level advice to add TestMain with goleak.VerifyTestMain
+	ReasonExampleNoTestMain                           // a runnable example is not covered by goleak.VerifyTestMain
+	ReasonImportUnused                                // package-level note that goleak is imported but never used for verification
+	ReasonIgnoreCurrentLate                           // goleak.IgnoreCurrent() is evaluated when verification runs
+	ReasonUnknownIgnoredFunction                      // an Ignore*Function option names a function that doesn't exist
+	ReasonRedundantDefer                              // a per-test defer goleak.VerifyNone(t) duplicates goleak.VerifyTestMain coverage
+	ReasonSuiteNoTeardown                             // a suite test method's suite has no TearDownTest calling goleak.VerifyNone(s.T())
+	ReasonUnreachableDefer                            // a defer goleak.VerifyNone(t) follows an unconditional return, panic or t.Fatal
+	ReasonMissingIgnoredTopFunction                   // a goleak verification call doesn't ignore every Config.IgnoredTopFunctions entry
+	ReasonBlankImport                                 // package-level note that goleak is imported with a blank identifier
+	ReasonDeferOrder                                  // a defer goleak.VerifyNone(t) is registered after another defer, so it runs before that cleanup
+	ReasonCommentedOutVerify                          // advice that an uncovered test has its goleak verification commented out
+	ReasonTestMainExitCode                            // the exit code returned by the TestMain verification never reaches os.Exit
+	ReasonVerifyTestMainInTest                        // goleak.VerifyTestMain is called from a test function instead of TestMain
+	ReasonNoTests                                     // package-level note that a package has no test files, with Config.RequireTests
+	ReasonInvalidOption                               // a goleak option is unknown or not accepted by the verification function it is passed to
+	ReasonVerifyNoneInTestMain                        // TestMain calls goleak.VerifyNone instead of goleak.VerifyTestMain
+	ReasonRequireDefer                                // a test marked //leakcheck:require-defer lacks its own defer goleak.VerifyNone(t)
+	ReasonConditionalCoverage                         // a test is only verified by a defer or cleanup nested in an if, loop or closure, with Config.FlagConditionalCoverage
+	ReasonTestMainSetupGoroutine                      // TestMain starts a goroutine before its tests run, with Config.CheckTestMainSetup
+)
+
+// Severity ranks findings so that tools can filter or fail on the serious ones
+type Severity int
+
+// Severity levels, from least to most serious
+const (
+	SeverityLow    Severity = iota + 1 // advice, such as suggesting a TestMain
+	SeverityMedium                     // a single test or option is not covered properly
+	SeverityHigh                       // no test in the package can be covered as written
+)
+
+// String returns a stable identifier for the severity
+func (s Severity) String() string {
+	switch s {
+	case SeverityLow:
+		return "low"
+	case SeverityMedium:
+		return "medium"
+	case SeverityHigh:
+		return "high"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseSeverity returns the severity named by s, as returned by Severity.String
+func ParseSeverity(s string) (Severity, error) {
+	for _, severity := range []Severity{SeverityLow, SeverityMedium, SeverityHigh} {
+		if severity.String() == s {
+			return severity, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown severity %q, want low, medium or high", s)
+}
+
+// Severity returns the severity of findings with this reason. Findings that
+// leave a whole package uncovered are high, findings about a single test or
+// verification call are medium and advice is low.
+func (r Reason) Severity() Severity {
+	switch r {
+	case ReasonNoImport, ReasonTestMainNoVerify, ReasonNoTests:
+		return SeverityHigh
+	case ReasonSuggestTestMain, ReasonImportUnused, ReasonRedundantDefer, ReasonCommentedOutVerify, ReasonConditionalCoverage, ReasonTestMainSetupGoroutine:
+		return SeverityLow
+	default:
+		return SeverityMedium
+	}
+}
+
+// String returns a stable identifier for the reason, suitable for tooling
+func (r Reason) String() string {
+	switch r {
+	case ReasonNoImport:
+		return "no-import"
+	case ReasonMissingDefer:
+		return "missing-defer"
+	case ReasonTestMainNoVerify:
+		return "testmain-no-verify"
+	case ReasonSubtestMissingDefer:
+		return "subtest-missing-defer"
+	case ReasonParallelDefer:
+		return "parallel-defer"
+	case ReasonSuggestTestMain:
+		return "suggest-testmain"
+	case ReasonExampleNoTestMain:
+		return "example-no-testmain"
+	case ReasonImportUnused:
+		return "import-unused"
+	case ReasonIgnoreCurrentLate:
+		return "ignore-current-late"
+	case ReasonUnknownIgnoredFunction:
+		return "unknown-ignored-function"
+	case ReasonRedundantDefer:
+		return "redundant-defer"
+	case ReasonSuiteNoTeardown:
+		return "suite-no-teardown"
+	case ReasonUnreachableDefer:
+		return "unreachable-defer"
+	case ReasonMissingIgnoredTopFunction:
+		return "missing-ignored-top-function"
+	case ReasonBlankImport:
+		return "blank-import"
+	case ReasonDeferOrder:
+		return "defer-order"
+	case ReasonCommentedOutVerify:
+		return "commented-out-verify"
+	case ReasonTestMainExitCode:
+		return "testmain-exit-code"
+	case ReasonVerifyTestMainInTest:
+		return "verify-testmain-in-test"
+	case ReasonNoTests:
+		return "no-tests"
+	case ReasonInvalidOption:
+		return "invalid-option"
+	case ReasonVerifyNoneInTestMain:
+		return "verify-none-in-testmain"
+	case ReasonRequireDefer:
+		return "require-defer"
+	case ReasonConditionalCoverage:
+		return "conditional-coverage"
+	case ReasonTestMainSetupGoroutine:
+		return "testmain-setup-goroutine"
+	default:
+		return "unknown"
+	}
+}
+
+// description returns the human-readable explanation used in diagnostic messages
+func (r Reason) description() string {
+	switch r {
+	case ReasonNoImport:
+		return "goleak not imported"
+	case ReasonMissingDefer:
+		return "missing defer goleak.VerifyNone(t)"
+	case ReasonTestMainNoVerify:
+		return "TestMain exists but doesn't call goleak.VerifyTestMain"
+	case ReasonSubtestMissingDefer:
+		return "missing defer goleak.VerifyNone(t) in subtest"
+	case ReasonParallelDefer:
+		return "per-test goleak.VerifyNone(t) races with other parallel tests, use goleak.VerifyTestMain in TestMain"
+	case ReasonSuggestTestMain:
+		return "many tests start goroutines, consider goleak.VerifyTestMain in TestMain"
+	case ReasonExampleNoTestMain:
+		return "examples require TestMain with goleak.VerifyTestMain"
+	case ReasonImportUnused:
+		return "goleak is imported but never used for verification"
+	case ReasonIgnoreCurrentLate:
+		return "goleak.IgnoreCurrent() is evaluated when verification runs and hides leaked goroutines"
+	case ReasonUnknownIgnoredFunction:
+		return "ignored function does not exist"
+	case ReasonRedundantDefer:
+		return "TestMain already calls goleak.VerifyTestMain"
+	case ReasonSuiteNoTeardown:
+		return "missing goleak.VerifyNone(s.T()) in TearDownTest or TearDownSuite"
+	case ReasonUnreachableDefer:
+		return "it follows an unconditional return, panic or t.Fatal, so the test is not covered"
+	case ReasonMissingIgnoredTopFunction:
+		return "expected leaking function not ignored"
+	case ReasonBlankImport:
+		return "goleak is imported with a blank identifier and can't be called"
+	case ReasonDeferOrder:
+		return "it runs before the cleanup deferred earlier; defer it first so it runs last"
+	case ReasonCommentedOutVerify:
+		return "restore the commented-out goleak verification"
+	case ReasonTestMainExitCode:
+		return "the exit code returned by goleak.VerifyTestMain is not passed to os.Exit"
+	case ReasonVerifyTestMainInTest:
+		return "goleak.VerifyTestMain belongs in TestMain; use defer goleak.VerifyNone(t) in a test"
+	case ReasonNoTests:
+		return "package has no tests, so nothing verifies it doesn't leak goroutines"
+	case ReasonInvalidOption:
+		return "not a goleak option accepted by this verification function"
+	case ReasonVerifyNoneInTestMain:
+		return "goleak.VerifyNone doesn't cover the tests from TestMain; use goleak.VerifyTestMain(m)"
+	case ReasonRequireDefer:
+		return "marked //leakcheck:require-defer, so goleak.VerifyTestMain doesn't count; missing defer goleak.VerifyNone(t)"
+	case ReasonConditionalCoverage:
+		return "it is nested in an if, loop or closure, so some runs of the test aren't verified"
+	case ReasonTestMainSetupGoroutine:
+		return "a goroutine started by TestMain before the tests run is still running when goleak verifies them, unless it is stopped first"
+	default:
+		return "unknown reason"
+	}
+}
+
+// message renders the diagnostic message for a finding about testFunc
+func (r Reason) message(testFunc string) string {
+	switch r {
+	case ReasonSubtestMissingDefer:
+		return fmt.Sprintf("subtest in %s starts goroutines but is not covered by goleak (%s)", testFunc, r.description())
+	case ReasonExampleNoTestMain:
+		return fmt.Sprintf("example function %s is not covered by goleak (%s)", testFunc, r.description())
+	case ReasonSuiteNoTeardown:
+		return fmt.Sprintf("suite test method %s is not covered by goleak (%s)", testFunc, r.description())
+	case ReasonRedundantDefer:
+		return fmt.Sprintf("defer goleak.VerifyNone in test function %s is redundant (%s)", testFunc, r.description())
+	case ReasonUnreachableDefer:
+		return fmt.Sprintf("defer goleak.VerifyNone in test function %s is unreachable (%s)", testFunc, r.description())
+	case ReasonCommentedOutVerify:
+		return fmt.Sprintf("found commented-out goleak coverage in test function %s (%s)", testFunc, r.description())
+	case ReasonDeferOrder:
+		return fmt.Sprintf("defer goleak.VerifyNone in test function %s is not the first defer (%s)", testFunc, r.description())
+	case ReasonConditionalCoverage:
+		return fmt.Sprintf("goleak verification in test function %s is conditional (%s)", testFunc, r.description())
+	case ReasonParallelDefer:
+		return fmt.Sprintf("parallel test function %s is not reliably covered by goleak (%s)", testFunc, r.description())
+	}
+	return fmt.Sprintf("test function %s is not covered by goleak (%s)", testFunc, r.description())
+}
+
+// messagePlaceholders are the placeholders of Config.MessageTemplate
+var messagePlaceholders = []string{"{message}", "{func}", "{pkg}", "{reason}"}
+
+// ValidateMessageTemplate checks that every {...} in template is one of the
+// placeholders of Config.MessageTemplate and is closed. Any other text is
+// kept as is.
+func ValidateMessageTemplate(template string) error {
+	for rest := template; ; {
+		start := strings.IndexByte(rest, '{')
+		if start < 0 {
+			return nil
+		}
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			return fmt.Errorf("unclosed placeholder %q", rest[start:])
+		}
+		placeholder := rest[start : start+end+1]
+		if !slices.Contains(messagePlaceholders, placeholder) {
+			last := len(messagePlaceholders) - 1
+			return fmt.Errorf("unknown placeholder %q, want %s or %s", placeholder, strings.Join(messagePlaceholders[:last], ", "), messagePlaceholders[last])
+		}
+		rest = rest[start+end+1:]
+	}
+}
+
+// renderMessage renders template, a valid Config.MessageTemplate, for f,
+// whose Message holds the default wording
+func (f Finding) renderMessage(template string) string {
+	return strings.NewReplacer(
+		"{message}", f.Message,
+		"{func}", f.TestFunc,
+		"{pkg}", f.Package,
+		"{reason}", f.Reason.String(),
+	).Replace(template)
+}
@@ -0,0 +1,183 @@
+package leakcheck
+
+import (
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// Fixable reports whether FixFile can fix finding by deferring
+// goleak.VerifyNone in the test function it is about
+func Fixable(finding Finding) bool {
+	return finding.TestFunc != "" && (finding.Reason == ReasonNoImport || finding.Reason == ReasonMissingDefer)
+}
+
+// FixFile adds defer goleak.VerifyNone(t) at the start of every test function
+// of the file src that one of findings reports as uncovered, the same edit as
+// the analyzer's suggested fix. If the file doesn't import goleak by name from
+// one of importPaths yet, it imports the first one, placed like the suggested
+// fix does. The result is formatted with go/format.
+//
+// Findings about other files or that aren't Fixable are ignored, as are tests
+// whose *testing.T parameter is unnamed. FixFile returns the new source, nil
+// when nothing changed, and the findings it fixed. Fixing is idempotent: the
+// fixed tests are covered, so analyzing the output finds nothing more to fix.
+func FixFile(filename string, src []byte, findings []Finding, importPaths []string) ([]byte, []Finding, error) {
+	paths := unquotedPaths(importPaths)
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Findings are reported once per package variant, so index them by line
+	wanted := make(map[int]Finding)
+	for _, finding := range findings {
+		if Fixable(finding) && finding.Position.Filename == filename {
+			wanted[finding.Position.Line] = finding
+		}
+	}
+	if len(wanted) == 0 {
+		return nil, nil, nil
+	}
+
+	alias, imported := fileGoleakAlias(file, paths)
+
+	type insertion struct {
+		offset int
+		text   string
+	}
+	var insertions []insertion
+	var fixed []Finding
+	for _, decl := range file.Decls {
+		fd, ok := decl.(*ast.FuncDecl)
+		if !ok || fd.Body == nil {
+			continue
+		}
+		finding, ok := wanted[fset.Position(fd.Pos()).Line]
+		if !ok || finding.TestFunc != fd.Name.Name {
+			continue
+		}
+		param := firstParam(fd.Type)
+		if param == nil || param.Name == blankIdent {
+			continue
+		}
+		pos, text := verifyDeferEdit(fset, fd.Body, alias, param.Name)
+		insertions = append(insertions, insertion{offset: fset.Position(pos).Offset, text: text})
+		fixed = append(fixed, finding)
+	}
+	if len(insertions) == 0 {
+		return nil, nil, nil
+	}
+	// The same edit as the suggested fix, so that both place the import alike
+	if !imported {
+		edit := importEdit(fset, file, paths[0])
+		insertions = append(insertions, insertion{offset: fset.Position(edit.Pos).Offset, text: string(edit.NewText)})
+	}
+
+	// Insert from the end so that earlier offsets stay valid
+	sort.Slice(insertions, func(i, j int) bool { return insertions[i].offset > insertions[j].offset })
+	out := append([]byte(nil), src...)
+	for _, ins := range insertions {
+		out = append(out[:ins.offset], append([]byte(ins.text), out[ins.offset:]...)...)
+	}
+
+	out, err = format.Source(out)
+	if err != nil {
+		return nil, nil, err
+	}
+	return out, fixed, nil
+}
+
+// unquotedPaths returns importPaths without quotes, which Config.GoleakImportPaths
+// may have, or goleak's own path if there are none
+func unquotedPaths(importPaths []string) []string {
+	if len(importPaths) == 0 {
+		return []string{goleakUberPath}
+	}
+	paths := make([]string, len(importPaths))
+	for i, path := range importPaths {
+		paths[i] = strings.Trim(path, `"`)
+	}
+	return paths
+}
+
+// importEdit returns the edit adding an import of path to file: a line at the
+// end of its last grouped import declaration, a new declaration after its
+// last single import, or one after the package clause in a file without
+// imports. In a group of standard library imports, the new one starts its own
+// group as goimports would place it.
+func importEdit(fset *token.FileSet, file *ast.File, path string) analysis.TextEdit {
+	spec := strconv.Quote(path)
+	var last *ast.GenDecl
+	for _, decl := range file.Decls {
+		if gd, ok := decl.(*ast.GenDecl); ok && gd.Tok == token.IMPORT {
+			last = gd
+		}
+	}
+
+	switch {
+	case last == nil:
+		pos := lineEnd(fset, file.Name.End())
+		return analysis.TextEdit{Pos: pos, End: pos, NewText: []byte("\n\nimport " + spec)}
+	case last.Rparen.IsValid() && len(last.Specs) > 0:
+		text := "\t" + spec + "\n"
+		lastPath, _ := strconv.Unquote(last.Specs[len(last.Specs)-1].(*ast.ImportSpec).Path.Value)
+		if isStdlibPath(lastPath) && !isStdlibPath(path) {
+			text = "\n" + text
+		}
+		// The closing parenthesis usually starts its own line
+		pos := last.Rparen
+		if fset.Position(pos).Column != 1 {
+			text = "\n" + text
+		}
+		return analysis.TextEdit{Pos: pos, End: pos, NewText: []byte(text)}
+	default:
+		pos := lineEnd(fset, last.End())
+		return analysis.TextEdit{Pos: pos, End: pos, NewText: []byte("\nimport " + spec)}
+	}
+}
+
+// isStdlibPath checks if path is that of a standard library package, whose
+// first element has no dot
+func isStdlibPath(path string) bool {
+	first, _, _ := strings.Cut(path, "/")
+	return !strings.Contains(first, ".")
+}
+
+// lineEnd returns the position of the newline ending the line of pos, after
+// any trailing comment, or the end of the file on its last line
+func lineEnd(fset *token.FileSet, pos token.Pos) token.Pos {
+	tokFile := fset.File(pos)
+	line := tokFile.Line(pos)
+	if line == tokFile.LineCount() {
+		return token.Pos(tokFile.Base() + tokFile.Size())
+	}
+	return tokFile.LineStart(line+1) - 1
+}
+
+// fileGoleakAlias returns the name goleak is imported as in file, if it is
+// imported from one of importPaths by name, or the name of the import FixFile adds
+func fileGoleakAlias(file *ast.File, importPaths []string) (string, bool) {
+	for _, imp := range file.Imports {
+		path, err := strconv.Unquote(imp.Path.Value)
+		if err != nil || !slices.Contains(importPaths, path) {
+			continue
+		}
+		if imp.Name == nil {
+			return defaultAlias, true
+		}
+		if imp.Name.Name != blankIdent && imp.Name.Name != "." {
+			return imp.Name.Name, true
+		}
+	}
+	return defaultAlias, false
+}
@@ -0,0 +1,211 @@
+package leakcheck_test
+
+import (
+	"go/parser"
+	"go/token"
+	"testing"
+
+	"github.com/rleungx/leakcheck"
+)
+
+func TestFixFile(t *testing.T) {
+	src := `package fix
+
+import "testing"
+
+func TestEmpty(t *testing.T) {}
+
+func TestBody(t *testing.T) { // trailing comment
+	t.Log("body")
+}
+
+func TestCovered(t *testing.T) {
+	t.Log("covered")
+}
+
+func TestUnnamed(*testing.T) {
+}
+`
+	want := `package fix
+
+import "testing"
+import "go.uber.org/goleak"
+
+func TestEmpty(t *testing.T) {
+	defer goleak.VerifyNone(t)
+}
+
+func TestBody(t *testing.T) { // trailing comment
+	defer goleak.VerifyNone(t)
+	t.Log("body")
+}
+
+func TestCovered(t *testing.T) {
+	t.Log("covered")
+}
+
+func TestUnnamed(*testing.T) {
+}
+`
+	finding := func(testFunc string, line int) leakcheck.Finding {
+		return leakcheck.Finding{
+			TestFunc: testFunc,
+			Reason:   leakcheck.ReasonNoImport,
+			Position: token.Position{Filename: "fix_test.go", Line: line, Column: 1},
+		}
+	}
+	findings := []leakcheck.Finding{
+		finding("TestEmpty", 5),
+		finding("TestBody", 7),
+		finding("TestBody", 7), // reported again by another package variant
+		finding("TestUnnamed", 15),
+	}
+
+	out, fixed, err := leakcheck.FixFile("fix_test.go", []byte(src), findings, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != want {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+	if len(fixed) != 2 {
+		t.Errorf("expected 2 fixed findings, got %d", len(fixed))
+	}
+
+	// Without fixable findings, as when analyzing the fixed file, nothing changes
+	again, _, err := leakcheck.FixFile("fix_test.go", out, nil, nil)
+	if err != nil || again != nil {
+		t.Errorf("fixing again changed the file: %v\n%s", err, again)
+	}
+}
+
+func TestFixFileImportGroup(t *testing.T) {
+	src := `package fix
+
+import (
+	"testing"
+)
+
+func TestMissing(t *testing.T) {
+}
+`
+	findings := []leakcheck.Finding{{
+		TestFunc: "TestMissing",
+		Reason:   leakcheck.ReasonNoImport,
+		Position: token.Position{Filename: "fix_test.go", Line: 7, Column: 1},
+	}}
+	out, _, err := leakcheck.FixFile("fix_test.go", []byte(src), findings, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// goleak starts its own group after the standard library, as goimports would
+	want := `package fix
+
+import (
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+func TestMissing(t *testing.T) {
+	defer goleak.VerifyNone(t)
+}
+`
+	if string(out) != want {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+}
+
+func TestFixFileExistingImport(t *testing.T) {
+	src := `package fix
+
+import (
+	"testing"
+
+	leak "go.uber.org/goleak"
+)
+
+func TestMissing(t *testing.T) {
+}
+`
+	findings := []leakcheck.Finding{{
+		TestFunc: "TestMissing",
+		Reason:   leakcheck.ReasonMissingDefer,
+		Position: token.Position{Filename: "fix_test.go", Line: 9, Column: 1},
+	}}
+	out, _, err := leakcheck.FixFile("fix_test.go", []byte(src), findings, []string{"go.uber.org/goleak"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `package fix
+
+import (
+	"testing"
+
+	leak "go.uber.org/goleak"
+)
+
+func TestMissing(t *testing.T) {
+	defer leak.VerifyNone(t)
+}
+`
+	if string(out) != want {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+}
+
+func TestImportEdit(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			"grouped standard library imports",
+			"package p\n\nimport (\n\t\"testing\"\n)\n",
+			"package p\n\nimport (\n\t\"testing\"\n\n\t\"go.uber.org/goleak\"\n)\n",
+		},
+		{
+			"grouped third-party imports",
+			"package p\n\nimport (\n\t\"testing\"\n\n\t\"example.com/lib\"\n)\n",
+			"package p\n\nimport (\n\t\"testing\"\n\n\t\"example.com/lib\"\n\t\"go.uber.org/goleak\"\n)\n",
+		},
+		{
+			"group closed on the last import's line",
+			"package p\n\nimport (\"example.com/lib\")\n",
+			"package p\n\nimport (\"example.com/lib\"\n\t\"go.uber.org/goleak\"\n)\n",
+		},
+		{
+			"single import with a trailing comment",
+			"package p\n\nimport \"testing\" // for tests\n\nfunc f() {}\n",
+			"package p\n\nimport \"testing\" // for tests\nimport \"go.uber.org/goleak\"\n\nfunc f() {}\n",
+		},
+		{
+			"no imports",
+			"// Package p does nothing.\npackage p // want \"x\"\n\nfunc f() {}\n",
+			"// Package p does nothing.\npackage p // want \"x\"\n\nimport \"go.uber.org/goleak\"\n\nfunc f() {}\n",
+		},
+		{
+			"no imports nor final newline",
+			"package p",
+			"package p\n\nimport \"go.uber.org/goleak\"",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			fset := token.NewFileSet()
+			file, err := parser.ParseFile(fset, "p.go", tt.src, parser.ParseComments)
+			if err != nil {
+				t.Fatal(err)
+			}
+			edit := leakcheck.ImportEdit(fset, file, "go.uber.org/goleak")
+			offset := fset.Position(edit.Pos).Offset
+			got := tt.src[:offset] + string(edit.NewText) + tt.src[offset:]
+			if got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+			if _, err := parser.ParseFile(token.NewFileSet(), "p.go", got, parser.ImportsOnly); err != nil {
+				t.Errorf("edited source doesn't parse: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package leakcheck
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+)
+
+// registerFlags binds the options of config to fs, so that drivers such as
+// multichecker can configure the analyzer with -leakcheck.<flag>. The flags
+// are parsed before any package is analyzed and update config in place; their
+// defaults are the values config already holds.
+func registerFlags(fs *flag.FlagSet, config *Config) {
+	fs.StringVar(&config.ExcludePackages, "exclude-packages", config.ExcludePackages, "comma-separated list of package patterns to exclude (supports regex)")
+	fs.StringVar(&config.ExcludeFiles, "exclude-files", config.ExcludeFiles, "comma-separated list of file patterns to exclude (supports regex)")
+	fs.StringVar(&config.ExcludeFunctions, "exclude-functions", config.ExcludeFunctions, "comma-separated list of test function name patterns to exclude (supports regex)")
+	fs.Func("exclude-dirs", "comma-separated list of directories to exclude, matched without regex", listFlag(&config.ExcludeDirs))
+	fs.Func("exclude-build-tags", "comma-separated list of build tags whose test files are excluded", listFlag(&config.ExcludeBuildTags))
+	fs.StringVar(&config.ManifestFile, "manifest-file", config.ManifestFile, "file listing the packages to check, one import path or pattern per line; other packages are skipped")
+	fs.BoolVar(&config.AnchorPackagePatterns, "anchor-packages", config.AnchorPackagePatterns, "match plain -exclude-packages patterns against the last import path element only")
+	fs.BoolVar(&config.IgnoreBadPatterns, "ignore-bad-patterns", config.IgnoreBadPatterns, "treat exclusion patterns that aren't valid regular expressions as matching nothing instead of failing")
+	fs.BoolVar(&config.SkipGenerated, "skip-generated", config.SkipGenerated, "skip test files with a \"Code generated ... DO NOT EDIT.\" header")
+	fs.BoolVar(&config.IncludeVendor, "include-vendor", config.IncludeVendor, "analyze test files below vendor directories, which are skipped by default")
+	fs.Func("message-template", "message of every finding, with the placeholders {message}, {func}, {pkg} and {reason}", func(value string) error {
+		config.MessageTemplate = value
+		return ValidateMessageTemplate(value)
+	})
+	fs.Func("concurrency", "number of files analyzed concurrently in a package", func(value string) error {
+		n, err := strconv.Atoi(value)
+		if err == nil && n <= 0 {
+			err = fmt.Errorf("must be positive")
+		}
+		config.Concurrency = n
+		return err
+	})
+	fs.DurationVar(&config.Timeout, "timeout", config.Timeout, "analysis timeout per package")
+	fs.Func("test-prefixes", "comma-separated list of function name prefixes that mark a test (default \"Test\")", listFlag(&config.TestPrefixes))
+	fs.Func("goleak-paths", "comma-separated list of import paths recognized as goleak", listFlag(&config.GoleakImportPaths))
+	fs.Func("verify-funcs", "comma-separated list of goleak functions that verify a single test", listFlag(&config.VerifyFuncs))
+	fs.Func("verify-testmain-funcs", "comma-separated list of goleak functions that verify every test from TestMain", listFlag(&config.VerifyTestMainFuncs))
+	fs.Func("ignored-top-functions", "comma-separated list of functions every goleak verification must ignore", listFlag(&config.IgnoredTopFunctions))
+	fs.BoolVar(&config.CheckSubtests, "check-subtests", config.CheckSubtests, "require goroutine-spawning subtests to have their own goleak coverage")
+	fs.BoolVar(&config.CheckParallel, "check-parallel", config.CheckParallel, "warn about parallel tests covered only by a per-test goleak.VerifyNone")
+	fs.BoolVar(&config.CheckExamples, "check-examples", config.CheckExamples, "require runnable examples to be covered by goleak.VerifyTestMain")
+	fs.BoolVar(&config.CheckHelpers, "check-helpers", config.CheckHelpers, "treat deferred calls to package helpers that call goleak.VerifyNone as coverage")
+	fs.BoolVar(&config.CheckOptions, "check-options", config.CheckOptions, "report misused goleak.VerifyNone and goleak.VerifyTestMain options")
+	fs.BoolVar(&config.CheckCommentedOut, "check-commented-out", config.CheckCommentedOut, "hint at commented-out goleak verification in uncovered tests")
+	fs.BoolVar(&config.CheckDeferOrder, "check-defer-order", config.CheckDeferOrder, "require defer goleak.VerifyNone(t) to be the first defer of the test")
+	fs.StringVar(&config.GoVersion, "go-version", config.GoVersion, "Go version the analyzed code targets, overriding the go directive of its module")
+	fs.BoolVar(&config.OnlyGoroutineStartingTests, "only-goroutine-tests", config.OnlyGoroutineStartingTests, "report missing coverage only for tests containing go statements")
+	fs.BoolVar(&config.GroupNoImport, "group-no-import", config.GroupNoImport, "report the tests of a package that doesn't import goleak as a single finding")
+	fs.BoolVar(&config.RequireTests, "require-tests", config.RequireTests, "report packages without any _test.go file")
+	fs.BoolVar(&config.FlagConditionalCoverage, "flag-conditional-coverage", config.FlagConditionalCoverage, "note tests verified only by a defer or t.Cleanup nested in an if, loop or closure")
+	fs.BoolVar(&config.CheckTestMainSetup, "check-testmain-setup", config.CheckTestMainSetup, "note go statements in TestMain that start goroutines before goleak.VerifyTestMain or m.Run")
+	fs.BoolVar(&config.CheckRedundant, "check-redundant", config.CheckRedundant, "note per-test goleak.VerifyNone defers made redundant by goleak.VerifyTestMain")
+	fs.BoolVar(&config.CheckSuites, "check-suites", config.CheckSuites, "treat testify suite methods as covered by a TearDownTest calling goleak.VerifyNone(s.T())")
+	fs.IntVar(&config.TestMainSuggestThreshold, "suggest-testmain", config.TestMainSuggestThreshold, "suggest TestMain with goleak.VerifyTestMain when at least this many tests start goroutines (0 disables)")
+	// Strict implies the subtest and parallel checks, as in NewWithConfig
+	fs.BoolFunc("strict", "require unconditional coverage and enable the subtest and parallel checks", func(value string) error {
+		strict, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		config.Strict = strict
+		if strict {
+			config.CheckSubtests = true
+			config.CheckParallel = true
+		}
+		return nil
+	})
+}
+
+// listFlag returns a flag function that sets *list from a comma-separated value
+func listFlag(list *[]string) func(string) error {
+	return func(value string) error {
+		items, err := listValue(value)
+		*list = items
+		return err
+	}
+}
@@ -2,7 +2,10 @@ module github.com/rleungx/leakcheck
 
 go 1.23.0
 
-require golang.org/x/tools v0.34.0
+require (
+	golang.org/x/tools v0.34.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	golang.org/x/mod v0.25.0 // indirect
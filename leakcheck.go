@@ -2,10 +2,17 @@ package leakcheck
 
 import (
 	"context"
+	"fmt"
 	"go/ast"
 	"go/token"
+	"go/types"
+	"go/version"
+	"reflect"
 	"regexp"
 	"runtime"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -21,40 +28,288 @@ type Config struct {
 	ExcludeFiles    string
 	Concurrency     int
 	Timeout         time.Duration
+
+	// ExcludeDirs lists directories whose files are skipped, checked with a
+	// plain path comparison before any pattern matching or AST work. A
+	// relative entry such as "third_party" or "internal/gen" matches that
+	// sequence of directories anywhere in a file's path; an absolute entry
+	// matches only below that directory.
+	ExcludeDirs []string
+
+	// CheckSubtests requires every t.Run closure that starts goroutines to
+	// defer goleak.VerifyNone with the subtest's own *testing.T
+	CheckSubtests bool
+
+	// CheckParallel warns about tests that call t.Parallel() but are only
+	// covered by a per-test defer goleak.VerifyNone(t)
+	CheckParallel bool
+
+	// AnchorPackagePatterns matches plain (non-regex, non-glob) package
+	// exclusion patterns against the final element of the import path
+	// instead of anywhere in it
+	AnchorPackagePatterns bool
+
+	// OnlyGoroutineStartingTests reports missing coverage only for tests whose
+	// body, including closures, contains a go statement. Goroutines started
+	// by functions the test calls are not seen, so purely computational tests
+	// and tests relying on such functions are both exempt.
+	OnlyGoroutineStartingTests bool
+
+	// RequireTests reports packages with Go files but no _test.go file in
+	// their directory, since nothing verifies that their code doesn't leak.
+	// Excluded and ignored packages are left alone.
+	RequireTests bool
+
+	// TestMainSuggestThreshold suggests adding a TestMain with
+	// goleak.VerifyTestMain to packages without one that have at least this
+	// many tests starting goroutines. Zero disables the suggestion.
+	TestMainSuggestThreshold int
+
+	// CheckExamples reports runnable ExampleXxx functions when the package has
+	// no TestMain calling goleak.VerifyTestMain, since examples have no
+	// *testing.T to verify per function
+	CheckExamples bool
+
+	// CheckHelpers treats a deferred call to a package-level helper, such as
+	// func verifyLeaks(t *testing.T) { goleak.VerifyNone(t) }, as coverage,
+	// as well as a plain call to one registering the verification with
+	// t.Cleanup(func() { goleak.VerifyNone(t) }). Helpers may be declared in
+	// non-test files of the same package, and their parameter may be a
+	// testing.TB shared with benchmarks.
+	CheckHelpers bool
+
+	// CheckOptions inspects the options passed to goleak.VerifyNone and
+	// goleak.VerifyTestMain, reporting goleak.IgnoreCurrent() evaluated only
+	// when verification runs, Ignore*Function options naming functions that
+	// don't exist in the packages the test can see, and options goleak doesn't
+	// have or the verification function doesn't accept
+	CheckOptions bool
+
+	// TestPrefixes lists the function name prefixes that mark a test function,
+	// e.g. "ITest" for a custom integration test harness. Defaults to "Test".
+	// TestMain is always recognized by its exact name.
+	TestPrefixes []string
+
+	// ExcludeFunctions is a comma-separated list of patterns matched against
+	// test function names; matching tests are treated like excluded files
+	ExcludeFunctions string
+
+	// WarnUnusedExcludes records in each Result the patterns of
+	// ExcludePackages, ExcludeDirs, ExcludeFiles and ExcludeFunctions that
+	// match the package, so that drivers can warn with UnusedExcludes about
+	// patterns that match nothing across a run, such as a typo. Recording
+	// evaluates every pattern, not just up to the first match.
+	WarnUnusedExcludes bool
+
+	// GroupNoImport reports the uncovered tests of a package that doesn't
+	// import goleak as a single finding at its first test file, instead of
+	// one finding per test
+	GroupNoImport bool
+
+	// ManifestFile names a file listing the packages to check, one import
+	// path, glob or go list pattern with ... per line, e.g. maintained by a
+	// central team for leak-sensitive packages. Packages it doesn't list are
+	// skipped entirely; the exclude options still apply to those it lists.
+	ManifestFile string
+
+	// IgnoreBadPatterns lets the analysis run with exclusion patterns that
+	// Validate rejects, treating each as matching nothing instead of failing
+	IgnoreBadPatterns bool
+
+	// CheckRedundant notes each per-test defer goleak.VerifyNone(t) in
+	// packages whose TestMain already calls goleak.VerifyTestMain
+	CheckRedundant bool
+
+	// CheckSuites understands testify suites: TestXxx methods of a type
+	// embedding suite.Suite are covered when the suite's TearDownTest or
+	// TearDownSuite calls goleak.VerifyNone(s.T()), and so is the test
+	// function running such a suite with suite.Run
+	CheckSuites bool
+
+	// GoleakImportPaths lists the import paths recognized as goleak, e.g. a
+	// vendored copy under internal/third_party/goleak. Defaults to
+	// go.uber.org/goleak and github.com/uber-go/goleak; setting it replaces
+	// the defaults, so list them too to keep recognizing them. Imports are
+	// matched by the path of the package they resolve to, so a goleak
+	// replaced in go.mod is recognized under its module path, and called by
+	// the name its package declares.
+	GoleakImportPaths []string
+
+	// VerifyFuncs lists the goleak functions that verify a single test, such
+	// as a fork's VerifyNoneWithContext. Like VerifyNone they must take the
+	// *testing.T as their first argument. Defaults to VerifyNone; setting it
+	// replaces the default.
+	VerifyFuncs []string
+
+	// VerifyTestMainFuncs lists the goleak functions that verify every test
+	// from TestMain. Defaults to VerifyTestMain; setting it replaces the default.
+	VerifyTestMainFuncs []string
+
+	// Strict tightens the coverage heuristics to their safest interpretation:
+	// the defer or t.Cleanup covering a test and the goleak.VerifyTestMain
+	// call in TestMain must be unconditional, and subtests and parallel tests
+	// are checked as with CheckSubtests and CheckParallel
+	Strict bool
+
+	// PackageRules override ExcludeFiles and ExcludeFunctions for the packages
+	// they match. Only the most specific matching rule applies.
+	PackageRules []PackageRule
+
+	// IgnoredTopFunctions lists the functions of goroutines the package is
+	// expected to leave running, such as a global metrics flusher, as they
+	// appear in a stack trace, e.g. "example.com/metrics.(*Flusher).run".
+	// Every goleak.VerifyNone and goleak.VerifyTestMain call must then ignore
+	// each of them with an inline goleak.IgnoreTopFunction or
+	// goleak.IgnoreAnyFunction option. Calls passing options that can't be
+	// seen, such as a variable or opts..., are not checked.
+	IgnoredTopFunctions []string
+
+	// CheckDeferOrder requires defer goleak.VerifyNone(t) to be the first defer
+	// of the test, so that it runs last. A call deferred earlier runs after
+	// the verification and may be what stops the test's goroutines.
+	CheckDeferOrder bool
+
+	// ExcludeBuildTags skips test files whose //go:build constraint mentions
+	// one of these tags, e.g. "integration" for integration tests known to
+	// leak against stubbed dependencies. The files are only analyzed at all
+	// when the build enables their tags. A negated tag doesn't count, so
+	// that the unit tests marked //go:build !integration are still checked.
+	ExcludeBuildTags []string
+
+	// CheckCommentedOut adds a hint to uncovered tests whose body contains a
+	// commented-out goleak verification, such as // defer goleak.VerifyNone(t)
+	CheckCommentedOut bool
+
+	// SkipGenerated treats test files with a standard "Code generated ... DO
+	// NOT EDIT." header like excluded files. It is enabled by DefaultConfig.
+	SkipGenerated bool
+
+	// GoVersion is the Go version the analyzed code targets, e.g. "1.13" or
+	// "go1.13", overriding the go directive of each package's module. Checks
+	// relying on newer testing APIs only apply from the version introducing
+	// them: t.Cleanup counts as coverage from Go 1.14. Without either version,
+	// every check applies.
+	GoVersion string
+
+	// IncludeVendor analyzes test files below a vendor directory, which are
+	// skipped by default as the code of other modules. Teams vendoring
+	// modules they own can enable it to check those too.
+	IncludeVendor bool
+
+	// FlagConditionalCoverage notes the tests whose only verification is
+	// deferred or registered inside an if, loop or closure, such as
+	// if !testing.Short() { defer goleak.VerifyNone(t) }, which leaves some
+	// runs of the test unverified. Strict mode doesn't count such coverage at
+	// all; this keeps counting it but says so.
+	FlagConditionalCoverage bool
+
+	// CheckTestMainSetup notes each go statement in TestMain that runs before
+	// goleak.VerifyTestMain or m.Run, such as a server started for the
+	// tests. Unless stopped before, the goroutine is still running when
+	// goleak verifies the tests, which then fail on a leak that isn't theirs.
+	CheckTestMainSetup bool
+
+	// MessageTemplate renders the message of every finding, e.g. to link a
+	// wiki page on goleak usage, from the placeholders {message} for the
+	// default wording, {func} for the test function, empty for findings
+	// about a whole package, {pkg} for the import path of the package and
+	// {reason} for the reason's identifier, such as missing-defer. Empty
+	// keeps the default wording. See ValidateMessageTemplate.
+	MessageTemplate string
+
+	// MaxFindings caps the number of findings the command line tool prints
+	// across all packages, summing up the rest in a closing note, so that a
+	// first run on a large repository keeps CI logs readable. Zero means no
+	// limit. Only the command line tool and its configuration file honor it:
+	// the analyzer and the driver functions still return every finding, and
+	// other tools can apply the cap with LimitFindings.
+	MaxFindings int
+
+	// Dedupe reports each underlying issue once across the analyzed
+	// packages. The internal and external test packages of a directory are
+	// analyzed apart, so that both report it when, say, neither imports
+	// goleak with GroupNoImport. Unlike MaxFindings, it is applied by
+	// Analyze, AnalyzePackages and AnalyzeContext to the findings of the
+	// whole run, so drivers analyzing package by package, such as
+	// multichecker, can't offer it; see DedupeFindings.
+	Dedupe bool
+}
+
+// PackageRule overrides the exclusions for a set of packages, so that a single
+// configuration can express different policies across a monorepo
+type PackageRule struct {
+	// Packages is an import path prefix, matching the package and everything
+	// below it, or a regular expression matched against the import path
+	Packages string
+
+	// ExcludeFiles and ExcludeFunctions replace the top-level settings for
+	// the matched packages when not empty
+	ExcludeFiles     string
+	ExcludeFunctions string
+}
+
+// setDefaults fills in the settings left unset with their defaults, such as
+// one worker per CPU and a 30 minute timeout, and the checks implied by Strict
+func (c *Config) setDefaults() {
+	if c.Concurrency <= 0 {
+		c.Concurrency = runtime.NumCPU()
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 30 * time.Minute // Default timeout
+	}
+	if len(c.TestPrefixes) == 0 {
+		c.TestPrefixes = []string{testPrefix}
+	}
+	if len(c.GoleakImportPaths) == 0 {
+		c.GoleakImportPaths = []string{goleakUberPath, goleakGithubPath}
+	}
+	if len(c.VerifyFuncs) == 0 {
+		c.VerifyFuncs = []string{verifyNone}
+	}
+	if len(c.VerifyTestMainFuncs) == 0 {
+		c.VerifyTestMainFuncs = []string{verifyTestMain}
+	}
+	if c.Strict {
+		c.CheckSubtests = true
+		c.CheckParallel = true
+	}
 }
 
+// outputCommentRegex matches the output comment that makes an example runnable,
+// using the same rule as go test
+var outputCommentRegex = regexp.MustCompile(`(?i)^[[:space:]]*(unordered )?output:`)
+
 // regexCache caches compiled regular expressions for better performance
-var (
-	regexCache = make(map[string]*regexp.Regexp, 16) // Pre-allocate with reasonable capacity
-	regexMutex sync.RWMutex
-)
+var regexCache boundedCache[*regexp.Regexp]
+
+// DefaultConfig returns the configuration used by New, the starting point for
+// settings that are enabled by default
+func DefaultConfig() *Config {
+	return &Config{SkipGenerated: true}
+}
 
 // New creates a new leakcheck analyzer with default configuration
 func New() *analysis.Analyzer {
-	return NewWithConfig(&Config{})
+	return NewWithConfig(DefaultConfig())
 }
 
 // NewWithConfig creates a new leakcheck analyzer with custom configuration
 func NewWithConfig(config *Config) *analysis.Analyzer {
 	// Ensure config is not nil and set defaults
 	if config == nil {
-		config = &Config{}
+		config = DefaultConfig()
 	}
-
-	// Set reasonable defaults if not specified
-	if config.Concurrency <= 0 {
-		config.Concurrency = runtime.NumCPU()
-	}
-	if config.Timeout <= 0 {
-		config.Timeout = 30 * time.Minute // Default timeout
-	}
-
-	return &analysis.Analyzer{
-		Name:     "leakcheck",
-		Doc:      "check that all tests are covered by goleak",
-		Requires: []*analysis.Analyzer{inspect.Analyzer},
-		Run:      run(config),
+	config.setDefaults()
+
+	analyzer := &analysis.Analyzer{
+		Name:       "leakcheck",
+		Doc:        "check that all tests are covered by goleak",
+		Requires:   []*analysis.Analyzer{inspect.Analyzer},
+		Run:        run(config),
+		ResultType: reflect.TypeOf((*Result)(nil)),
 	}
+	registerFlags(&analyzer.Flags, config)
+	return analyzer
 }
 
 // Analyzer is the default analyzer instance for backward compatibility
@@ -62,7 +317,54 @@ var Analyzer = New()
 
 // run creates a run function with the given configuration
 func run(config *Config) func(*analysis.Pass) (interface{}, error) {
-	return func(pass *analysis.Pass) (interface{}, error) {
+	// Flags may set the patterns after NewWithConfig, so they are checked on
+	// first use; a bad one fails the analysis instead of matching nothing
+	validate := sync.OnceValue(config.Validate)
+	validateTemplate := sync.OnceValue(func() error {
+		return ValidateMessageTemplate(config.MessageTemplate)
+	})
+	// The manifest is read once per analyzer, not per package
+	loadManifest := sync.OnceValues(func() (*manifest, error) {
+		return readManifest(config.ManifestFile)
+	})
+	return func(pass *analysis.Pass) (_ interface{}, err error) {
+		if err := validate(); err != nil && !config.IgnoreBadPatterns {
+			return nil, err
+		}
+		if err := validateTemplate(); err != nil {
+			return nil, fmt.Errorf("message-template: %w", err)
+		}
+		listed, err := loadManifest()
+		if err != nil {
+			return nil, err
+		}
+		unlisted := !listed.includes(pass.Pkg.Path())
+		result := &Result{Package: pass.Pkg.Path(), Stats: Stats{Files: len(pass.Files)}}
+		start := time.Now()
+		defer func() { result.Stats.Duration = time.Since(start) }()
+
+		// Findings are reported once the package is done, in source order
+		defer func() {
+			if err == nil {
+				reportSorted(pass, result, config.MessageTemplate)
+			}
+		}()
+
+		// Packages without tests count too, e.g. excluded mocks
+		if config.WarnUnusedExcludes {
+			result.MatchedExcludes = matchedExcludes(pass, config)
+		}
+
+		// Most packages of a repository have no tests, and those that have are
+		// also analyzed once without them: skip these before any other work
+		if !hasTestFiles(pass) {
+			if config.RequireTests && !unlisted {
+				reportMissingTests(pass, config, result)
+			}
+			return result, nil
+		}
+		config := config.forPackage(pass.Pkg.Path())
+
 		// Create context with timeout if specified
 		ctx := context.Background()
 		if config.Timeout > 0 {
@@ -74,76 +376,228 @@ func run(config *Config) func(*analysis.Pass) (interface{}, error) {
 		// Use a channel to control concurrent processing
 		semaphore := make(chan struct{}, config.Concurrency)
 
-		// Early bailout checks for performance
-		if len(pass.Files) == 0 {
-			return nil, nil
-		}
-
 		// Check context for timeout
 		select {
 		case <-ctx.Done():
-			return nil, ctx.Err()
+			return nil, timeoutError(pass, config, "", ctx.Err())
 		default:
 		}
 
-		// Check if package should be excluded first (fastest check)
-		if shouldExcludePackage(pass.Pkg.Path(), config) {
-			return nil, nil
+		// Check if package should be excluded first (fastest check), or is
+		// acknowledged as a whole by a directive or a sentinel file
+		excluded := unlisted || shouldExcludePackage(pass.Pkg.Path(), config)
+		if excluded || isPackageIgnored(pass) {
+			result.Excluded = excluded
+			detail := fmt.Sprintf("the package is acknowledged by //%s or a %s file", packageIgnoreDirective, packageIgnoreFile)
+			if unlisted {
+				detail = fmt.Sprintf("the package is not listed in manifest-file %s", listed.path)
+			} else if excluded {
+				detail = "the package matches exclude-packages"
+			}
+			recordExcludedTests(pass, config, result, detail)
+			return result, nil
 		}
+		result.ExcludedFiles = excludedTestFiles(pass, config)
 
 		// Check if we have any non-excluded test files
 		if !hasNonExcludedTestFiles(pass, config) {
-			return nil, nil
+			recordExcludedTests(pass, config, result, "every test file of the package is excluded")
+			return result, nil
 		}
 
+		// All findings go through the same filter, whichever path reports them
+		filter := newReportFilter(pass, config)
+
 		// Check if goleak is imported and get its alias
-		goleakAlias := getGoleakAlias(pass.Files)
+		goleak := goleakNames{
+			aliases:        getGoleakAliases(pass.TypesInfo, pass.Files, config.GoleakImportPaths),
+			verify:         config.VerifyFuncs,
+			verifyTestMain: config.VerifyTestMainFuncs,
+			paths:          config.GoleakImportPaths,
+		}
+
+		if len(goleak.aliases) > 0 {
+			goleak.alias = goleak.aliases[0]
+		}
 
 		// If no goleak import, report for all test functions
-		if goleakAlias == "" {
-			return reportUncoveredTestFunctionsWithContext(ctx, pass, config, "goleak not imported", semaphore)
+		if goleak.alias == "" {
+			// import _ "go.uber.org/goleak" looks like coverage but can't be called
+			if imp := findBlankGoleakImport(pass.TypesInfo, pass.Files, config.GoleakImportPaths); imp != nil && filter.shouldReport(testFuncInfo{pos: imp.Pos(), filename: pass.Fset.Position(imp.Pos()).Filename}) {
+				message := fmt.Sprintf("goleak is imported with a blank identifier in package %s, so goleak.VerifyNone and goleak.VerifyTestMain can't be called; import it by name or remove the import", pass.Pkg.Name())
+				reportMessage(pass, result, imp.Pos(), "", ReasonBlankImport, message)
+			}
+			return reportUncoveredTestFunctionsWithContext(ctx, pass, config, filter, result, ReasonNoImport, semaphore)
 		}
 
 		// Check context again before expensive analysis
 		select {
 		case <-ctx.Done():
-			return nil, ctx.Err()
+			return nil, timeoutError(pass, config, "", ctx.Err())
 		default:
 		}
 
+		// Collect helpers from all files, including non-test files, before analyzing tests
+		var helpers map[string]verifyHelper
+		if config.CheckHelpers {
+			helpers = collectVerifyHelpers(pass, config, goleak)
+		}
+
 		// Analyze test functions with context and worker control
-		result, err := analyzeTestFunctionsWithContext(ctx, pass, goleakAlias, semaphore)
+		analyzed, err := analyzeTestFunctionsWithContext(ctx, pass, config, goleak, helpers, semaphore)
 		if err != nil {
 			return nil, err
 		}
 
+		// TestMain may delegate to a package function that calls VerifyTestMain,
+		// e.g. func TestMain(m *testing.M) { os.Exit(testMain(m)) }
+		if analyzed.hasTestMain && !analyzed.hasVerifyTestMain && callsVerifyTestMain(pass, goleak, analyzed.testMainCallees) {
+			analyzed.hasVerifyTestMain = true
+			analyzed.usesVerify = true
+		}
+
+		if !analyzed.hasVerifyTestMain {
+			analyzed.optionIssues = append(analyzed.optionIssues, analyzed.testMainVerifyNone...)
+		}
+
+		// Suite methods and the tests running their suite are covered by the suite's teardown
+		if config.CheckSuites {
+			coveredSuites := collectCoveredSuites(pass, goleak)
+			for _, testFunc := range analyzed.testFuncs {
+				if testFunc.suite != "" && coveredSuites[testFunc.suite] {
+					analyzed.cover(testFunc.name, fmt.Sprintf("suite %s verifies each test in its teardown", testFunc.suite))
+				} else if testFunc.suite == "" && runsCoveredSuite(pass.TypesInfo, testFunc.body, coveredSuites) {
+					analyzed.cover(testFunc.name, "runs a suite that verifies each test in its teardown")
+				}
+			}
+		}
+
+		// A test whose only goroutine work happens in subtests that verify
+		// themselves is covered by them
+		for _, testFunc := range analyzed.testFuncs {
+			if testFunc.suite == "" && !analyzed.funcsCoveredByDefer[testFunc.name] && coveredBySubtests(pass.TypesInfo, testFunc.body, testFunc.param, goleak) {
+				analyzed.cover(testFunc.name, "its goroutines start in subtests that verify themselves")
+			}
+		}
+
+		// Note when goleak is imported only to satisfy the compiler
+		if !analyzed.usesVerify && len(helpers) == 0 {
+			if imp := findGoleakImport(pass.TypesInfo, pass.Files, config.GoleakImportPaths); imp != nil && filter.shouldReport(testFuncInfo{pos: imp.Pos(), filename: pass.Fset.Position(imp.Pos()).Filename}) {
+				message := fmt.Sprintf("goleak is imported but never used for verification in package %s (no goleak.VerifyNone or goleak.VerifyTestMain calls)", pass.Pkg.Name())
+				reportMessage(pass, result, imp.Pos(), "", ReasonImportUnused, message)
+			}
+		}
+
+		// Option misuse is reported whether or not the tests are covered
+		for _, issue := range analyzed.optionIssues {
+			if filter.shouldReport(testFuncInfo{name: issue.testFunc, pos: issue.pos, filename: issue.filename}) {
+				reportMessage(pass, result, issue.pos, issue.testFunc, issue.reason, issue.message)
+			}
+		}
+
+		recordTestStatuses(pass, filter, result, analyzed)
+
 		// Report issues
-		if result.hasTestMain && result.hasVerifyTestMain {
+		if analyzed.hasTestMain && analyzed.hasVerifyTestMain {
 			// If TestMain with VerifyTestMain exists, all tests are covered
-			return nil, nil
+			// but those marked to verify themselves
+			testMain := findTestMain(pass)
+			requireDefer := make(map[string]bool)
+			for _, testFunc := range analyzed.testFuncs {
+				if !testFunc.requireDefer {
+					continue
+				}
+				requireDefer[testFunc.name] = true
+				if !analyzed.funcsCoveredByDefer[testFunc.name] && filter.shouldReport(testFunc) {
+					reportUncoveredTest(pass, result, testFunc, ReasonRequireDefer, goleak.paths, testMain)
+				}
+			}
+			if config.CheckRedundant {
+				for _, deferred := range analyzed.coverageDefers {
+					if !requireDefer[deferred.name] && filter.shouldReport(deferred) {
+						reportFinding(pass, result, deferred.pos, deferred.name, ReasonRedundantDefer)
+					}
+				}
+			}
+			return result, nil
+		}
+
+		// Report goroutine-spawning subtests without their own coverage
+		for _, subtest := range analyzed.uncoveredSubtests {
+			if filter.shouldReport(subtest) {
+				reportFinding(pass, result, subtest.pos, subtest.name, ReasonSubtestMissingDefer)
+			}
+		}
+
+		// Examples can only be covered by TestMain
+		for _, example := range analyzed.examples {
+			if filter.shouldReport(example) {
+				reportFinding(pass, result, example.pos, example.name, ReasonExampleNoTestMain)
+			}
+		}
+
+		// Suggest a package-wide TestMain when many tests start goroutines
+		if !analyzed.hasTestMain && config.TestMainSuggestThreshold > 0 {
+			suggestTestMain(pass, config, filter, result, analyzed.testFuncs)
 		}
 
 		// Check individual test functions with context
-		for _, testFunc := range result.testFuncs {
+		testMain := findTestMain(pass)
+		unreachable := make(map[string]token.Pos, len(analyzed.unreachableDefers))
+		for _, deferred := range analyzed.unreachableDefers {
+			if _, ok := unreachable[deferred.name]; !ok {
+				unreachable[deferred.name] = deferred.pos
+			}
+		}
+		for _, testFunc := range analyzed.testFuncs {
 			select {
 			case <-ctx.Done():
-				return nil, ctx.Err()
+				return nil, timeoutError(pass, config, "", ctx.Err())
 			default:
 			}
 
-			if !result.funcsCoveredByDefer[testFunc.name] {
-				reason := "missing defer goleak.VerifyNone(t)"
-				if result.hasTestMain && !result.hasVerifyTestMain {
-					reason = "TestMain exists but doesn't call goleak.VerifyTestMain"
+			// Tests without go statements need no coverage in OnlyGoroutineStartingTests mode
+			needsCoverage := !config.OnlyGoroutineStartingTests || testFunc.goroutines
+			if testFunc.suite != "" {
+				if !analyzed.funcsCoveredByDefer[testFunc.name] && needsCoverage && filter.shouldReport(testFunc) {
+					reportFinding(pass, result, testFunc.pos, testFunc.name, ReasonSuiteNoTeardown)
+				}
+			} else if !analyzed.funcsCoveredByDefer[testFunc.name] {
+				reason := ReasonMissingDefer
+				if analyzed.hasTestMain && !analyzed.hasVerifyTestMain {
+					reason = ReasonTestMainNoVerify
 				}
 				// Report directly using cached position info
-				if !shouldExcludeFileWithConfig(testFunc.filename, config) {
-					pass.Reportf(testFunc.pos, "test function %s is not covered by goleak (%s)", testFunc.name, reason)
+				if !needsCoverage || !filter.shouldReport(testFunc) {
+					continue
+				}
+				if pos, ok := unreachable[testFunc.name]; ok {
+					// Point at the dead defer, the test already looks covered
+					reportFinding(pass, result, pos, testFunc.name, ReasonUnreachableDefer)
+				} else {
+					reportUncoveredTest(pass, result, testFunc, reason, goleak.paths, testMain)
+					if config.CheckCommentedOut {
+						hintCommentedOutVerify(pass, result, testFunc, goleak.aliases)
+					}
+				}
+			} else if config.CheckParallel && testFunc.parallel {
+				// Per-test verification of a parallel test races with the other parallel tests
+				if filter.shouldReport(testFunc) {
+					reportFinding(pass, result, testFunc.pos, testFunc.name, ReasonParallelDefer)
 				}
 			}
+			if config.CheckDeferOrder && testFunc.suite == "" && filter.shouldReport(testFunc) {
+				if verify := misorderedVerifyDefer(pass.TypesInfo, testFunc.body, testFunc.param, goleak); verify != nil {
+					reportFinding(pass, result, verify.Pos(), testFunc.name, ReasonDeferOrder)
+				}
+			}
+			// Coverage that only some runs of the test get, e.g. not in -short mode
+			if testFunc.conditionalCover.IsValid() && !testFunc.unconditionalCover && filter.shouldReport(testFunc) {
+				reportFinding(pass, result, testFunc.conditionalCover, testFunc.name, ReasonConditionalCoverage)
+			}
 		}
 
-		return nil, nil
+		return result, nil
 	}
 }
 
@@ -151,29 +605,59 @@ func run(config *Config) func(*analysis.Pass) (interface{}, error) {
 type analysisResult struct {
 	hasTestMain         bool
 	hasVerifyTestMain   bool
+	usesVerify          bool // goleak verification is called anywhere in the package
 	testFuncs           []testFuncInfo
 	funcsCoveredByDefer map[string]bool
+	coveredBy           map[string]string // how each covered test is covered, for TestStatus.Detail
+	uncoveredSubtests   []testFuncInfo
+	examples            []testFuncInfo // runnable examples, only collected with CheckExamples
+	optionIssues        []optionIssue  // misused verification calls and options, reported regardless of coverage
+	testMainVerifyNone  []optionIssue  // goleak.VerifyNone calls in TestMain, reported unless it calls goleak.VerifyTestMain
+	testMainCallees     []*types.Func  // package functions called directly from TestMain
+	coverageDefers      []testFuncInfo // defer statements covering a test, pos is the defer
+	unreachableDefers   []testFuncInfo // dead defer goleak.VerifyNone statements, pos is the defer
 }
 
-// testFuncInfo holds information about a test function
-type testFuncInfo struct {
-	name     string
+// optionIssue describes a misused option passed to goleak verification
+type optionIssue struct {
+	testFunc string
 	pos      token.Pos
 	filename string
+	reason   Reason
+	message  string
+}
+
+// testFuncInfo holds information about a test function. For subtests, name is
+// the enclosing test function and pos is the position of the subtest closure.
+type testFuncInfo struct {
+	name       string
+	pos        token.Pos
+	filename   string
+	body       *ast.BlockStmt
+	param      *ast.Ident // the *testing.T parameter, if named
+	parallel   bool       // the test calls t.Parallel()
+	goroutines bool       // the test contains go statements
+	suite      string     // the suite type, for test methods of a testify suite
+	// requireDefer is set by a //leakcheck:require-defer directive, which
+	// makes the test verify itself even when TestMain covers the package
+	requireDefer bool
+	// conditionalCover is the first verification of the test nested in an if,
+	// loop or closure, and unconditionalCover whether another one runs every
+	// time; only recorded with FlagConditionalCoverage
+	conditionalCover   token.Pos
+	unconditionalCover bool
 }
 
 // analyzeTestFunctionsWithContext performs analysis with context and concurrency control
-func analyzeTestFunctionsWithContext(ctx context.Context, pass *analysis.Pass, goleakAlias string, semaphore chan struct{}) (*analysisResult, error) {
+func analyzeTestFunctionsWithContext(ctx context.Context, pass *analysis.Pass, config *Config, goleak goleakNames, helpers map[string]verifyHelper, semaphore chan struct{}) (*analysisResult, error) {
 	// For small number of files, use simple sequential processing
 	if len(pass.Files) <= 3 {
-		return analyzeTestFunctionsSequential(ctx, pass, goleakAlias)
-	}
-
-	result := &analysisResult{
-		funcsCoveredByDefer: make(map[string]bool, 64), // Pre-allocate with reasonable capacity
+		return analyzeTestFunctionsSequential(ctx, pass, config, goleak, helpers)
 	}
 
-	var mu sync.Mutex // Protect shared result data
+	// Each worker writes only to the slots of its files, merged in file order
+	// afterwards so that the result doesn't depend on scheduling
+	localResults := make([]*analysisResult, len(pass.Files))
 
 	// Process files with worker control
 	var wg sync.WaitGroup
@@ -186,9 +670,9 @@ func analyzeTestFunctionsWithContext(ctx context.Context, pass *analysis.Pass, g
 	}
 
 	// Create a channel to control file processing
-	fileChan := make(chan *ast.File, len(pass.Files))
-	for _, file := range pass.Files {
-		fileChan <- file
+	fileChan := make(chan int, len(pass.Files))
+	for i := range pass.Files {
+		fileChan <- i
 	}
 	close(fileChan)
 
@@ -198,11 +682,11 @@ func analyzeTestFunctionsWithContext(ctx context.Context, pass *analysis.Pass, g
 		go func() {
 			defer wg.Done()
 
-			for file := range fileChan {
+			for i := range fileChan {
 				select {
 				case <-ctx.Done():
 					select {
-					case errChan <- ctx.Err():
+					case errChan <- timeoutError(pass, config, "", ctx.Err()):
 					default:
 					}
 					return
@@ -210,12 +694,7 @@ func analyzeTestFunctionsWithContext(ctx context.Context, pass *analysis.Pass, g
 				}
 
 				// Process this file
-				localResult := processFileForAnalysis(file, pass, goleakAlias)
-
-				// Merge results with mutex protection
-				mu.Lock()
-				mergeResults(result, localResult)
-				mu.Unlock()
+				localResults[i] = processFileForAnalysis(pass.Files[i], pass, config, goleak, helpers)
 			}
 		}()
 	}
@@ -233,14 +712,20 @@ func analyzeTestFunctionsWithContext(ctx context.Context, pass *analysis.Pass, g
 			return nil, err
 		}
 	case <-ctx.Done():
-		return nil, ctx.Err()
+		return nil, timeoutError(pass, config, "", ctx.Err())
 	}
 
+	result := &analysisResult{
+		funcsCoveredByDefer: make(map[string]bool, 64), // Pre-allocate with reasonable capacity
+	}
+	for _, localResult := range localResults {
+		mergeResults(result, localResult)
+	}
 	return result, nil
 }
 
 // analyzeTestFunctionsSequential performs sequential analysis for small number of files
-func analyzeTestFunctionsSequential(ctx context.Context, pass *analysis.Pass, goleakAlias string) (*analysisResult, error) {
+func analyzeTestFunctionsSequential(ctx context.Context, pass *analysis.Pass, config *Config, goleak goleakNames, helpers map[string]verifyHelper) (*analysisResult, error) {
 	result := &analysisResult{
 		funcsCoveredByDefer: make(map[string]bool, 32),
 	}
@@ -248,11 +733,11 @@ func analyzeTestFunctionsSequential(ctx context.Context, pass *analysis.Pass, go
 	for _, file := range pass.Files {
 		select {
 		case <-ctx.Done():
-			return nil, ctx.Err()
+			return nil, timeoutError(pass, config, pass.Fset.Position(file.Pos()).Filename, ctx.Err())
 		default:
 		}
 
-		localResult := processFileForAnalysis(file, pass, goleakAlias)
+		localResult := processFileForAnalysis(file, pass, config, goleak, helpers)
 		mergeResults(result, localResult)
 	}
 
@@ -267,17 +752,58 @@ func mergeResults(result, localResult *analysisResult) {
 	if localResult.hasVerifyTestMain {
 		result.hasVerifyTestMain = true
 	}
+	if localResult.usesVerify {
+		result.usesVerify = true
+	}
 	result.testFuncs = append(result.testFuncs, localResult.testFuncs...)
+	result.uncoveredSubtests = append(result.uncoveredSubtests, localResult.uncoveredSubtests...)
+	result.examples = append(result.examples, localResult.examples...)
+	result.optionIssues = append(result.optionIssues, localResult.optionIssues...)
+	result.testMainVerifyNone = append(result.testMainVerifyNone, localResult.testMainVerifyNone...)
+	result.testMainCallees = append(result.testMainCallees, localResult.testMainCallees...)
+	result.coverageDefers = append(result.coverageDefers, localResult.coverageDefers...)
+	result.unreachableDefers = append(result.unreachableDefers, localResult.unreachableDefers...)
 	for k, v := range localResult.funcsCoveredByDefer {
 		result.funcsCoveredByDefer[k] = v
 	}
+	for testFunc, how := range localResult.coveredBy {
+		result.explainCoverage(testFunc, how)
+	}
+}
+
+// cover records that testFunc is covered, and how
+func (r *analysisResult) cover(testFunc, how string) {
+	r.funcsCoveredByDefer[testFunc] = true
+	r.explainCoverage(testFunc, how)
+}
+
+// explainCoverage records how testFunc is covered, unless a way is already
+// recorded: the first one found is the one explained
+func (r *analysisResult) explainCoverage(testFunc, how string) {
+	if r.coveredBy == nil {
+		r.coveredBy = make(map[string]string)
+	}
+	if _, ok := r.coveredBy[testFunc]; !ok {
+		r.coveredBy[testFunc] = how
+	}
+}
+
+// funcScope is what the walk of a file knows about the top-level function
+// declaration it is in: the test function it declares, if any, or whether it
+// is TestMain
+type funcScope struct {
+	testFunc string         // name of the test function, empty outside tests
+	param    *ast.Ident     // the test's *testing.T parameter
+	body     *ast.BlockStmt // body of the test function or TestMain
+	index    int            // index of the test in analysisResult.testFuncs
+	testMain bool           // only used to attribute option issues, see scanTestMain
 }
 
 // processFileForAnalysis processes a single file for test function analysis
-func processFileForAnalysis(file *ast.File, pass *analysis.Pass, goleakAlias string) *analysisResult {
-	// Early exit: check if this is a test file
+func processFileForAnalysis(file *ast.File, pass *analysis.Pass, config *Config, goleak goleakNames, helpers map[string]verifyHelper) *analysisResult {
+	// Early exit: check if this is a test file outside the excluded directories
 	filePos := pass.Fset.Position(file.Pos())
-	if !isTestFile(filePos.Filename) {
+	if !isTestFile(filePos.Filename) || isInExcludedDir(filePos.Filename, config.ExcludeDirs) || !config.IncludeVendor && isVendored(filePos.Filename) {
 		return &analysisResult{
 			funcsCoveredByDefer: make(map[string]bool, 0),
 		}
@@ -287,160 +813,1651 @@ func processFileForAnalysis(file *ast.File, pass *analysis.Pass, goleakAlias str
 		funcsCoveredByDefer: make(map[string]bool, 8), // Pre-allocate with reasonable capacity
 	}
 
-	var currentTestFunc string
-	var inTestMain bool
+	// t.Cleanup doesn't exist for code targeting older Go versions
+	cleanupCovers := supportsGoVersion(targetGoVersion(pass, config), goVersionCleanup)
 
-	// Walk through the AST of this specific file
-	ast.Inspect(file, func(n ast.Node) bool {
-		switch node := n.(type) {
-		case *ast.FuncDecl:
-			if node.Name == nil {
-				return true
+	// Calls made directly by a defer statement, whose arguments are evaluated
+	// when the defer statement executes rather than when the call runs
+	deferredCalls := make(map[*ast.CallExpr]bool)
+	// Variables holding goleak.VerifyNone, as in verify := goleak.VerifyNone
+	verifyVars := collectVerifyVars(pass.TypesInfo, file, config.GoleakImportPaths, config.VerifyFuncs)
+	if len(verifyVars) > 0 {
+		result.usesVerify = true
+	}
+
+	// enterFunc records the test function, suite method, TestMain or example
+	// fd declares, returning the scope its body is walked in
+	enterFunc := func(fd *ast.FuncDecl) funcScope {
+		scope := funcScope{body: fd.Body}
+		funcName := fd.Name.Name
+
+		suite := ""
+		if config.CheckSuites {
+			suite = suiteReceiver(pass.TypesInfo, fd)
+		}
+
+		if funcName == testMainFunc {
+			result.hasTestMain = true
+			scope.testMain = true
+			scanTestMain(pass, config, fd, goleak, result)
+			checkTestMainExit(pass, fd, filePos.Filename, goleak, result)
+			if config.CheckTestMainSetup {
+				checkTestMainSetup(pass, fd, filePos.Filename, goleak, result)
 			}
-			funcName := node.Name.Name
-			currentTestFunc = ""
-			inTestMain = false
-
-			if funcName == testMainFunc {
-				result.hasTestMain = true
-				inTestMain = true
-			} else if isTestFunction(funcName) {
-				currentTestFunc = funcName
-				testFunc := testFuncInfo{
-					name:     funcName,
-					pos:      node.Pos(),
-					filename: filePos.Filename,
-				}
-				result.testFuncs = append(result.testFuncs, testFunc)
+		} else if suite != "" && isTestFunction(funcName, config.TestPrefixes) {
+			// Suite methods are covered by the suite's teardown, not a defer
+			result.testFuncs = append(result.testFuncs, testFuncInfo{
+				name:       suite + "." + funcName,
+				pos:        fd.Pos(),
+				filename:   filePos.Filename,
+				body:       fd.Body,
+				suite:      suite,
+				goroutines: config.OnlyGoroutineStartingTests && fd.Body != nil && spawnsGoroutines(fd.Body),
+			})
+		} else if isTestFunc(pass.TypesInfo, fd, config.TestPrefixes) {
+			scope.testFunc = funcName
+			scope.param = firstParam(fd.Type)
+			testFunc := testFuncInfo{
+				name:         funcName,
+				pos:          fd.Pos(),
+				filename:     filePos.Filename,
+				body:         fd.Body,
+				param:        scope.param,
+				requireDefer: requiresDefer(fd.Doc),
+			}
+			if (config.TestMainSuggestThreshold > 0 || config.OnlyGoroutineStartingTests) && fd.Body != nil {
+				testFunc.goroutines = spawnsGoroutines(fd.Body)
 			}
+			scope.index = len(result.testFuncs)
+			result.testFuncs = append(result.testFuncs, testFunc)
+			if config.CheckSubtests && fd.Body != nil {
+				result.uncoveredSubtests = append(result.uncoveredSubtests, findUncoveredSubtests(pass.TypesInfo, fd.Body, funcName, filePos.Filename, goleak)...)
+			}
+		} else if config.CheckExamples && isRunnableExample(fd, file) {
+			result.examples = append(result.examples, testFuncInfo{
+				name:     funcName,
+				pos:      fd.Pos(),
+				filename: filePos.Filename,
+			})
+		}
+		return scope
+	}
+
+	// noteCondition records whether node, which covers the test of scope,
+	// runs every time the test does
+	noteCondition := func(scope funcScope, node ast.Node) {
+		if !config.FlagConditionalCoverage {
+			return
+		}
+		testFunc := &result.testFuncs[scope.index]
+		if isUnconditional(scope.body, node) {
+			testFunc.unconditionalCover = true
+		} else if !testFunc.conditionalCover.IsValid() {
+			testFunc.conditionalCover = node.Pos()
+		}
+	}
 
+	// covered records that a defer, or a cleanup registration, node covers
+	// the test of scope
+	covered := func(scope funcScope, node ast.Node, how string) {
+		result.cover(scope.testFunc, fmt.Sprintf("%s at line %d", how, pass.Fset.Position(node.Pos()).Line))
+		result.coverageDefers = append(result.coverageDefers, testFuncInfo{
+			name:     scope.testFunc,
+			pos:      node.Pos(),
+			filename: filePos.Filename,
+		})
+		noteCondition(scope, node)
+	}
+
+	// visit walks the nodes of a single declaration, closures included, with
+	// its scope
+	visit := func(scope funcScope, n ast.Node) bool {
+		inTest := scope.testFunc != ""
+		switch node := n.(type) {
 		case *ast.CallExpr:
 			if sel, ok := node.Fun.(*ast.SelectorExpr); ok {
-				if inTestMain && isGoleakCall(sel, verifyTestMain, goleakAlias) {
-					result.hasVerifyTestMain = true
+				if isGoleakCall(pass.TypesInfo, sel, goleak, goleak.verify...) || isGoleakCall(pass.TypesInfo, sel, goleak, goleak.verifyTestMain...) {
+					result.usesVerify = true
+					funcName := scope.testFunc
+					if scope.testMain {
+						funcName = testMainFunc
+					}
+					if config.CheckOptions {
+						checkVerifyOptions(pass, node, funcName, filePos.Filename, goleak, deferredCalls[node], result)
+					}
+					if len(config.IgnoredTopFunctions) > 0 {
+						checkIgnoredTopFunctions(pass.TypesInfo, node, funcName, filePos.Filename, goleak, config.IgnoredTopFunctions, result)
+					}
+				}
+				// VerifyTestMain runs the tests again and exits the process, it can't verify a single test
+				if inTest && isGoleakCall(pass.TypesInfo, sel, goleak, goleak.verifyTestMain...) {
+					result.optionIssues = append(result.optionIssues, optionIssue{
+						testFunc: scope.testFunc,
+						pos:      node.Pos(),
+						filename: filePos.Filename,
+						reason:   ReasonVerifyTestMainInTest,
+						message:  fmt.Sprintf("%s.%s in test function %s doesn't cover the test and exits the process mid-test; call it from %s, or defer %s.%s(t) in the test", goleak.nameIn(sel), sel.Sel.Name, scope.testFunc, testMainFunc, goleak.nameIn(sel), verifyNone),
+					})
+				}
+				// VerifyNone in TestMain is usually meant as VerifyTestMain, which
+				// verifies after the tests and sets the exit code
+				if scope.testMain && isGoleakCall(pass.TypesInfo, sel, goleak, goleak.verify...) {
+					result.testMainVerifyNone = append(result.testMainVerifyNone, optionIssue{
+						testFunc: testMainFunc,
+						pos:      node.Pos(),
+						filename: filePos.Filename,
+						reason:   ReasonVerifyNoneInTestMain,
+						message:  fmt.Sprintf("%s.%s in %s doesn't cover the package's tests; call %s.%s(m) instead of m.Run, which runs the tests and then fails the binary on leaks", goleak.nameIn(sel), sel.Sel.Name, testMainFunc, goleak.nameIn(sel), verifyTestMain),
+					})
+				}
+				// t.Cleanup(func() { goleak.VerifyNone(t) }) covers the test like a defer
+				if inTest && cleanupCovers && isVerifyCleanupWith(pass.TypesInfo, node, scope.param, goleak) && (!config.Strict || isUnconditional(scope.body, node)) {
+					covered(scope, node, fmt.Sprintf("registers %s.%s with t.%s", goleak.alias, verifyNone, cleanupMethod))
+				}
+				// Only the test's own t makes it parallel, not that of a subtest
+				if inTest && sel.Sel.Name == parallelMethod && len(node.Args) == 0 && refersTo(pass.TypesInfo, sel.X, scope.param) {
+					result.testFuncs[scope.index].parallel = true
 				}
 			}
+			// setup(t) covers the test when the helper registers the verification
+			// with t.Cleanup, without being deferred
+			if inTest && cleanupCovers && !deferredCalls[node] && isHelperCallWith(pass.TypesInfo, node, scope.param, helpers) == helperRegistersCleanup && (!config.Strict || isUnconditional(scope.body, node)) {
+				result.cover(scope.testFunc, fmt.Sprintf("calls %s, which registers %s.%s with t.%s, at line %d", types.ExprString(node.Fun), goleak.alias, verifyNone, cleanupMethod, pass.Fset.Position(node.Pos()).Line))
+				noteCondition(scope, node)
+			}
 
 		case *ast.DeferStmt:
-			if currentTestFunc != "" {
-				if call, ok := node.Call.Fun.(*ast.SelectorExpr); ok {
-					if isGoleakCall(call, verifyNone, goleakAlias) {
-						result.funcsCoveredByDefer[currentTestFunc] = true
-					}
+			deferredCalls[node.Call] = true
+			if !inTest || config.Strict && !isUnconditional(scope.body, node) {
+				return true
+			}
+			// A defer after the test has already returned never registers
+			if isUnreachable(pass.TypesInfo, scope.body, node) {
+				if isVerifyNoneWith(pass.TypesInfo, node.Call, scope.param, goleak) || isVerifyValueCallWith(pass.TypesInfo, node.Call, scope.param, verifyVars, config.GoleakImportPaths, config.VerifyFuncs) || deferredClosureVerifies(pass.TypesInfo, scope.body, node.Call, scope.param, goleak) {
+					result.unreachableDefers = append(result.unreachableDefers, testFuncInfo{
+						name:     scope.testFunc,
+						pos:      node.Pos(),
+						filename: filePos.Filename,
+					})
+				}
+				return true
+			}
+			if isVerifyNoneWith(pass.TypesInfo, node.Call, scope.param, goleak) {
+				covered(scope, node, "defers "+types.ExprString(node.Call.Fun))
+			}
+			// defer func() { goleak.VerifyNone(t) }(), or the same closure
+			// stored in a local variable and deferred by name
+			if deferredClosureVerifies(pass.TypesInfo, scope.body, node.Call, scope.param, goleak) {
+				how := fmt.Sprintf("defers a closure calling %s.%s", goleak.alias, verifyNone)
+				if ident, ok := node.Call.Fun.(*ast.Ident); ok {
+					how = fmt.Sprintf("defers %s, a closure calling %s.%s,", ident.Name, goleak.alias, verifyNone)
 				}
+				covered(scope, node, how)
+			}
+			line := pass.Fset.Position(node.Pos()).Line
+			if isHelperCallWith(pass.TypesInfo, node.Call, scope.param, helpers) != 0 {
+				result.cover(scope.testFunc, fmt.Sprintf("defers %s, which verifies with %s.%s, at line %d", types.ExprString(node.Call.Fun), goleak.alias, verifyNone, line))
+				noteCondition(scope, node)
+			}
+			if isVerifyValueCallWith(pass.TypesInfo, node.Call, scope.param, verifyVars, config.GoleakImportPaths, config.VerifyFuncs) {
+				result.cover(scope.testFunc, fmt.Sprintf("defers %s, which holds %s.%s, at line %d", types.ExprString(node.Call.Fun), goleak.alias, verifyNone, line))
+				noteCondition(scope, node)
 			}
 		}
 		return true
-	})
-
-	return result
-}
+	}
 
-// Constants for goleak package paths and method names
-const (
-	goleakUberPath   = `"go.uber.org/goleak"`
-	goleakGithubPath = `"github.com/uber-go/goleak"`
-	defaultAlias     = "goleak"
-	verifyTestMain   = "VerifyTestMain"
-	verifyNone       = "VerifyNone"
-	testPrefix       = "Test"
-	testMainFunc     = "TestMain"
-	testFileSuffix   = "_test.go"
-)
+	// Each top-level declaration is walked with its own scope, so nothing
+	// carries over from one function to the next. Closures in package-level
+	// variables belong to no function, but their goleak calls still count.
+	for _, decl := range file.Decls {
+		var scope funcScope
+		var root ast.Node = decl
+		if fd, ok := decl.(*ast.FuncDecl); ok {
+			if fd.Name == nil {
+				continue
+			}
+			scope = enterFunc(fd)
+			if fd.Body == nil {
+				continue
+			}
+			root = fd.Body
+		}
+		ast.Inspect(root, func(n ast.Node) bool { return visit(scope, n) })
+	}
 
-// isTestFile checks if the filename indicates a test file
-func isTestFile(filename string) bool {
-	return strings.HasSuffix(filename, testFileSuffix)
+	return result
 }
 
-// isTestFunction checks if a function name is a test function
-func isTestFunction(name string) bool {
-	return strings.HasPrefix(name, testPrefix) && name != testMainFunc
+// scanTestMain records whether the body of TestMain calls goleak.VerifyTestMain,
+// including from closures declared in it such as
+// run := func() { goleak.VerifyTestMain(m) }, and the package functions it
+// calls directly, which callsVerifyTestMain follows. In strict mode only
+// unconditional calls count.
+func scanTestMain(pass *analysis.Pass, config *Config, testMain *ast.FuncDecl, goleak goleakNames, result *analysisResult) {
+	if testMain.Body == nil {
+		return
+	}
+	ast.Inspect(testMain.Body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		if config.Strict && !isUnconditional(testMain.Body, call) {
+			return true
+		}
+		switch fun := call.Fun.(type) {
+		case *ast.Ident:
+			if pass.TypesInfo == nil {
+				break
+			}
+			if fn, ok := pass.TypesInfo.Uses[fun].(*types.Func); ok && fn.Pkg() == pass.Pkg {
+				result.testMainCallees = append(result.testMainCallees, fn)
+			}
+		case *ast.SelectorExpr:
+			if isGoleakCall(pass.TypesInfo, fun, goleak, goleak.verifyTestMain...) {
+				result.hasVerifyTestMain = true
+			}
+		}
+		return true
+	})
 }
 
-// isGoleakCall checks if a selector expression is a call to goleak with the specified method
-func isGoleakCall(sel *ast.SelectorExpr, method, alias string) bool {
-	if sel.Sel.Name != method {
-		return false
+// checkTestMainExit records goleak.VerifyTestMain calls in TestMain whose exit
+// code, for verification functions that return it rather than exiting, never
+// reaches os.Exit: the result is discarded, or stored in a variable that is
+// not passed to os.Exit. Without type information nothing is checked.
+func checkTestMainExit(pass *analysis.Pass, testMain *ast.FuncDecl, filename string, goleak goleakNames, result *analysisResult) {
+	info := pass.TypesInfo
+	if testMain.Body == nil || info == nil {
+		return
 	}
-
-	if ident, ok := sel.X.(*ast.Ident); ok {
-		return ident.Name == alias
+	// verifyCall returns the call if expr calls a TestMain verification function with a result
+	verifyCall := func(expr ast.Expr) *ast.CallExpr {
+		call, ok := expr.(*ast.CallExpr)
+		if !ok {
+			return nil
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || !isGoleakCall(info, sel, goleak, goleak.verifyTestMain...) {
+			return nil
+		}
+		if tuple, ok := info.TypeOf(call).(*types.Tuple); ok && tuple.Len() == 0 {
+			return nil
+		}
+		return call
+	}
+	discarded := func(call *ast.CallExpr) string {
+		return fmt.Sprintf("the exit code returned by %s.%s in %s is discarded, so leaks don't fail the tests; pass it to os.Exit", goleak.nameIn(call.Fun.(*ast.SelectorExpr)), call.Fun.(*ast.SelectorExpr).Sel.Name, testMainFunc)
+	}
+	report := func(call *ast.CallExpr, message string) {
+		result.optionIssues = append(result.optionIssues, optionIssue{
+			testFunc: testMainFunc,
+			pos:      call.Pos(),
+			filename: filename,
+			reason:   ReasonTestMainExitCode,
+			message:  message,
+		})
 	}
 
-	return false
+	ast.Inspect(testMain.Body, func(n ast.Node) bool {
+		switch node := n.(type) {
+		case *ast.ExprStmt:
+			if call := verifyCall(node.X); call != nil {
+				report(call, discarded(call))
+			}
+		case *ast.AssignStmt:
+			if len(node.Lhs) != len(node.Rhs) {
+				return true
+			}
+			for i, rhs := range node.Rhs {
+				call := verifyCall(rhs)
+				ident, ok := node.Lhs[i].(*ast.Ident)
+				if call == nil || !ok {
+					continue
+				}
+				if ident.Name == blankIdent {
+					report(call, discarded(call))
+				} else if !exitsWith(info, testMain.Body, info.ObjectOf(ident)) {
+					sel := call.Fun.(*ast.SelectorExpr)
+					report(call, fmt.Sprintf("the exit code returned by %s.%s is stored in %s but never passed to os.Exit, so leaks don't fail the tests", goleak.nameIn(sel), sel.Sel.Name, ident.Name))
+				}
+			}
+		}
+		return true
+	})
 }
 
-// getGoleakAlias checks if any file imports goleak and returns its alias/name
-func getGoleakAlias(files []*ast.File) string {
-	for _, file := range files {
-		// Early exit if no imports
-		if len(file.Imports) == 0 {
-			continue
+// checkTestMainSetup records the go statements of TestMain that precede the
+// call running the tests, the first goleak.VerifyTestMain or m.Run call in
+// source order. Goroutines started in closures are left out, since those may
+// only be called later, and so is everything when the verification ignores
+// the goroutines already running with goleak.IgnoreCurrent(). Without type
+// information nothing is checked.
+func checkTestMainSetup(pass *analysis.Pass, testMain *ast.FuncDecl, filename string, goleak goleakNames, result *analysisResult) {
+	info := pass.TypesInfo
+	if testMain.Body == nil || info == nil {
+		return
+	}
+	var run *ast.CallExpr
+	ast.Inspect(testMain.Body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || run != nil {
+			return run == nil
+		}
+		if sel, ok := call.Fun.(*ast.SelectorExpr); ok && (isGoleakCall(info, sel, goleak, goleak.verifyTestMain...) || isTestingMRun(info, sel)) {
+			run = call
 		}
+		return run == nil
+	})
+	if run == nil || ignoresCurrent(info, run, goleak) {
+		return
+	}
 
-		for _, imp := range file.Imports {
-			if imp.Path != nil && (imp.Path.Value == goleakUberPath || imp.Path.Value == goleakGithubPath) {
-				if imp.Name != nil {
-					return imp.Name.Name
-				}
-				return defaultAlias
+	ast.Inspect(testMain.Body, func(n ast.Node) bool {
+		switch node := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.GoStmt:
+			if node.Pos() < run.Pos() {
+				result.optionIssues = append(result.optionIssues, optionIssue{
+					testFunc: testMainFunc,
+					pos:      node.Pos(),
+					filename: filename,
+					reason:   ReasonTestMainSetupGoroutine,
+					message:  fmt.Sprintf("goroutine started in %s before the tests run is still running when goleak verifies them; stop it before, or ignore it with %s.%s()", testMainFunc, goleak.alias, ignoreCurrent),
+				})
 			}
+			return false
 		}
-	}
-	return ""
+		return true
+	})
 }
 
-// shouldExcludePackage checks if a package should be excluded
-func shouldExcludePackage(pkgPath string, config *Config) bool {
-	if config.ExcludePackages == "" {
+// isTestingMRun checks if sel is the Run method of a *testing.M
+func isTestingMRun(info *types.Info, sel *ast.SelectorExpr) bool {
+	if sel.Sel.Name != "Run" {
 		return false
 	}
-	return matchesAnyPattern(pkgPath, config.ExcludePackages)
+	named := namedType(info.TypeOf(sel.X))
+	return named != nil && named.Obj().Name() == "M" && named.Obj().Pkg() != nil && named.Obj().Pkg().Path() == "testing"
 }
 
-// shouldExcludeFileWithConfig checks if a file should be excluded
-func shouldExcludeFileWithConfig(filename string, config *Config) bool {
-	// Extract just the filename without path for pattern matching
-	justFilename := filename
-	if lastSlash := strings.LastIndex(filename, "/"); lastSlash >= 0 {
-		justFilename = filename[lastSlash+1:]
-	}
-	if lastBackslash := strings.LastIndex(justFilename, "\\"); lastBackslash >= 0 {
-		justFilename = justFilename[lastBackslash+1:]
-	}
-
-	// First check standard exclusions against both full path and filename
-	if config.ExcludeFiles != "" {
-		if matchesAnyPattern(filename, config.ExcludeFiles) || matchesAnyPattern(justFilename, config.ExcludeFiles) {
+// ignoresCurrent checks if call is passed goleak.IgnoreCurrent() among its options
+func ignoresCurrent(info *types.Info, call *ast.CallExpr, goleak goleakNames) bool {
+	for _, arg := range call.Args {
+		opt, ok := arg.(*ast.CallExpr)
+		if !ok {
+			continue
+		}
+		if sel, ok := opt.Fun.(*ast.SelectorExpr); ok && isGoleakCall(info, sel, goleak, ignoreCurrent) {
 			return true
 		}
 	}
-
 	return false
 }
 
-// matchesAnyPattern checks if a string matches any of the comma-separated patterns
-func matchesAnyPattern(str, patterns string) bool {
-	if patterns == "" {
+// exitsWith checks if body calls os.Exit with the variable obj
+func exitsWith(info *types.Info, body *ast.BlockStmt, obj types.Object) bool {
+	if obj == nil {
 		return false
 	}
+	found := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) != 1 {
+			return !found
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok {
+			return !found
+		}
+		fn, ok := info.Uses[sel.Sel].(*types.Func)
+		if !ok || fn.Pkg() == nil || fn.Pkg().Path() != "os" || fn.Name() != "Exit" {
+			return !found
+		}
+		if ident, ok := call.Args[0].(*ast.Ident); ok && info.Uses[ident] == obj {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
 
-	// Avoid creating string slice if only one pattern
-	if !strings.Contains(patterns, ",") {
-		return matchesPattern(str, strings.TrimSpace(patterns))
+// callsVerifyTestMain checks if any of the functions, declared in any file of
+// the package, calls goleak.VerifyTestMain directly. Only one level of
+// indirection from TestMain is followed.
+func callsVerifyTestMain(pass *analysis.Pass, goleak goleakNames, funcs []*types.Func) bool {
+	if len(funcs) == 0 {
+		return false
 	}
-
-	for _, pattern := range strings.Split(patterns, ",") {
-		pattern = strings.TrimSpace(pattern)
-		if pattern != "" && matchesPattern(str, pattern) {
-			return true
+	wanted := make(map[types.Object]bool, len(funcs))
+	for _, fn := range funcs {
+		wanted[fn] = true
+	}
+	for _, file := range pass.Files {
+		for _, decl := range file.Decls {
+			fd, ok := decl.(*ast.FuncDecl)
+			if !ok || fd.Body == nil || !wanted[pass.TypesInfo.Defs[fd.Name]] {
+				continue
+			}
+			found := false
+			ast.Inspect(fd.Body, func(n ast.Node) bool {
+				if call, ok := n.(*ast.CallExpr); ok {
+					if sel, ok := call.Fun.(*ast.SelectorExpr); ok && isGoleakCall(pass.TypesInfo, sel, goleak, goleak.verifyTestMain...) {
+						found = true
+					}
+				}
+				return !found
+			})
+			if found {
+				return true
+			}
 		}
 	}
-
 	return false
 }
 
+// checkVerifyOptions records misuse of the options passed inline to a goleak
+// verification call. The first argument is the *testing.T or *testing.M and is skipped.
+func checkVerifyOptions(pass *analysis.Pass, call *ast.CallExpr, testFunc, filename string, goleak goleakNames, deferred bool, result *analysisResult) {
+	sel := call.Fun.(*ast.SelectorExpr)
+	if len(call.Args) < 2 {
+		return
+	}
+	for _, arg := range call.Args[1:] {
+		opt, ok := arg.(*ast.CallExpr)
+		if !ok {
+			continue
+		}
+		optSel, ok := opt.Fun.(*ast.SelectorExpr)
+		if !ok {
+			continue
+		}
+		if !isGoleakCall(pass.TypesInfo, optSel, goleak, optSel.Sel.Name) || !isOption(pass.TypesInfo, opt) {
+			continue
+		}
+		if known, ok := goleakOptions[optSel.Sel.Name]; !ok || known.testMainOnly && !slices.Contains(goleak.verifyTestMain, sel.Sel.Name) {
+			message := fmt.Sprintf("%s.%s is not a known goleak option; check its name and the goleak version", goleak.nameIn(optSel), optSel.Sel.Name)
+			if ok {
+				// goleak.VerifyNone fails the test when given such an option
+				message = fmt.Sprintf("%s.%s is only accepted by %s.%s, %s.%s fails the test with it", goleak.nameIn(optSel), optSel.Sel.Name, goleak.nameIn(optSel), verifyTestMain, goleak.nameIn(sel), sel.Sel.Name)
+			}
+			result.optionIssues = append(result.optionIssues, optionIssue{
+				testFunc: testFunc,
+				pos:      opt.Pos(),
+				filename: filename,
+				reason:   ReasonInvalidOption,
+				message:  message,
+			})
+			continue
+		}
+		switch {
+		case isGoleakCall(pass.TypesInfo, optSel, goleak, ignoreCurrent):
+			// The arguments of a deferred call are evaluated at the defer statement,
+			// which is the intended baseline; anywhere else the snapshot is taken
+			// right before verification and ignores every goroutine still running.
+			// VerifyTestMain evaluates its options before the tests run.
+			if deferred || !slices.Contains(goleak.verify, sel.Sel.Name) {
+				continue
+			}
+			result.optionIssues = append(result.optionIssues, optionIssue{
+				testFunc: testFunc,
+				pos:      opt.Pos(),
+				filename: filename,
+				reason:   ReasonIgnoreCurrentLate,
+				message:  fmt.Sprintf("%s.%s() is evaluated when %s.%s runs and hides leaked goroutines; defer the verification call directly or take the snapshot at the start of the test", goleak.nameIn(optSel), ignoreCurrent, goleak.nameIn(sel), sel.Sel.Name),
+			})
+		case isGoleakCall(pass.TypesInfo, optSel, goleak, ignoreTopFunction, ignoreAnyFunction):
+			if len(opt.Args) != 1 {
+				continue
+			}
+			lit, ok := opt.Args[0].(*ast.BasicLit)
+			if !ok || lit.Kind != token.STRING {
+				continue
+			}
+			name, err := strconv.Unquote(lit.Value)
+			if err != nil || ignoredFunctionExists(pass.Pkg, name) {
+				continue
+			}
+			result.optionIssues = append(result.optionIssues, optionIssue{
+				testFunc: testFunc,
+				pos:      lit.Pos(),
+				filename: filename,
+				reason:   ReasonUnknownIgnoredFunction,
+				message:  fmt.Sprintf("%s.%s ignores %q, which does not exist", goleak.nameIn(optSel), optSel.Sel.Name, name),
+			})
+		}
+	}
+}
+
+// isOption checks if expr is a value of the Option type of goleak, as
+// returned by its option constructors
+func isOption(info *types.Info, expr ast.Expr) bool {
+	named, ok := types.Unalias(info.TypeOf(expr)).(*types.Named)
+	return ok && named.Obj().Name() == optionType
+}
+
+// checkIgnoredTopFunctions records a goleak verification call that doesn't
+// ignore every one of the expected functions. The first argument is the
+// *testing.T or *testing.M and is skipped.
+func checkIgnoredTopFunctions(info *types.Info, call *ast.CallExpr, testFunc, filename string, goleak goleakNames, expected []string, result *analysisResult) {
+	if call.Ellipsis.IsValid() || len(call.Args) == 0 {
+		return
+	}
+	ignored := make(map[string]bool, len(call.Args))
+	for _, arg := range call.Args[1:] {
+		opt, ok := arg.(*ast.CallExpr)
+		if !ok {
+			return
+		}
+		optSel, ok := opt.Fun.(*ast.SelectorExpr)
+		if !ok || !isGoleakCall(info, optSel, goleak, optSel.Sel.Name) {
+			// Options built elsewhere may ignore anything
+			return
+		}
+		if (optSel.Sel.Name != ignoreTopFunction && optSel.Sel.Name != ignoreAnyFunction) || len(opt.Args) != 1 {
+			continue
+		}
+		if lit, ok := opt.Args[0].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+			if name, err := strconv.Unquote(lit.Value); err == nil {
+				ignored[name] = true
+			}
+		}
+	}
+
+	var missing []string
+	for _, name := range expected {
+		if !ignored[name] {
+			missing = append(missing, strconv.Quote(name))
+		}
+	}
+	if len(missing) == 0 {
+		return
+	}
+	sel := call.Fun.(*ast.SelectorExpr)
+	result.optionIssues = append(result.optionIssues, optionIssue{
+		testFunc: testFunc,
+		pos:      call.Pos(),
+		filename: filename,
+		reason:   ReasonMissingIgnoredTopFunction,
+		message:  fmt.Sprintf("%s.%s does not ignore the expected goroutines of %s (missing %s.%s)", goleak.nameIn(sel), sel.Sel.Name, strings.Join(missing, ", "), goleak.nameIn(sel), ignoreTopFunction),
+	})
+}
+
+// ignoredFunctionExists checks if name, a fully qualified function as it
+// appears in a goroutine stack such as "net/http.(*persistConn).readLoop",
+// refers to an existing function or method. Names in packages that are neither
+// pkg nor imported by it can't be checked and are assumed to exist.
+func ignoredFunctionExists(pkg *types.Package, name string) bool {
+	slash := strings.LastIndex(name, "/")
+	dot := strings.Index(name[slash+1:], ".")
+	if dot < 0 {
+		// Not qualified with a package, so it can never match a stack frame
+		return false
+	}
+	pkgPath, rest := name[:slash+1+dot], name[slash+1+dot+1:]
+
+	target := findImportedPackage(pkg, pkgPath)
+	if target == nil {
+		return true
+	}
+
+	// Methods are named (*T).Method or T.Method
+	var typeName string
+	if strings.HasPrefix(rest, "(*") {
+		end := strings.Index(rest, ").")
+		if end < 0 {
+			return false
+		}
+		typeName, rest = rest[2:end], rest[end+2:]
+	}
+	first, method, _ := strings.Cut(rest, ".")
+	if typeName == "" {
+		obj := target.Scope().Lookup(first)
+		if obj == nil {
+			return false
+		}
+		if _, ok := obj.(*types.TypeName); !ok {
+			// Anything after a function name is a closure such as func1
+			return true
+		}
+		typeName = first
+	} else {
+		method = first
+	}
+
+	obj, ok := target.Scope().Lookup(typeName).(*types.TypeName)
+	if !ok {
+		return false
+	}
+	method, _, _ = strings.Cut(method, ".")
+	found, _, _ := types.LookupFieldOrMethod(types.NewPointer(obj.Type()), true, target, method)
+	_, ok = found.(*types.Func)
+	return ok
+}
+
+// findImportedPackage returns pkg itself or one of its direct imports with the given path
+func findImportedPackage(pkg *types.Package, path string) *types.Package {
+	if pkg.Path() == path {
+		return pkg
+	}
+	for _, imp := range pkg.Imports() {
+		if imp.Path() == path {
+			return imp
+		}
+	}
+	return nil
+}
+
+// findUncoveredSubtests returns the t.Run closures in body that start goroutines
+// but don't defer goleak.VerifyNone with the subtest's own *testing.T
+func findUncoveredSubtests(info *types.Info, body *ast.BlockStmt, testName, filename string, goleak goleakNames) []testFuncInfo {
+	var subtests []testFuncInfo
+	ast.Inspect(body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		lit, param := subtestClosure(call)
+		if lit == nil {
+			return true
+		}
+		if spawnsGoroutines(lit.Body) && !defersVerifyNoneWith(info, lit.Body, param, goleak) {
+			subtests = append(subtests, testFuncInfo{
+				name:     testName,
+				pos:      lit.Pos(),
+				filename: filename,
+			})
+		}
+		return true
+	})
+	return subtests
+}
+
+// coveredBySubtests checks if body, the body of a test with parameter param,
+// runs at least one subtest with param.Run, every subtest is a function
+// literal deferring goleak.VerifyNone with its own *testing.T, and body starts
+// no goroutines outside of them
+func coveredBySubtests(info *types.Info, body *ast.BlockStmt, param *ast.Ident, goleak goleakNames) bool {
+	if body == nil || param == nil {
+		return false
+	}
+	subtests := 0
+	covered := true
+	ast.Inspect(body, func(n ast.Node) bool {
+		if !covered {
+			return false
+		}
+		switch node := n.(type) {
+		case *ast.GoStmt:
+			covered = false
+		case *ast.CallExpr:
+			sel, ok := node.Fun.(*ast.SelectorExpr)
+			if !ok || sel.Sel.Name != subtestRun || len(node.Args) != 2 || !refersTo(info, sel.X, param) {
+				return true
+			}
+			// A subtest run by a named function can't be checked
+			lit, subtestParam := subtestClosure(node)
+			if lit == nil || !defersVerifyNoneWith(info, lit.Body, subtestParam, goleak) {
+				covered = false
+				return false
+			}
+			// The subtest verifies its own goroutines
+			subtests++
+			return false
+		}
+		return true
+	})
+	return covered && subtests > 0
+}
+
+// subtestClosure returns the function literal and its *testing.T parameter
+// if call has the form t.Run(name, func(t *testing.T) { ... })
+func subtestClosure(call *ast.CallExpr) (*ast.FuncLit, *ast.Ident) {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != subtestRun || len(call.Args) != 2 {
+		return nil, nil
+	}
+	lit, ok := call.Args[1].(*ast.FuncLit)
+	if !ok || lit.Body == nil || lit.Type.Params == nil || len(lit.Type.Params.List) != 1 {
+		return nil, nil
+	}
+	param := lit.Type.Params.List[0]
+	if len(param.Names) != 1 || !isTestingT(param.Type) {
+		return nil, nil
+	}
+	return lit, param.Names[0]
+}
+
+// firstParam returns the identifier of a function's first parameter, if it is named
+func firstParam(fn *ast.FuncType) *ast.Ident {
+	if fn.Params == nil || len(fn.Params.List) == 0 || len(fn.Params.List[0].Names) == 0 {
+		return nil
+	}
+	return fn.Params.List[0].Names[0]
+}
+
+// isTestingT checks if expr is the type expression *testing.T
+func isTestingT(expr ast.Expr) bool {
+	star, ok := expr.(*ast.StarExpr)
+	if !ok {
+		return false
+	}
+	sel, ok := star.X.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "T" {
+		return false
+	}
+	ident, ok := sel.X.(*ast.Ident)
+	return ok && ident.Name == "testing"
+}
+
+// spawnsGoroutines checks if a function body contains any go statements
+func spawnsGoroutines(body *ast.BlockStmt) bool {
+	found := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		if _, ok := n.(*ast.GoStmt); ok {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// defersVerifyNoneWith checks if body defers goleak.VerifyNone with param as its first argument
+func defersVerifyNoneWith(info *types.Info, body *ast.BlockStmt, param *ast.Ident, goleak goleakNames) bool {
+	found := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		if deferStmt, ok := n.(*ast.DeferStmt); ok && isVerifyNoneWith(info, deferStmt.Call, param, goleak) {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// isVerifyNoneWith checks if call is goleak.VerifyNone with param as its first argument
+func isVerifyNoneWith(info *types.Info, call *ast.CallExpr, param *ast.Ident, goleak goleakNames) bool {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || !isGoleakCall(info, sel, goleak, goleak.verify...) || len(call.Args) == 0 {
+		return false
+	}
+	return refersTo(info, call.Args[0], param)
+}
+
+// deferredClosureVerifies checks if call, made by a defer statement in body,
+// runs a function literal calling goleak.VerifyNone with param: either the
+// literal itself, or a local variable of body holding it, as in
+// cleanup := func() { goleak.VerifyNone(t) }; defer cleanup()
+func deferredClosureVerifies(info *types.Info, body *ast.BlockStmt, call *ast.CallExpr, param *ast.Ident, goleak goleakNames) bool {
+	var lit *ast.FuncLit
+	switch fun := ast.Unparen(call.Fun).(type) {
+	case *ast.FuncLit:
+		lit = fun
+	case *ast.Ident:
+		if info != nil {
+			lit = localFuncLit(info, body, info.Uses[fun])
+		}
+	}
+	return lit != nil && callsVerifyNoneWith(info, lit.Body, param, goleak)
+}
+
+// localFuncLit returns the function literal held by obj when obj is a
+// variable declared in body and assigned only once, to that literal. A
+// variable assigned again may hold another function when it is called.
+func localFuncLit(info *types.Info, body *ast.BlockStmt, obj types.Object) *ast.FuncLit {
+	v, ok := obj.(*types.Var)
+	if !ok || body == nil || v.Pos() < body.Pos() || v.Pos() >= body.End() {
+		return nil
+	}
+	var lit *ast.FuncLit
+	assignments := 0
+	assign := func(lhs, rhs ast.Expr) {
+		if ident, ok := ast.Unparen(lhs).(*ast.Ident); ok && info.ObjectOf(ident) == obj {
+			assignments++
+			lit, _ = ast.Unparen(rhs).(*ast.FuncLit)
+		}
+	}
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch node := n.(type) {
+		case *ast.AssignStmt:
+			for i, lhs := range node.Lhs {
+				var rhs ast.Expr
+				if len(node.Lhs) == len(node.Rhs) {
+					rhs = node.Rhs[i]
+				}
+				assign(lhs, rhs)
+			}
+		case *ast.ValueSpec:
+			for i, name := range node.Names {
+				var rhs ast.Expr
+				if len(node.Names) == len(node.Values) {
+					rhs = node.Values[i]
+				}
+				assign(name, rhs)
+			}
+		}
+		return true
+	})
+	if assignments != 1 {
+		return nil
+	}
+	return lit
+}
+
+// isVerifyCleanupWith checks if call is param.Cleanup with a function literal
+// that calls goleak.VerifyNone with param
+func isVerifyCleanupWith(info *types.Info, call *ast.CallExpr, param *ast.Ident, goleak goleakNames) bool {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != cleanupMethod || len(call.Args) != 1 || !refersTo(info, sel.X, param) {
+		return false
+	}
+	lit, ok := call.Args[0].(*ast.FuncLit)
+	return ok && callsVerifyNoneWith(info, lit.Body, param, goleak)
+}
+
+// isUnconditional checks if node always runs when body runs, i.e. it is part
+// of a top-level statement of body rather than nested in a branch, loop or
+// function literal
+func isUnconditional(body *ast.BlockStmt, node ast.Node) bool {
+	if body == nil {
+		return false
+	}
+	found := false
+	for _, stmt := range body.List {
+		ast.Inspect(stmt, func(n ast.Node) bool {
+			if found {
+				return false
+			}
+			if n == node {
+				found = true
+				return false
+			}
+			switch n.(type) {
+			case *ast.FuncLit, *ast.BlockStmt, *ast.IfStmt, *ast.ForStmt, *ast.RangeStmt,
+				*ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt, *ast.BinaryExpr:
+				return false
+			}
+			return true
+		})
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+// isUnreachable checks if node is a statement of body that follows a
+// terminating statement of body, such as a return or a call to t.Fatal. A
+// label after the terminating statement may be the target of a goto and makes
+// the rest of the body reachable again.
+func isUnreachable(info *types.Info, body *ast.BlockStmt, node ast.Node) bool {
+	if body == nil {
+		return false
+	}
+	terminated := false
+	for _, stmt := range body.List {
+		if _, ok := stmt.(*ast.LabeledStmt); ok {
+			terminated = false
+		}
+		if stmt == node {
+			return terminated
+		}
+		if isTerminating(info, stmt) {
+			terminated = true
+		}
+	}
+	return false
+}
+
+// misorderedVerifyDefer returns the first defer goleak.VerifyNone(param) in
+// body if another defer of the same function precedes it, since deferred calls
+// run in reverse order. Defers in closures belong to the closure and are
+// ignored.
+func misorderedVerifyDefer(info *types.Info, body *ast.BlockStmt, param *ast.Ident, goleak goleakNames) *ast.DeferStmt {
+	if body == nil {
+		return nil
+	}
+	var verify *ast.DeferStmt
+	deferredBefore, done := false, false
+	ast.Inspect(body, func(n ast.Node) bool {
+		if done {
+			return false
+		}
+		switch node := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.DeferStmt:
+			if isVerifyNoneWith(info, node.Call, param, goleak) {
+				// Only the first verification matters, later ones run even earlier
+				if deferredBefore {
+					verify = node
+				}
+				done = true
+				return false
+			}
+			deferredBefore = true
+		}
+		return true
+	})
+	return verify
+}
+
+// isTerminating checks if stmt always ends the function: a return, a panic,
+// or a call to a testing method that stops the test such as t.Fatal or t.Skip
+func isTerminating(info *types.Info, stmt ast.Stmt) bool {
+	switch s := stmt.(type) {
+	case *ast.ReturnStmt:
+		return true
+	case *ast.ExprStmt:
+		call, ok := s.X.(*ast.CallExpr)
+		if !ok || info == nil {
+			return false
+		}
+		switch fun := call.Fun.(type) {
+		case *ast.Ident:
+			_, builtin := info.Uses[fun].(*types.Builtin)
+			return builtin && fun.Name == "panic"
+		case *ast.SelectorExpr:
+			if !stopsTest[fun.Sel.Name] {
+				return false
+			}
+			fn, ok := info.Uses[fun.Sel].(*types.Func)
+			return ok && fn.Pkg() != nil && fn.Pkg().Path() == "testing"
+		}
+	}
+	return false
+}
+
+// stopsTest holds the testing methods that end the test by calling runtime.Goexit
+var stopsTest = map[string]bool{
+	"Fatal": true, "Fatalf": true, "FailNow": true,
+	"Skip": true, "Skipf": true, "SkipNow": true,
+}
+
+// collectVerifyVars returns the variables in file that are assigned
+// goleak.VerifyNone, resolved through type information
+func collectVerifyVars(info *types.Info, file *ast.File, paths, verifyFuncs []string) map[types.Object]bool {
+	vars := make(map[types.Object]bool)
+	if info == nil {
+		return vars
+	}
+	bind := func(lhs []ast.Expr, rhs []ast.Expr) {
+		if len(lhs) != len(rhs) {
+			return
+		}
+		for i, expr := range rhs {
+			sel, ok := expr.(*ast.SelectorExpr)
+			if !ok || !isGoleakFunc(info.Uses[sel.Sel], paths, verifyFuncs...) {
+				continue
+			}
+			if ident, ok := lhs[i].(*ast.Ident); ok {
+				if obj := info.ObjectOf(ident); obj != nil {
+					vars[obj] = true
+				}
+			}
+		}
+	}
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch node := n.(type) {
+		case *ast.AssignStmt:
+			bind(node.Lhs, node.Rhs)
+		case *ast.ValueSpec:
+			lhs := make([]ast.Expr, len(node.Names))
+			for i, name := range node.Names {
+				lhs[i] = name
+			}
+			bind(lhs, node.Values)
+		}
+		return true
+	})
+	return vars
+}
+
+// isVerifyValueCallWith checks if call invokes goleak.VerifyNone through an
+// identifier with param as its first argument: either a variable holding the
+// function or the function itself, e.g. when goleak is dot-imported
+func isVerifyValueCallWith(info *types.Info, call *ast.CallExpr, param *ast.Ident, verifyVars map[types.Object]bool, paths, verifyFuncs []string) bool {
+	ident, ok := call.Fun.(*ast.Ident)
+	if !ok || info == nil || len(call.Args) == 0 {
+		return false
+	}
+	obj := info.Uses[ident]
+	if obj == nil || (!verifyVars[obj] && !isGoleakFunc(obj, paths, verifyFuncs...)) {
+		return false
+	}
+	return refersTo(info, call.Args[0], param)
+}
+
+// isGoleakFunc checks if obj is one of the named functions of a goleak package
+func isGoleakFunc(obj types.Object, paths []string, names ...string) bool {
+	fn, ok := obj.(*types.Func)
+	if !ok || !slices.Contains(names, fn.Name()) || fn.Pkg() == nil {
+		return false
+	}
+	pkgPath := unvendoredPath(fn.Pkg().Path())
+	for _, path := range paths {
+		if unquoted, err := strconv.Unquote(path); err == nil {
+			path = unquoted
+		}
+		if pkgPath == path {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyHelper tells how a package-level helper verifies its first parameter
+type verifyHelper int
+
+const (
+	// helperVerifies calls goleak.VerifyNone with it, so must be deferred
+	helperVerifies verifyHelper = iota + 1
+	// helperRegistersCleanup registers goleak.VerifyNone with its Cleanup
+	// method, so covers the test when called
+	helperRegistersCleanup
+)
+
+// collectVerifyHelpers returns the package-level functions, declared in any
+// file of the package including non-test files, that verify their first
+// parameter, by name. Helpers may call goleak.VerifyNone directly, e.g.
+// func verifyLeaks(t *testing.T) { goleak.VerifyNone(t) }, or register it with
+// t.Cleanup(func() { goleak.VerifyNone(t) }).
+func collectVerifyHelpers(pass *analysis.Pass, config *Config, goleak goleakNames) map[string]verifyHelper {
+	helpers := make(map[string]verifyHelper)
+	for _, file := range pass.Files {
+		for _, decl := range file.Decls {
+			fd, ok := decl.(*ast.FuncDecl)
+			if !ok || fd.Recv != nil || fd.Name == nil || fd.Body == nil || isTestFunc(pass.TypesInfo, fd, config.TestPrefixes) {
+				continue
+			}
+			param := firstParam(fd.Type)
+			if param == nil {
+				continue
+			}
+			switch {
+			case registersVerifyCleanupWith(pass.TypesInfo, fd.Body, param, goleak):
+				helpers[fd.Name.Name] = helperRegistersCleanup
+			case callsVerifyNoneWith(pass.TypesInfo, fd.Body, param, goleak):
+				helpers[fd.Name.Name] = helperVerifies
+			}
+		}
+	}
+	return helpers
+}
+
+// registersVerifyCleanupWith checks if body calls param.Cleanup with a
+// function literal calling goleak.VerifyNone with param
+func registersVerifyCleanupWith(info *types.Info, body *ast.BlockStmt, param *ast.Ident, goleak goleakNames) bool {
+	found := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		if call, ok := n.(*ast.CallExpr); ok && isVerifyCleanupWith(info, call, param, goleak) {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// callsVerifyNoneWith checks if body calls goleak.VerifyNone with param as its
+// first argument, either directly or deferred
+func callsVerifyNoneWith(info *types.Info, body *ast.BlockStmt, param *ast.Ident, goleak goleakNames) bool {
+	found := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		if call, ok := n.(*ast.CallExpr); ok && isVerifyNoneWith(info, call, param, goleak) {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// isHelperCallWith checks if call invokes one of the verify helpers with
+// param as its first argument, returning the kind of helper. The name must
+// resolve to the package-level function, not a local variable shadowing it.
+func isHelperCallWith(info *types.Info, call *ast.CallExpr, param *ast.Ident, helpers map[string]verifyHelper) verifyHelper {
+	ident, ok := call.Fun.(*ast.Ident)
+	if !ok || helpers[ident.Name] == 0 || len(call.Args) == 0 {
+		return 0
+	}
+	// Make sure the name isn't shadowed by a local variable
+	if info != nil {
+		if obj := info.Uses[ident]; obj != nil {
+			if _, ok := obj.(*types.Func); !ok {
+				return 0
+			}
+		}
+	}
+	if !refersTo(info, call.Args[0], param) {
+		return 0
+	}
+	return helpers[ident.Name]
+}
+
+// refersTo checks if expr is an identifier referring to the variable declared
+// by param. Type information is used when available so that shadowing
+// variables with the same name are told apart; otherwise names are compared.
+func refersTo(info *types.Info, expr ast.Expr, param *ast.Ident) bool {
+	ident, ok := expr.(*ast.Ident)
+	if !ok || param == nil || param.Name == "_" {
+		return false
+	}
+	if info != nil {
+		if obj := info.Defs[param]; obj != nil {
+			return info.Uses[ident] == obj
+		}
+	}
+	return ident.Name == param.Name
+}
+
+// Constants for goleak package paths and method names
+const (
+	goleakUberPath    = "go.uber.org/goleak"
+	goleakGithubPath  = "github.com/uber-go/goleak"
+	defaultAlias      = "goleak"
+	blankIdent        = "_"
+	verifyTestMain    = "VerifyTestMain"
+	verifyNone        = "VerifyNone"
+	ignoreCurrent     = "IgnoreCurrent"
+	ignoreTopFunction = "IgnoreTopFunction"
+	ignoreAnyFunction = "IgnoreAnyFunction"
+	cleanupOption     = "Cleanup"
+	optionType        = "Option"
+	testPrefix        = "Test"
+	testMainFunc      = "TestMain"
+	examplePrefix     = "Example"
+	subtestRun        = "Run"
+	parallelMethod    = "Parallel"
+	cleanupMethod     = "Cleanup"
+	testFileSuffix    = "_test.go"
+	vendorDir         = "vendor"
+)
+
+// goleakOptions are the option constructors of goleak, with whether only
+// VerifyTestMain accepts them. Options goleak adds belong here, so that
+// Config.CheckOptions doesn't report them as unknown.
+var goleakOptions = map[string]struct{ testMainOnly bool }{
+	ignoreTopFunction: {},
+	ignoreAnyFunction: {},
+	ignoreCurrent:     {},
+	cleanupOption:     {testMainOnly: true},
+}
+
+// goVersionCleanup is the first Go version with testing.T.Cleanup
+const goVersionCleanup = "go1.14"
+
+// targetGoVersion returns the Go version the package targets, in the go1.N
+// form: Config.GoVersion if set, otherwise that of the package's module,
+// which is empty when unknown, e.g. in GOPATH mode
+func targetGoVersion(pass *analysis.Pass, config *Config) string {
+	v := config.GoVersion
+	if v == "" {
+		v = pass.Pkg.GoVersion()
+	}
+	if v != "" && !strings.HasPrefix(v, "go") {
+		v = "go" + v
+	}
+	return v
+}
+
+// supportsGoVersion checks if code targeting Go version target can use an
+// API introduced in min. An unknown target is assumed to support it.
+func supportsGoVersion(target, min string) bool {
+	return !version.IsValid(target) || version.Compare(target, min) >= 0
+}
+
+// isTestFile checks if the filename indicates a test file
+func isTestFile(filename string) bool {
+	return strings.HasSuffix(filename, testFileSuffix)
+}
+
+// isTestFunction checks if a function name starts with one of the test prefixes.
+// TestMain is never a test function, whatever the prefixes.
+func isTestFunction(name string, prefixes []string) bool {
+	if name == testMainFunc {
+		return false
+	}
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isTestFunc checks if fd is a test function that go test runs: a function,
+// not a method, named with one of the prefixes and with the signature
+// func(*testing.T). A Test-prefixed helper taking other parameters is not a test.
+func isTestFunc(info *types.Info, fd *ast.FuncDecl, prefixes []string) bool {
+	if fd.Name == nil || fd.Recv != nil || fd.Type.TypeParams != nil || !isTestFunction(fd.Name.Name, prefixes) {
+		return false
+	}
+	if info != nil {
+		if fn, ok := info.Defs[fd.Name].(*types.Func); ok {
+			sig := fn.Type().(*types.Signature)
+			return sig.Params().Len() == 1 && sig.Results().Len() == 0 && isTestingTType(sig.Params().At(0).Type())
+		}
+	}
+	// Without type information, fall back to the syntax
+	params := fd.Type.Params
+	if params == nil || len(params.List) != 1 || len(params.List[0].Names) > 1 || fd.Type.Results != nil {
+		return false
+	}
+	return isTestingT(params.List[0].Type)
+}
+
+// isTestingTType checks if typ is *testing.T
+func isTestingTType(typ types.Type) bool {
+	ptr, ok := typ.(*types.Pointer)
+	if !ok {
+		return false
+	}
+	named, ok := ptr.Elem().(*types.Named)
+	return ok && named.Obj().Name() == "T" && named.Obj().Pkg() != nil && named.Obj().Pkg().Path() == "testing"
+}
+
+// isRunnableExample checks if fd is an example function that is run by go test,
+// i.e. an ExampleXxx function without parameters that has an output comment
+func isRunnableExample(fd *ast.FuncDecl, file *ast.File) bool {
+	if fd.Name == nil || !strings.HasPrefix(fd.Name.Name, examplePrefix) || fd.Body == nil {
+		return false
+	}
+	if fd.Recv != nil || fd.Type.Params.NumFields() != 0 || fd.Type.Results.NumFields() != 0 {
+		return false
+	}
+	if file == nil {
+		return false
+	}
+	for _, group := range file.Comments {
+		if group.Pos() < fd.Body.Lbrace || group.End() > fd.Body.Rbrace {
+			continue
+		}
+		if outputCommentRegex.MatchString(group.Text()) {
+			return true
+		}
+	}
+	return false
+}
+
+// goleakNames identifies the goleak calls of a package: the name goleak is
+// imported as and the verification functions configured for it
+type goleakNames struct {
+	alias          string   // name goleak is imported as, empty if it isn't
+	aliases        []string // every name goleak is imported as, a file may import it twice
+	verify         []string // per-test verification functions, from Config.VerifyFuncs
+	verifyTestMain []string // TestMain verification functions, from Config.VerifyTestMainFuncs
+	paths          []string // import paths of goleak, from Config.GoleakImportPaths
+}
+
+// isGoleakCall checks if a selector expression is a call to goleak with one of
+// the specified methods. With type information the base of the selector must
+// refer to an import of goleak, so that a local variable shadowing the import
+// name doesn't count; without it only the name is compared.
+func isGoleakCall(info *types.Info, sel *ast.SelectorExpr, goleak goleakNames, methods ...string) bool {
+	if !slices.Contains(methods, sel.Sel.Name) {
+		return false
+	}
+	ident, ok := sel.X.(*ast.Ident)
+	if !ok {
+		return false
+	}
+	if info == nil {
+		return slices.Contains(goleak.aliases, ident.Name)
+	}
+
+	pkgName, ok := info.Uses[ident].(*types.PkgName)
+	if !ok {
+		return false
+	}
+	path := unvendoredPath(pkgName.Imported().Path())
+	for _, want := range goleak.paths {
+		if strings.Trim(want, `"`) == path {
+			return true
+		}
+	}
+	return false
+}
+
+// nameIn returns the name goleak is called by in sel, which may differ from
+// alias when a file imports goleak twice
+func (g goleakNames) nameIn(sel *ast.SelectorExpr) string {
+	if ident, ok := sel.X.(*ast.Ident); ok {
+		return ident.Name
+	}
+	return g.alias
+}
+
+// getGoleakAliases returns the names goleak is referred to by in files, in
+// import order and each once, or nil if no file imports it. Each callable
+// import of every file counts, so that a file importing goleak both plainly
+// and under an alias has its calls recognized with either spelling.
+func getGoleakAliases(info *types.Info, files []*ast.File, paths []string) []string {
+	var aliases []string
+	for _, file := range files {
+		for _, imp := range file.Imports {
+			if imp.Path == nil || imp.Name != nil && imp.Name.Name == blankIdent {
+				continue
+			}
+			path := importPath(info, imp)
+			if !slices.ContainsFunc(paths, func(want string) bool { return strings.Trim(want, `"`) == path }) {
+				continue
+			}
+			if alias := goleakAlias(info, imp); !slices.Contains(aliases, alias) {
+				aliases = append(aliases, alias)
+			}
+		}
+	}
+	return aliases
+}
+
+// goleakAlias returns the name an import of goleak is referred to by: the
+// import's name or, resolved with type information, the name the package
+// declares, which a replaced or forked goleak may change
+func goleakAlias(info *types.Info, imp *ast.ImportSpec) string {
+	if imp.Name != nil {
+		return imp.Name.Name
+	}
+	if pkgName := importedPkgName(info, imp); pkgName != nil {
+		return pkgName.Imported().Name()
+	}
+	return defaultAlias
+}
+
+// findGoleakImport returns the first import of goleak in files that can be
+// called, i.e. not a blank import, if any
+func findGoleakImport(info *types.Info, files []*ast.File, paths []string) *ast.ImportSpec {
+	return findGoleakImportWith(info, files, paths, func(imp *ast.ImportSpec) bool {
+		return imp.Name == nil || imp.Name.Name != blankIdent
+	})
+}
+
+// findBlankGoleakImport returns the first import _ "go.uber.org/goleak" in files, if any
+func findBlankGoleakImport(info *types.Info, files []*ast.File, paths []string) *ast.ImportSpec {
+	return findGoleakImportWith(info, files, paths, func(imp *ast.ImportSpec) bool {
+		return imp.Name != nil && imp.Name.Name == blankIdent
+	})
+}
+
+// findGoleakImportWith returns the first import of goleak in files accepted by
+// match. The path of the imported package, resolved with type information
+// when available so that vendored packages are recognized by their import
+// path, is compared with paths, which may be given quoted or not.
+func findGoleakImportWith(info *types.Info, files []*ast.File, paths []string, match func(*ast.ImportSpec) bool) *ast.ImportSpec {
+	wanted := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		wanted[strings.Trim(path, `"`)] = true
+	}
+
+	for _, file := range files {
+		// Early exit if no imports
+		if len(file.Imports) == 0 {
+			continue
+		}
+
+		for _, imp := range file.Imports {
+			if imp.Path == nil {
+				continue
+			}
+			if wanted[importPath(info, imp)] && match(imp) {
+				return imp
+			}
+		}
+	}
+	return nil
+}
+
+// importPath returns the path of the package imported by imp, from type
+// information if available and otherwise as written
+func importPath(info *types.Info, imp *ast.ImportSpec) string {
+	if pkgName := importedPkgName(info, imp); pkgName != nil {
+		return unvendoredPath(pkgName.Imported().Path())
+	}
+	path, err := strconv.Unquote(imp.Path.Value)
+	if err != nil {
+		return ""
+	}
+	return path
+}
+
+// unvendoredPath strips the vendor directory from the import path of a
+// vendored package, as seen in GOPATH mode
+func unvendoredPath(path string) string {
+	if i := strings.LastIndex(path, "/vendor/"); i >= 0 {
+		return path[i+len("/vendor/"):]
+	}
+	return strings.TrimPrefix(path, "vendor/")
+}
+
+// importedPkgName returns the package name declared by imp, or nil without
+// type information. Blank imports declare no name.
+func importedPkgName(info *types.Info, imp *ast.ImportSpec) *types.PkgName {
+	if info == nil {
+		return nil
+	}
+	var obj types.Object
+	if imp.Name != nil {
+		obj = info.Defs[imp.Name]
+	} else {
+		obj = info.Implicits[imp]
+	}
+	pkgName, _ := obj.(*types.PkgName)
+	return pkgName
+}
+
+// shouldExcludePackage checks if a package should be excluded
+func shouldExcludePackage(pkgPath string, config *Config) bool {
+	if config.ExcludePackages == "" {
+		return false
+	}
+	if config.AnchorPackagePatterns {
+		return anyPattern(config.ExcludePackages, func(pattern string) bool {
+			return matchesPackagePattern(pkgPath, pattern)
+		})
+	}
+	return matchesAnyPattern(pkgPath, config.ExcludePackages)
+}
+
+// shouldExcludeTest checks if a test function should be excluded, either by
+// its file or by its name
+func shouldExcludeTest(testFunc, filename string, config *Config) bool {
+	if shouldExcludeFileWithConfig(filename, config) {
+		return true
+	}
+	return testFunc != "" && config.ExcludeFunctions != "" && matchesAnyPattern(testFunc, config.ExcludeFunctions)
+}
+
+// testExclusion explains why shouldExcludeTest excludes a test function,
+// naming the pattern that matches it
+func testExclusion(testFunc, filename string, config *Config) string {
+	if isInExcludedDir(filename, config.ExcludeDirs) {
+		return "the file is in one of exclude-dirs"
+	}
+	if !config.IncludeVendor && isVendored(filename) {
+		return "the file is vendored, which include-vendor would analyze"
+	}
+	if pattern := firstMatch(config.ExcludeFiles, func(pattern string) bool {
+		return matchesPattern(filename, pattern) || matchesPattern(baseName(filename), pattern)
+	}); pattern != "" {
+		return fmt.Sprintf("the file matches exclude-files pattern %q", pattern)
+	}
+	if pattern := firstMatch(config.ExcludeFunctions, func(pattern string) bool {
+		return matchesPattern(testFunc, pattern)
+	}); pattern != "" {
+		return fmt.Sprintf("the name matches exclude-functions pattern %q", pattern)
+	}
+	return "excluded by configuration"
+}
+
+// firstMatch returns the first of the comma-separated patterns for which
+// match returns true, or "" if there is none
+func firstMatch(patterns string, match func(pattern string) bool) string {
+	for _, pattern := range strings.Split(patterns, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" && match(pattern) {
+			return pattern
+		}
+	}
+	return ""
+}
+
+// forPackage returns the configuration to use for pkgPath, with the
+// exclusions of the most specific matching package rule applied
+func (c *Config) forPackage(pkgPath string) *Config {
+	rule := c.packageRule(pkgPath)
+	if rule == nil {
+		return c
+	}
+	config := *c
+	if rule.ExcludeFiles != "" {
+		config.ExcludeFiles = rule.ExcludeFiles
+	}
+	if rule.ExcludeFunctions != "" {
+		config.ExcludeFunctions = rule.ExcludeFunctions
+	}
+	return &config
+}
+
+// packageRule returns the most specific rule matching pkgPath, i.e. the one
+// with the longest Packages value, or nil if none matches. External test
+// packages match the rules of the package they test.
+func (c *Config) packageRule(pkgPath string) *PackageRule {
+	pkgPath = strings.TrimSuffix(pkgPath, "_test")
+	var best *PackageRule
+	for i := range c.PackageRules {
+		rule := &c.PackageRules[i]
+		if !matchesPackageRule(pkgPath, rule.Packages) {
+			continue
+		}
+		if best == nil || len(rule.Packages) > len(best.Packages) {
+			best = rule
+		}
+	}
+	return best
+}
+
+// matchesPackageRule checks if pkgPath is pattern or below it, or matches
+// pattern as a regular expression
+func matchesPackageRule(pkgPath, pattern string) bool {
+	pattern = strings.TrimSpace(pattern)
+	if pattern == "" {
+		return false
+	}
+	if pkgPath == pattern || strings.HasPrefix(pkgPath, strings.TrimSuffix(pattern, "/")+"/") {
+		return true
+	}
+	return containsRegexMetachars(pattern) && matchRegexPattern(pkgPath, pattern)
+}
+
+// shouldExcludeFileWithConfig checks if a file should be excluded
+func shouldExcludeFileWithConfig(filename string, config *Config) bool {
+	// Directory prefixes are cheaper than patterns, check them first
+	if isInExcludedDir(filename, config.ExcludeDirs) || !config.IncludeVendor && isVendored(filename) {
+		return true
+	}
+
+	// Extract just the filename without path for pattern matching
+	justFilename := baseName(filename)
+
+	// First check standard exclusions against both full path and filename
+	if config.ExcludeFiles != "" {
+		if matchesAnyPattern(filename, config.ExcludeFiles) || matchesAnyPattern(justFilename, config.ExcludeFiles) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isInExcludedDir checks if filename is below one of dirs. Paths are compared
+// with either / or \ as the separator, like baseName, and whole directory
+// names, so "vendor" doesn't match "myvendor/".
+func isInExcludedDir(filename string, dirs []string) bool {
+	if len(dirs) == 0 {
+		return false
+	}
+	dir := strings.ReplaceAll(filename, `\`, "/")
+	i := strings.LastIndex(dir, "/")
+	if i < 0 {
+		return false
+	}
+	dir = dir[:i+1]
+	for _, excluded := range dirs {
+		excluded = strings.TrimSuffix(strings.ReplaceAll(excluded, `\`, "/"), "/")
+		switch {
+		case excluded == "":
+			continue
+		case isAbsolutePath(excluded):
+			if strings.HasPrefix(dir, excluded+"/") {
+				return true
+			}
+		case strings.HasPrefix(dir, excluded+"/") || strings.Contains(dir, "/"+excluded+"/"):
+			return true
+		}
+	}
+	return false
+}
+
+// isVendored checks if filename is below a vendor directory
+func isVendored(filename string) bool {
+	return isInExcludedDir(filename, []string{vendorDir})
+}
+
+// isAbsolutePath checks if a slash-separated path is absolute on Unix or
+// Windows, e.g. /src/repo or C:/src/repo
+func isAbsolutePath(path string) bool {
+	return strings.HasPrefix(path, "/") || (len(path) >= 3 && path[1] == ':' && path[2] == '/')
+}
+
+// baseName returns the last element of a path using either / or \ as the
+// separator, so that Windows, Unix and mixed paths are handled alike
+// regardless of the platform the analyzer runs on
+func baseName(path string) string {
+	if i := strings.LastIndexAny(path, `/\`); i >= 0 {
+		return path[i+1:]
+	}
+	return path
+}
+
+// matchesAnyPattern checks if a string matches any of the comma-separated patterns
+func matchesAnyPattern(str, patterns string) bool {
+	return anyPattern(patterns, func(pattern string) bool {
+		return matchesPattern(str, pattern)
+	})
+}
+
+// anyPattern checks if match returns true for any of the comma-separated patterns
+func anyPattern(patterns string, match func(pattern string) bool) bool {
+	if patterns == "" {
+		return false
+	}
+
+	// Avoid creating string slice if only one pattern
+	if !strings.Contains(patterns, ",") {
+		return match(strings.TrimSpace(patterns))
+	}
+
+	for _, pattern := range strings.Split(patterns, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern != "" && match(pattern) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchesPackagePattern checks if a package path matches a single pattern.
+// Plain patterns are compared against the final path element only, so that
+// "mocks" matches "internal/mocks" (and its external test package
+// "internal/mocks_test") but not "mockstore" or "mocks/server".
+// Regex and glob patterns are matched against the full path as usual.
+func matchesPackagePattern(pkgPath, pattern string) bool {
+	if pattern == "" || containsSpecialChars(pattern) {
+		return matchesPattern(pkgPath, pattern)
+	}
+	name := pkgPath[strings.LastIndex(pkgPath, "/")+1:]
+	return name == pattern || name == pattern+"_test"
+}
+
 // matchesPattern checks if a string matches a single pattern
 // This function is optimized for performance with large projects by using:
 // 1. Fast path for exact matches
@@ -479,61 +2496,19 @@ func matchGlobPattern(str, pattern string) bool {
 	regexPattern = "^" + regexPattern + "$"
 
 	// Use regex cache for compiled glob patterns
-	regexMutex.RLock()
-	re, ok := regexCache[regexPattern]
-	regexMutex.RUnlock()
-
-	if !ok {
-		var err error
-		re, err = regexp.Compile(regexPattern)
-		if err != nil {
-			return false
-		}
-
-		regexMutex.Lock()
-		// Check cache size and clean if necessary
-		if len(regexCache) > 100 {
-			// Keep only recent entries - simple LRU-like behavior
-			for k := range regexCache {
-				delete(regexCache, k)
-				if len(regexCache) <= 50 {
-					break
-				}
-			}
-		}
-		regexCache[regexPattern] = re
-		regexMutex.Unlock()
-	}
-
-	return re.MatchString(str)
+	return matchRegexPattern(str, regexPattern)
 }
 
 // matchRegexPattern handles regex patterns with caching
 func matchRegexPattern(str, pattern string) bool {
-	regexMutex.RLock()
-	re, ok := regexCache[pattern]
-	regexMutex.RUnlock()
-
+	re, ok := regexCache.get(pattern)
 	if !ok {
 		var err error
 		re, err = regexp.Compile(pattern)
 		if err != nil {
 			return false
 		}
-
-		regexMutex.Lock()
-		// Check cache size and clean if necessary
-		if len(regexCache) > 100 {
-			// Keep only recent entries - simple LRU-like behavior
-			for k := range regexCache {
-				delete(regexCache, k)
-				if len(regexCache) <= 50 {
-					break
-				}
-			}
-		}
-		regexCache[pattern] = re
-		regexMutex.Unlock()
+		regexCache.put(pattern, re)
 	}
 
 	return re.MatchString(str)
@@ -567,19 +2542,50 @@ func hasNonExcludedTestFiles(pass *analysis.Pass, config *Config) bool {
 	return false
 }
 
+// hasTestFiles checks if any file of the package is a _test.go file, going
+// by the name of the file alone
+func hasTestFiles(pass *analysis.Pass) bool {
+	for _, file := range pass.Files {
+		if tf := pass.Fset.File(file.Pos()); tf != nil && isTestFile(tf.Name()) {
+			return true
+		}
+	}
+	return false
+}
+
+// reportMissingTests reports a package without a single _test.go file in its
+// directory, at the package clause of its first file. The directory is looked
+// at since packages with tests are also analyzed once without them.
+func reportMissingTests(pass *analysis.Pass, config *Config, result *Result) {
+	if len(pass.Files) == 0 || shouldExcludePackage(pass.Pkg.Path(), config) || isPackageIgnored(pass) {
+		return
+	}
+	file := pass.Files[0]
+	filename := pass.Fset.Position(file.Pos()).Filename
+	// The generated main package of a test binary lives in the build cache
+	if !strings.HasSuffix(filename, ".go") || hasTestFilesOnDisk(pass) || !newReportFilter(pass, config).shouldReport(testFuncInfo{pos: file.Package, filename: filename}) {
+		return
+	}
+	message := fmt.Sprintf("package %s has no test files (%s)", pass.Pkg.Name(), ReasonNoTests.description())
+	reportMessage(pass, result, file.Package, "", ReasonNoTests, message)
+}
+
 // reportUncoveredTestFunctionsWithContext reports all test functions that are not covered with context support
-func reportUncoveredTestFunctionsWithContext(ctx context.Context, pass *analysis.Pass, config *Config, reason string, semaphore chan struct{}) (interface{}, error) {
+func reportUncoveredTestFunctionsWithContext(ctx context.Context, pass *analysis.Pass, config *Config, filter *reportFilter, result *Result, reason Reason, semaphore chan struct{}) (interface{}, error) {
 	inspect := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
 
 	// Use semaphore to control concurrency
 	select {
 	case <-ctx.Done():
-		return nil, ctx.Err()
+		return nil, timeoutError(pass, config, "", ctx.Err())
 	case semaphore <- struct{}{}:
 		defer func() { <-semaphore }()
 	}
 
-	inspect.Preorder([]ast.Node{(*ast.FuncDecl)(nil)}, func(n ast.Node) {
+	testMain := findTestMain(pass)
+	var grouped []testFuncInfo // uncovered tests reported as one finding with Config.GroupNoImport
+	var file *ast.File
+	inspect.Preorder([]ast.Node{(*ast.File)(nil), (*ast.FuncDecl)(nil)}, func(n ast.Node) {
 		// Check context periodically
 		select {
 		case <-ctx.Done():
@@ -587,14 +2593,351 @@ func reportUncoveredTestFunctionsWithContext(ctx context.Context, pass *analysis
 		default:
 		}
 
+		if f, ok := n.(*ast.File); ok {
+			file = f
+			return
+		}
+
+		// Partial parses, e.g. of an editor buffer, may leave a declaration unnamed
 		fd := n.(*ast.FuncDecl)
-		if isTestFunction(fd.Name.Name) {
-			pos := pass.Fset.Position(fd.Pos())
-			if !shouldExcludeFileWithConfig(pos.Filename, config) {
-				pass.Reportf(fd.Pos(), "test function %s is not covered by goleak (%s)", fd.Name.Name, reason)
+		if fd.Name == nil {
+			return
+		}
+		if isTestFunc(pass.TypesInfo, fd, config.TestPrefixes) {
+			testFunc := testFuncInfo{
+				name:     fd.Name.Name,
+				pos:      fd.Pos(),
+				filename: pass.Fset.Position(fd.Pos()).Filename,
+				body:     fd.Body,
+				param:    firstParam(fd.Type),
+			}
+			if exclusion := filter.exclusion(testFunc); exclusion != "" {
+				recordTestStatus(pass, result, fd.Name.Name, fd.Pos(), CoverageExcluded, exclusion)
+			} else if config.OnlyGoroutineStartingTests && (fd.Body == nil || !spawnsGoroutines(fd.Body)) {
+				recordTestStatus(pass, result, fd.Name.Name, fd.Pos(), CoverageNone, detailNoGoroutines)
+			} else {
+				recordTestStatus(pass, result, fd.Name.Name, fd.Pos(), CoverageNone, "goleak is not imported by the package")
+				if reason == ReasonNoImport && config.GroupNoImport {
+					grouped = append(grouped, testFunc)
+				} else {
+					reportUncoveredTest(pass, result, testFunc, reason, config.GoleakImportPaths, testMain)
+				}
+				if config.CheckCommentedOut {
+					// The import was likely removed along with the verification
+					hintCommentedOutVerify(pass, result, testFunc, []string{defaultAlias})
+				}
+			}
+		} else if config.CheckExamples && isRunnableExample(fd, file) {
+			example := testFuncInfo{name: fd.Name.Name, pos: fd.Pos(), filename: pass.Fset.Position(fd.Pos()).Filename}
+			if isTestFile(example.filename) && filter.shouldReport(example) {
+				reportFinding(pass, result, fd.Pos(), fd.Name.Name, ReasonExampleNoTestMain)
+			}
+		}
+	})
+
+	if len(grouped) > 0 {
+		reportNoImportPackage(pass, result, grouped)
+	}
+	return result, nil
+}
+
+// reportNoImportPackage reports tests, the uncovered tests of a package that
+// doesn't import goleak, as a single finding at the package clause of the
+// first test's file. Each test is a related location.
+func reportNoImportPackage(pass *analysis.Pass, result *Result, tests []testFuncInfo) {
+	pos := tests[0].pos
+	if file := enclosingFile(pass, pos); file != nil {
+		pos = file.Package
+	}
+	diag := analysis.Diagnostic{
+		Pos:     pos,
+		Message: fmt.Sprintf("package %s has %d test(s) and does not import goleak", pass.Pkg.Name(), len(tests)),
+	}
+	for _, testFunc := range tests {
+		diag.Related = append(diag.Related, analysis.RelatedInformation{
+			Pos:     testFunc.pos,
+			Message: fmt.Sprintf("test function %s is not covered by goleak", testFunc.name),
+		})
+	}
+	report(pass, result, diag, Finding{Reason: ReasonNoImport})
+}
+
+// suggestTestMain reports a single package-level suggestion to add TestMain with
+// goleak.VerifyTestMain when enough tests start goroutines. The suggestion is
+// reported at the first such test.
+func suggestTestMain(pass *analysis.Pass, config *Config, filter *reportFilter, result *Result, testFuncs []testFuncInfo) {
+	var first *testFuncInfo
+	count := 0
+	for i := range testFuncs {
+		testFunc := &testFuncs[i]
+		if !testFunc.goroutines || !filter.shouldReport(*testFunc) {
+			continue
+		}
+		count++
+		if first == nil || testFunc.pos < first.pos {
+			first = testFunc
+		}
+	}
+	if count < config.TestMainSuggestThreshold {
+		return
+	}
+
+	message := fmt.Sprintf("package %s has %d tests that start goroutines but no TestMain; consider adding TestMain with goleak.VerifyTestMain(m)", pass.Pkg.Name(), count)
+	reportMessage(pass, result, first.pos, "", ReasonSuggestTestMain, message)
+}
+
+// detailNoGoroutines explains why a test needs no coverage with
+// Config.OnlyGoroutineStartingTests
+const detailNoGoroutines = "the test starts no goroutines, which only-goroutine-tests requires for a finding"
+
+// recordTestStatuses records the coverage status of every analyzed test
+// function, explaining how it is covered or why it isn't
+func recordTestStatuses(pass *analysis.Pass, filter *reportFilter, result *Result, analyzed *analysisResult) {
+	unreachable := make(map[string]token.Pos, len(analyzed.unreachableDefers))
+	for _, deferred := range analyzed.unreachableDefers {
+		if _, ok := unreachable[deferred.name]; !ok {
+			unreachable[deferred.name] = deferred.pos
+		}
+	}
+	for _, testFunc := range analyzed.testFuncs {
+		coverage, detail := CoverageNone, ""
+		if exclusion := filter.exclusion(testFunc); exclusion != "" {
+			coverage, detail = CoverageExcluded, exclusion
+		} else if testFunc.requireDefer && analyzed.hasTestMain && analyzed.hasVerifyTestMain && !analyzed.funcsCoveredByDefer[testFunc.name] {
+			detail = fmt.Sprintf("it is marked //%s and doesn't defer goleak.%s(t)", requireDeferDirective, verifyNone)
+		} else if analyzed.hasTestMain && analyzed.hasVerifyTestMain && !testFunc.requireDefer {
+			coverage, detail = CoverageTestMain, fmt.Sprintf("%s calls goleak.%s", testMainFunc, verifyTestMain)
+		} else if analyzed.funcsCoveredByDefer[testFunc.name] {
+			coverage, detail = CoverageDefer, analyzed.coveredBy[testFunc.name]
+		} else if pos, ok := unreachable[testFunc.name]; ok {
+			detail = fmt.Sprintf("its defer goleak.%s(t) at line %d never runs", verifyNone, pass.Fset.Position(pos).Line)
+		} else if filter.config.OnlyGoroutineStartingTests && !testFunc.goroutines {
+			detail = detailNoGoroutines
+		} else if testFunc.suite != "" {
+			detail = fmt.Sprintf("suite %s doesn't call goleak.%s in TearDownTest or TearDownSuite", testFunc.suite, verifyNone)
+		} else if analyzed.hasTestMain {
+			detail = fmt.Sprintf("%s doesn't call goleak.%s and the test doesn't defer goleak.%s(t)", testMainFunc, verifyTestMain, verifyNone)
+		} else {
+			detail = fmt.Sprintf("the test doesn't defer goleak.%s(t) or register it with t.%s", verifyNone, cleanupMethod)
+		}
+		recordTestStatus(pass, result, testFunc.name, testFunc.pos, coverage, detail)
+	}
+}
+
+// recordExcludedTests records every test function in the package's test
+// files as excluded, for the reason detail
+func recordExcludedTests(pass *analysis.Pass, config *Config, result *Result, detail string) {
+	for _, file := range pass.Files {
+		if !isTestFile(pass.Fset.Position(file.Pos()).Filename) {
+			continue
+		}
+		for _, decl := range file.Decls {
+			if fd, ok := decl.(*ast.FuncDecl); ok && fd.Name != nil && isTestFunc(pass.TypesInfo, fd, config.TestPrefixes) {
+				recordTestStatus(pass, result, fd.Name.Name, fd.Pos(), CoverageExcluded, detail)
+			}
+		}
+	}
+}
+
+// recordTestStatus records the coverage status of a single test function,
+// with detail explaining it
+func recordTestStatus(pass *analysis.Pass, result *Result, testFunc string, pos token.Pos, coverage Coverage, detail string) {
+	result.Tests = append(result.Tests, TestStatus{
+		TestFunc: testFunc,
+		Package:  pass.Pkg.Path(),
+		Position: pass.Fset.Position(pos),
+		Coverage: coverage,
+		Detail:   detail,
+	})
+}
+
+// reportUncoveredTest reports a test function lacking coverage, recording where
+// a defer goleak.VerifyNone(t) belongs. The defer is also offered as a
+// suggested fix, importing goleak from the first of importPaths if the test's
+// file doesn't import it by name yet.
+func reportUncoveredTest(pass *analysis.Pass, result *Result, testFunc testFuncInfo, reason Reason, importPaths []string, testMain token.Pos) {
+	diag := analysis.Diagnostic{Pos: testFunc.pos, Message: reason.message(testFunc.name)}
+	finding := Finding{TestFunc: testFunc.name, Reason: reason}
+
+	// Related locations let editors navigate between the finding and where it can be fixed
+	if testMain.IsValid() {
+		diag.Related = append(diag.Related, analysis.RelatedInformation{
+			Pos:     testMain,
+			Message: fmt.Sprintf("%s can cover every test with goleak.%s(m)", testMainFunc, verifyTestMain),
+		})
+	}
+
+	if testFunc.body != nil {
+		insertPos, _ := insertionPoint(pass.Fset, testFunc.body)
+		finding.Insertion = pass.Fset.Position(insertPos)
+		diag.Related = append(diag.Related, analysis.RelatedInformation{
+			Pos:     insertPos,
+			Message: fmt.Sprintf("insert defer goleak.%s(t) here", verifyNone),
+		})
+
+		file := enclosingFile(pass, testFunc.pos)
+		if (reason == ReasonMissingDefer || reason == ReasonNoImport || reason == ReasonRequireDefer) && file != nil && testFunc.param != nil && testFunc.param.Name != "_" {
+			paths := unquotedPaths(importPaths)
+			alias, imported := fileGoleakAlias(file, paths)
+			insertPos, text := verifyDeferEdit(pass.Fset, testFunc.body, alias, testFunc.param.Name)
+			fix := analysis.SuggestedFix{
+				Message:   fmt.Sprintf("Add defer %s.%s(%s)", alias, verifyNone, testFunc.param.Name),
+				TextEdits: []analysis.TextEdit{{Pos: insertPos, End: insertPos, NewText: []byte(text)}},
+			}
+			if !imported {
+				fix.Message = fmt.Sprintf("Import %s and add defer %s.%s(%s)", paths[0], alias, verifyNone, testFunc.param.Name)
+				fix.TextEdits = append([]analysis.TextEdit{importEdit(pass.Fset, file, paths[0])}, fix.TextEdits...)
+			}
+			diag.SuggestedFixes = []analysis.SuggestedFix{fix}
+		}
+	}
+
+	report(pass, result, diag, finding)
+}
+
+// findTestMain returns the position of the package's TestMain, if any
+func findTestMain(pass *analysis.Pass) token.Pos {
+	for _, file := range pass.Files {
+		if !isTestFile(pass.Fset.Position(file.Pos()).Filename) {
+			continue
+		}
+		for _, decl := range file.Decls {
+			if fd, ok := decl.(*ast.FuncDecl); ok && fd.Recv == nil && fd.Name != nil && fd.Name.Name == testMainFunc {
+				return fd.Pos()
+			}
+		}
+	}
+	return token.NoPos
+}
+
+// insertionPoint returns the position right after the opening brace of body,
+// where a defer goleak.VerifyNone(t) should be inserted, and whether the rest
+// of the body (its first statement or closing brace) is on the same line
+func insertionPoint(fset *token.FileSet, body *ast.BlockStmt) (token.Pos, bool) {
+	next := body.Rbrace
+	if len(body.List) > 0 {
+		next = body.List[0].Pos()
+	}
+	sameLine := fset.Position(body.Lbrace).Line == fset.Position(next).Line
+	return body.Lbrace + 1, sameLine
+}
+
+// commentedVerifyRegex returns a regular expression matching a commented-out
+// goleak verification call made through one of names, the names goleak is
+// imported as, so that the verification functions of other packages, such as
+// mock.VerifyNone, don't count
+func commentedVerifyRegex(names []string) *regexp.Regexp {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = regexp.QuoteMeta(name)
+	}
+	return regexp.MustCompile(`(?:^|\s)(?:defer\s+)?(?:` + strings.Join(quoted, "|") + `)\.(?:` + verifyNone + `|` + verifyTestMain + `)\(`)
+}
+
+// hintCommentedOutVerify reports the first comment in the body of an
+// uncovered test that contains a goleak verification call through one of
+// names, which is often left behind by a refactor
+func hintCommentedOutVerify(pass *analysis.Pass, result *Result, testFunc testFuncInfo, names []string) {
+	if testFunc.body == nil || len(names) == 0 {
+		return
+	}
+	commented := commentedVerifyRegex(names)
+	for _, file := range pass.Files {
+		if testFunc.body.Pos() < file.Pos() || testFunc.body.End() > file.End() {
+			continue
+		}
+		for _, group := range file.Comments {
+			if group.Pos() < testFunc.body.Lbrace || group.End() > testFunc.body.Rbrace {
+				continue
+			}
+			for _, comment := range group.List {
+				if commented.MatchString(comment.Text[2:]) {
+					reportFinding(pass, result, comment.Pos(), testFunc.name, ReasonCommentedOutVerify)
+					return
+				}
 			}
 		}
+	}
+}
+
+// verifyDeferEdit returns where and what to insert to defer
+// alias.VerifyNone(param) at the start of body
+func verifyDeferEdit(fset *token.FileSet, body *ast.BlockStmt, alias, param string) (token.Pos, string) {
+	insertPos, sameLine := insertionPoint(fset, body)
+	text := fmt.Sprintf("\n\tdefer %s.%s(%s)", alias, verifyNone, param)
+	if sameLine {
+		text += "\n"
+	} else {
+		// Insert at the end of the brace's line to keep any trailing comment in place
+		tokFile := fset.File(insertPos)
+		insertPos = tokFile.LineStart(tokFile.Line(insertPos)+1) - 1
+	}
+	return insertPos, text
+}
+
+// enclosingFile returns the file of the package containing pos
+func enclosingFile(pass *analysis.Pass, pos token.Pos) *ast.File {
+	for _, file := range pass.Files {
+		if file.FileStart <= pos && pos < file.FileEnd {
+			return file
+		}
+	}
+	return nil
+}
+
+// reportFinding reports a finding about testFunc and records it in the result
+func reportFinding(pass *analysis.Pass, result *Result, pos token.Pos, testFunc string, reason Reason) {
+	reportMessage(pass, result, pos, testFunc, reason, reason.message(testFunc))
+}
+
+// reportMessage reports a diagnostic with the given message and records it in the result
+func reportMessage(pass *analysis.Pass, result *Result, pos token.Pos, testFunc string, reason Reason, message string) {
+	report(pass, result, analysis.Diagnostic{Pos: pos, Message: message}, Finding{TestFunc: testFunc, Reason: reason})
+}
+
+// report reports diag and records finding in the result, filling in the
+// fields the two have in common
+func report(pass *analysis.Pass, result *Result, diag analysis.Diagnostic, finding Finding) {
+	finding.Package = pass.Pkg.Path()
+	finding.Position = pass.Fset.Position(diag.Pos)
+	finding.Message = diag.Message
+	finding.Severity = finding.Reason.Severity()
+
+	result.Findings = append(result.Findings, finding)
+	result.diagnostics = append(result.diagnostics, diag)
+}
+
+// reportSorted sorts the findings recorded in result by filename, line and
+// column, keeping the recording order of findings at the same position, and
+// reports their diagnostics in that order. Output is then stable whatever
+// order the checks, or the workers processing the files, recorded them in.
+// The messages of both are rendered with template, unless it is empty.
+func reportSorted(pass *analysis.Pass, result *Result, template string) {
+	order := make([]int, len(result.Findings))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := result.Findings[order[i]].Position, result.Findings[order[j]].Position
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
 	})
 
-	return nil, nil
+	findings := make([]Finding, 0, len(order))
+	for _, i := range order {
+		finding, diag := result.Findings[i], result.diagnostics[i]
+		if template != "" {
+			finding.Message = finding.renderMessage(template)
+			diag.Message = finding.Message
+		}
+		findings = append(findings, finding)
+		pass.Report(diag)
+	}
+	result.Findings = findings
+	result.diagnostics = nil
 }
@@ -1,10 +1,27 @@
 package leakcheck_test
 
 import (
+	"fmt"
+	"go/ast"
+	"go/build/constraint"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
 	"testing"
 
 	"github.com/rleungx/leakcheck"
+	"golang.org/x/tools/go/analysis"
 	"golang.org/x/tools/go/analysis/analysistest"
+	"golang.org/x/tools/go/analysis/checker"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/inspector"
+	"golang.org/x/tools/go/packages"
 )
 
 func TestBasic(t *testing.T) {
@@ -27,6 +44,66 @@ func TestMainWithoutVerify(t *testing.T) {
 	analysistest.Run(t, testdata, leakcheck.Analyzer, "main_without_verify")
 }
 
+func TestShadowedAlias(t *testing.T) {
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, leakcheck.Analyzer, "shadowed")
+}
+
+func TestMainShadowedVerify(t *testing.T) {
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, leakcheck.Analyzer, "main_shadowed")
+}
+
+func TestMainExitCode(t *testing.T) {
+	config := &leakcheck.Config{
+		GoleakImportPaths:   []string{"third_party/goleak"},
+		VerifyTestMainFuncs: []string{"VerifyTestMain", "VerifyTestMainCode"},
+	}
+	analyzer := leakcheck.NewWithConfig(config)
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, analyzer, "testmain_exit", "testmain_exit_discarded", "testmain_exit_unused")
+}
+
+func TestVerifyTestMainInTest(t *testing.T) {
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, leakcheck.Analyzer, "verify_testmain_in_test")
+}
+
+func TestVerifyNoneInTestMain(t *testing.T) {
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, leakcheck.Analyzer, "verify_none_in_testmain", "verify_none_with_testmain")
+}
+
+func TestRequireDefer(t *testing.T) {
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, leakcheck.NewWithConfig(&leakcheck.Config{CheckRedundant: true}), "require_defer")
+}
+
+func TestDoubleImport(t *testing.T) {
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, leakcheck.NewWithConfig(&leakcheck.Config{CheckOptions: true}), "double_import")
+}
+
+func TestDeferredClosure(t *testing.T) {
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, leakcheck.Analyzer, "deferred_closure")
+}
+
+func TestMainIndirectVerify(t *testing.T) {
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, leakcheck.Analyzer, "main_indirect", "main_indirect_deep")
+}
+
+func TestMainClosureVerify(t *testing.T) {
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, leakcheck.Analyzer, "main_closure", "main_closure_outside")
+}
+
+func TestExternalTestPackage(t *testing.T) {
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, leakcheck.Analyzer, "xtest_main_internal", "xtest_main_external", "xtest_no_import")
+}
+
 func TestMultipleFiles(t *testing.T) {
 	testdata := analysistest.TestData()
 	analysistest.Run(t, testdata, leakcheck.Analyzer, "multiple_files")
@@ -107,3 +184,1009 @@ func TestAliasMain(t *testing.T) {
 	testdata := analysistest.TestData()
 	analysistest.Run(t, testdata, leakcheck.Analyzer, "alias_main")
 }
+
+func TestSignatures(t *testing.T) {
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, leakcheck.Analyzer, "signatures")
+}
+
+func TestNestedDefer(t *testing.T) {
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, leakcheck.Analyzer, "nested_defer")
+}
+
+func TestBlankImport(t *testing.T) {
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, leakcheck.Analyzer, "blank_import")
+}
+
+func TestCheckDeferOrder(t *testing.T) {
+	config := &leakcheck.Config{
+		CheckDeferOrder: true,
+	}
+	analyzer := leakcheck.NewWithConfig(config)
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, analyzer, "defer_order")
+}
+
+func TestExcludeBuildTags(t *testing.T) {
+	// Tagged files are only loaded when their tags are enabled
+	t.Setenv("GOFLAGS", "-tags=slow,integration")
+	config := &leakcheck.Config{
+		ExcludeBuildTags: []string{"integration"},
+	}
+	analyzer := leakcheck.NewWithConfig(config)
+	testdata := analysistest.TestData()
+	results := analysistest.Run(t, testdata, analyzer, "build_tags")
+
+	var tagged bool
+	for _, r := range results {
+		for _, test := range r.Result.(*leakcheck.Result).Tests {
+			if test.TestFunc == "TestIntegration" {
+				tagged = true
+				if test.Coverage != leakcheck.CoverageExcluded {
+					t.Errorf("unexpected coverage %v for TestIntegration", test.Coverage)
+				}
+			}
+		}
+	}
+	if !tagged {
+		t.Error("the tagged file was not analyzed")
+	}
+
+	// Files built without the tag don't require it, and are still reported
+	t.Run("negated", func(t *testing.T) {
+		t.Setenv("GOFLAGS", "-tags=slow")
+		analysistest.Run(t, testdata, analyzer, "build_tags")
+	})
+}
+
+func TestBuildConstraintCache(t *testing.T) {
+	parse := func(src string) *ast.File {
+		t.Helper()
+		file, err := parser.ParseFile(token.NewFileSet(), "tagged_test.go", src, parser.ParseComments)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+
+	first := leakcheck.BuildConstraint(parse("//go:build integration && !race\n\npackage p\n"))
+	if fmt.Sprint(first) != "integration && !race" {
+		t.Fatalf("got constraint %v, want integration && !race", first)
+	}
+	// The same line in another file, or the same file analyzed again, is not parsed again
+	if again := leakcheck.BuildConstraint(parse("// Package p\n//go:build integration && !race\n\npackage p\n")); again != first {
+		t.Errorf("got constraint %v, want the cached one", again)
+	}
+	if other := leakcheck.BuildConstraint(parse("//go:build e2e\n\npackage p\n")); fmt.Sprint(other) != "e2e" {
+		t.Errorf("got constraint %v, want e2e", other)
+	}
+	// Only comments before the package clause are constraints
+	if none := leakcheck.BuildConstraint(parse("package p\n\n//go:build e2e\n")); none != nil {
+		t.Errorf("got constraint %v, want none", none)
+	}
+}
+
+// BenchmarkBuildConstraint compares parsing the //go:build line of a file on
+// every analysis with reusing the cached constraint, as repeated runs do
+func BenchmarkBuildConstraint(b *testing.B) {
+	filename := filepath.Join("testdata", "src", "build_tags", "integration_test.go")
+	file, err := parser.ParseFile(token.NewFileSet(), filename, nil, parser.ParseComments)
+	if err != nil {
+		b.Fatal(err)
+	}
+	line := file.Comments[0].List[0].Text
+	b.Run("parse", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			if _, err := constraint.Parse(line); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			leakcheck.BuildConstraint(file)
+		}
+	})
+}
+
+func TestCheckCommentedOut(t *testing.T) {
+	config := &leakcheck.Config{
+		CheckCommentedOut: true,
+	}
+	analyzer := leakcheck.NewWithConfig(config)
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, analyzer, "commented_out", "commented_out_no_import")
+}
+
+func TestResultFindings(t *testing.T) {
+	testdata := analysistest.TestData()
+	results := analysistest.Run(t, testdata, leakcheck.Analyzer, "basic")
+
+	var findings []leakcheck.Finding
+	for _, r := range results {
+		result, ok := r.Result.(*leakcheck.Result)
+		if !ok {
+			t.Fatalf("unexpected result type %T", r.Result)
+		}
+		findings = append(findings, result.Findings...)
+	}
+
+	if len(findings) != 1 {
+		t.Fatalf("expected 1 finding, got %d", len(findings))
+	}
+	finding := findings[0]
+	if finding.TestFunc != "TestWithoutGoleak" {
+		t.Errorf("unexpected test function %q", finding.TestFunc)
+	}
+	if finding.Package != "basic" {
+		t.Errorf("unexpected package %q", finding.Package)
+	}
+	if finding.Reason != leakcheck.ReasonMissingDefer {
+		t.Errorf("unexpected reason %v", finding.Reason)
+	}
+	if finding.Severity != leakcheck.SeverityMedium {
+		t.Errorf("unexpected severity %v", finding.Severity)
+	}
+	if finding.Position.Line != 16 {
+		t.Errorf("unexpected line %d", finding.Position.Line)
+	}
+	if finding.Message != "test function TestWithoutGoleak is not covered by goleak (missing defer goleak.VerifyNone(t))" {
+		t.Errorf("unexpected message %q", finding.Message)
+	}
+}
+
+func TestMessageTemplate(t *testing.T) {
+	analyzer := leakcheck.NewWithConfig(&leakcheck.Config{
+		MessageTemplate: "{message}; {func} in {pkg}, see https://wiki.example.com/goleak#{reason}",
+	})
+	testdata := analysistest.TestData()
+	results := analysistest.Run(t, testdata, analyzer, "basic")
+
+	var messages []string
+	for _, r := range results {
+		for _, finding := range r.Result.(*leakcheck.Result).Findings {
+			messages = append(messages, finding.Message)
+		}
+	}
+	want := []string{"test function TestWithoutGoleak is not covered by goleak (missing defer goleak.VerifyNone(t)); " +
+		"TestWithoutGoleak in basic, see https://wiki.example.com/goleak#missing-defer"}
+	if !reflect.DeepEqual(messages, want) {
+		t.Errorf("got messages %q, want %q", messages, want)
+	}
+}
+
+func TestFindingColumns(t *testing.T) {
+	testdata := analysistest.TestData()
+	results := analysistest.Run(t, testdata, leakcheck.Analyzer, "columns")
+
+	var findings []leakcheck.Finding
+	for _, r := range results {
+		findings = append(findings, r.Result.(*leakcheck.Result).Findings...)
+	}
+	if len(findings) != 2 {
+		t.Fatalf("expected 2 findings, got %d", len(findings))
+	}
+	for _, finding := range findings {
+		src, err := os.ReadFile(finding.Position.Filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The position is the func keyword, whatever comments precede it
+		if !strings.HasPrefix(string(src[finding.Position.Offset:]), "func "+finding.TestFunc) {
+			t.Errorf("%s: position does not point at the func keyword", finding.TestFunc)
+		}
+		if finding.Position.Column != 1 {
+			t.Errorf("%s: unexpected column %d", finding.TestFunc, finding.Position.Column)
+		}
+		// Text output is file:line:col, like go vet
+		if want := fmt.Sprintf(":%d:1", finding.Position.Line); !strings.HasSuffix(finding.Position.String(), want) {
+			t.Errorf("%s: position %s does not end with %s", finding.TestFunc, finding.Position, want)
+		}
+	}
+}
+
+func TestFindingOrder(t *testing.T) {
+	// findings runs the analyzer over a package with findings recorded out
+	// of source order and returns them in report order
+	findings := func() []leakcheck.Finding {
+		var findings []leakcheck.Finding
+		for _, r := range analysistest.Run(t, analysistest.TestData(), leakcheck.Analyzer, "sorted") {
+			findings = append(findings, r.Result.(*leakcheck.Result).Findings...)
+		}
+		return findings
+	}
+
+	first := findings()
+	var got []string
+	for _, finding := range first {
+		got = append(got, fmt.Sprintf("%s:%d %s", filepath.Base(finding.Position.Filename), finding.Position.Line, finding.Reason))
+	}
+	want := []string{
+		"a_test.go:10 missing-defer",
+		"a_test.go:14 missing-defer",
+		"a_test.go:15 verify-testmain-in-test",
+		"b_test.go:6 missing-defer",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got findings in order %q, want %q", got, want)
+	}
+	if second := findings(); !reflect.DeepEqual(first, second) {
+		t.Errorf("findings differ between runs:\n%v\n%v", first, second)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	finding := leakcheck.Finding{
+		TestFunc: "TestA",
+		Package:  "example.com/a",
+		Reason:   leakcheck.ReasonMissingDefer,
+		Position: token.Position{Filename: "a/a_test.go", Line: 10, Column: 1},
+		Message:  "test function TestA is not covered by goleak (missing defer goleak.VerifyNone(t))",
+	}
+	moved := finding
+	moved.Position = token.Position{Filename: "a/b_test.go", Line: 42, Column: 1}
+	moved.Insertion = token.Position{Filename: "a/b_test.go", Line: 42, Column: 29}
+	if finding.Fingerprint() != moved.Fingerprint() {
+		t.Error("the fingerprint changed with the position")
+	}
+
+	for _, change := range []func(*leakcheck.Finding){
+		func(f *leakcheck.Finding) { f.TestFunc = "TestB" },
+		func(f *leakcheck.Finding) { f.Package = "example.com/b" },
+		func(f *leakcheck.Finding) { f.Reason = leakcheck.ReasonNoImport },
+	} {
+		changed := finding
+		change(&changed)
+		if finding.Fingerprint() == changed.Fingerprint() {
+			t.Errorf("the fingerprint did not change for %+v", changed)
+		}
+	}
+}
+
+func TestFingerprintAcrossEdits(t *testing.T) {
+	// fingerprints analyzes a test preceded by padding and returns the fingerprints of its findings
+	fingerprints := func(padding string) []string {
+		dir := t.TempDir()
+		src := filepath.Join(dir, "src", "fingerprint")
+		if err := os.MkdirAll(src, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		content := "package fingerprint\n\nimport \"testing\"\n" + padding +
+			"\nfunc TestUncovered(t *testing.T) {} // want `test function TestUncovered is not covered by goleak`\n"
+		if err := os.WriteFile(filepath.Join(src, "fingerprint_test.go"), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		var prints []string
+		for _, r := range analysistest.Run(t, dir, leakcheck.Analyzer, "fingerprint") {
+			for _, finding := range r.Result.(*leakcheck.Result).Findings {
+				prints = append(prints, finding.Fingerprint())
+			}
+		}
+		return prints
+	}
+
+	before := fingerprints("")
+	after := fingerprints("\n// An unrelated helper added above the test\nfunc helper() {}\n")
+	if len(before) != 1 || !slices.Equal(before, after) {
+		t.Errorf("fingerprints changed after an unrelated edit: %v, then %v", before, after)
+	}
+}
+
+func TestSupportedDetectors(t *testing.T) {
+	detectors := leakcheck.SupportedDetectors()
+	if len(detectors) != 1 || detectors[0].Name != "goleak" {
+		t.Fatalf("got detectors %+v, want goleak only", detectors)
+	}
+	goleak := detectors[0]
+	if want := []string{"go.uber.org/goleak", "github.com/uber-go/goleak"}; !reflect.DeepEqual(goleak.ImportPaths, want) {
+		t.Errorf("got import paths %v, want %v", goleak.ImportPaths, want)
+	}
+	if want := []string{"VerifyNone"}; !reflect.DeepEqual(goleak.VerifyFuncs, want) {
+		t.Errorf("got verify funcs %v, want %v", goleak.VerifyFuncs, want)
+	}
+	if want := []string{"VerifyTestMain"}; !reflect.DeepEqual(goleak.VerifyTestMainFuncs, want) {
+		t.Errorf("got verify TestMain funcs %v, want %v", goleak.VerifyTestMainFuncs, want)
+	}
+
+	// The detector is what an unconfigured analyzer recognizes
+	settings := leakcheck.DefaultConfig().Settings()
+	if !reflect.DeepEqual(settings["goleak-paths"], goleak.ImportPaths) || !reflect.DeepEqual(settings["verify-funcs"], goleak.VerifyFuncs) || !reflect.DeepEqual(settings["verify-testmain-funcs"], goleak.VerifyTestMainFuncs) {
+		t.Errorf("default settings %v don't match detector %+v", settings, goleak)
+	}
+}
+
+func TestPartialParse(t *testing.T) {
+	// An editor buffer being typed in, whose last declaration is cut short
+	src := `package partial
+
+import "testing"
+
+func TestUncovered(t *testing.T) {
+}
+
+func TestUnfinished(t *testing.T
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "partial_test.go", src, parser.ParseComments)
+	if err == nil {
+		t.Fatal("expected a parse error")
+	}
+	// Other parsers, and fixes applied by hand, may leave declarations unnamed
+	file.Decls = append(file.Decls, &ast.FuncDecl{Type: &ast.FuncType{Params: &ast.FieldList{}}, Body: &ast.BlockStmt{}})
+
+	files := []*ast.File{file}
+	analyzer := leakcheck.NewWithConfig(&leakcheck.Config{CheckExamples: true})
+	pass := &analysis.Pass{
+		Analyzer:  analyzer,
+		Fset:      fset,
+		Files:     files,
+		Pkg:       types.NewPackage("partial", "partial"),
+		TypesInfo: &types.Info{Defs: make(map[*ast.Ident]types.Object), Uses: make(map[*ast.Ident]types.Object)},
+		ResultOf:  map[*analysis.Analyzer]interface{}{inspect.Analyzer: inspector.New(files)},
+		Report:    func(analysis.Diagnostic) {},
+	}
+	value, err := analyzer.Run(pass)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, finding := range value.(*leakcheck.Result).Findings {
+		got = append(got, finding.TestFunc)
+	}
+	if want := []string{"TestUncovered", "TestUnfinished"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got findings %v, want %v", got, want)
+	}
+}
+
+func TestReasonString(t *testing.T) {
+	tests := []struct {
+		reason leakcheck.Reason
+		want   string
+	}{
+		{leakcheck.ReasonNoImport, "no-import"},
+		{leakcheck.ReasonMissingDefer, "missing-defer"},
+		{leakcheck.ReasonTestMainNoVerify, "testmain-no-verify"},
+		{leakcheck.ReasonTestMainExitCode, "testmain-exit-code"},
+		{leakcheck.ReasonNoTests, "no-tests"},
+		{leakcheck.ReasonVerifyTestMainInTest, "verify-testmain-in-test"},
+		{leakcheck.ReasonInvalidOption, "invalid-option"},
+		{leakcheck.ReasonVerifyNoneInTestMain, "verify-none-in-testmain"},
+		{leakcheck.ReasonRequireDefer, "require-defer"},
+		{leakcheck.ReasonConditionalCoverage, "conditional-coverage"},
+		{leakcheck.ReasonTestMainSetupGoroutine, "testmain-setup-goroutine"},
+		{leakcheck.Reason(0), "unknown"},
+	}
+	for _, tt := range tests {
+		if got := tt.reason.String(); got != tt.want {
+			t.Errorf("Reason(%d).String() = %q, want %q", tt.reason, got, tt.want)
+		}
+	}
+}
+
+func TestReasonSeverity(t *testing.T) {
+	tests := []struct {
+		reason leakcheck.Reason
+		want   leakcheck.Severity
+	}{
+		{leakcheck.ReasonNoImport, leakcheck.SeverityHigh},
+		{leakcheck.ReasonTestMainNoVerify, leakcheck.SeverityHigh},
+		{leakcheck.ReasonMissingDefer, leakcheck.SeverityMedium},
+		{leakcheck.ReasonSubtestMissingDefer, leakcheck.SeverityMedium},
+		{leakcheck.ReasonSuggestTestMain, leakcheck.SeverityLow},
+		{leakcheck.ReasonRedundantDefer, leakcheck.SeverityLow},
+		{leakcheck.ReasonConditionalCoverage, leakcheck.SeverityLow},
+		{leakcheck.ReasonTestMainSetupGoroutine, leakcheck.SeverityLow},
+	}
+	for _, tt := range tests {
+		if got := tt.reason.Severity(); got != tt.want {
+			t.Errorf("%v.Severity() = %v, want %v", tt.reason, got, tt.want)
+		}
+		// Every severity round-trips through its name
+		if got, err := leakcheck.ParseSeverity(tt.want.String()); err != nil || got != tt.want {
+			t.Errorf("ParseSeverity(%q) = %v, %v", tt.want.String(), got, err)
+		}
+	}
+	if _, err := leakcheck.ParseSeverity("critical"); err == nil {
+		t.Error("expected an error for an unknown severity")
+	}
+}
+
+func TestCheckSubtests(t *testing.T) {
+	config := &leakcheck.Config{
+		CheckSubtests: true,
+	}
+	analyzer := leakcheck.NewWithConfig(config)
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, analyzer, "subtests")
+}
+
+func TestCoveredBySubtests(t *testing.T) {
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, leakcheck.Analyzer, "subtests_covered")
+}
+
+func TestOnlyGoroutineStartingTests(t *testing.T) {
+	config := &leakcheck.Config{
+		OnlyGoroutineStartingTests: true,
+	}
+	analyzer := leakcheck.NewWithConfig(config)
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, analyzer, "only_goroutines", "only_goroutines_no_import")
+}
+
+func TestGroupNoImport(t *testing.T) {
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, leakcheck.NewWithConfig(&leakcheck.Config{GroupNoImport: true}), "group_no_import")
+
+	// Packages importing goleak are still reported per test
+	analysistest.Run(t, testdata, leakcheck.NewWithConfig(&leakcheck.Config{GroupNoImport: true}), "basic")
+}
+
+func TestRequireTests(t *testing.T) {
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, leakcheck.NewWithConfig(&leakcheck.Config{RequireTests: true}), "require_tests_none", "require_tests_some")
+
+	// Excluded packages may go without tests
+	config := &leakcheck.Config{RequireTests: true, ExcludePackages: "require_tests_excluded"}
+	analysistest.Run(t, testdata, leakcheck.NewWithConfig(config), "require_tests_excluded")
+}
+
+func TestConcurrentFiles(t *testing.T) {
+	chdir(t, "testdata/src")
+
+	// Load once, the analyzer runs are cheap enough to repeat many times
+	pkgs, err := packages.Load(&packages.Config{Mode: packages.LoadAllSyntax, Tests: true}, "./many_files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// findings runs the analyzer over the package, with enough files for the
+	// worker pool, and returns its findings in report order
+	findings := func(concurrency int) []leakcheck.Finding {
+		analyzer := leakcheck.NewWithConfig(&leakcheck.Config{Concurrency: concurrency})
+		graph, err := checker.Analyze([]*analysis.Analyzer{analyzer}, pkgs, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var findings []leakcheck.Finding
+		for _, act := range graph.Roots {
+			if result, ok := act.Result.(*leakcheck.Result); ok {
+				findings = append(findings, result.Findings...)
+			}
+		}
+		return findings
+	}
+
+	// Repeated runs give the scheduler a chance to reorder the workers, and
+	// the race detector, with go test -race, a chance to catch shared state
+	want := findings(1)
+	if len(want) != 6 {
+		t.Fatalf("expected 6 findings, got %d", len(want))
+	}
+	for i := 0; i < 200; i++ {
+		if got := findings(8); !reflect.DeepEqual(got, want) {
+			t.Fatalf("run %d: findings differ from a single worker:\n%v\n%v", i, got, want)
+		}
+	}
+}
+
+func TestCheckParallel(t *testing.T) {
+	config := &leakcheck.Config{
+		CheckParallel: true,
+	}
+	analyzer := leakcheck.NewWithConfig(config)
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, analyzer, "parallel", "parallel_with_main")
+}
+
+func TestNestedFunctionLiterals(t *testing.T) {
+	config := &leakcheck.Config{
+		CheckParallel: true,
+	}
+	analyzer := leakcheck.NewWithConfig(config)
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, analyzer, "nested_closures")
+}
+
+func TestExcludeFilesPathSeparators(t *testing.T) {
+	// Anchored so that only the extracted filename can match, not the full path
+	config := &leakcheck.Config{
+		ExcludeFiles: `^foo_test\.go$`,
+	}
+	tests := []struct {
+		filename string
+		want     bool
+	}{
+		{"/home/user/proj/pkg/foo_test.go", true},
+		{`C:\proj\pkg\foo_test.go`, true},
+		{`C:\proj/pkg\foo_test.go`, true},
+		{`C:/proj\pkg/foo_test.go`, true},
+		{"foo_test.go", true},
+		{`C:\proj\foo_test.go\bar_test.go`, false},
+		{"/home/user/proj/pkg/bar_test.go", false},
+	}
+	for _, tt := range tests {
+		if got := leakcheck.ShouldExcludeFile(tt.filename, config); got != tt.want {
+			t.Errorf("ShouldExcludeFile(%q) = %v, want %v", tt.filename, got, tt.want)
+		}
+	}
+}
+
+func TestAnchorPackagePatterns(t *testing.T) {
+	tests := []struct {
+		pkgPath  string
+		anchored bool
+		want     bool
+	}{
+		{"example.com/mocks", false, true},
+		{"example.com/mocks", true, true},
+		{"example.com/internal/mocks", false, true},
+		{"example.com/internal/mocks", true, true},
+		{"example.com/internal/mocks_test", true, true},
+		{"example.com/mockstore", false, true},
+		{"example.com/mockstore", true, false},
+		{"example.com/mocksrv", false, true},
+		{"example.com/mocksrv", true, false},
+		{"example.com/mocks/server", false, true},
+		{"example.com/mocks/server", true, false},
+	}
+	for _, tt := range tests {
+		config := &leakcheck.Config{
+			ExcludePackages:       "mocks",
+			AnchorPackagePatterns: tt.anchored,
+		}
+		if got := leakcheck.ShouldExcludePackage(tt.pkgPath, config); got != tt.want {
+			t.Errorf("ShouldExcludePackage(%q, anchored=%v) = %v, want %v", tt.pkgPath, tt.anchored, got, tt.want)
+		}
+	}
+
+	// Regex patterns are still matched against the full path
+	config := &leakcheck.Config{
+		ExcludePackages:       "mock.*",
+		AnchorPackagePatterns: true,
+	}
+	if !leakcheck.ShouldExcludePackage("example.com/mockstore", config) {
+		t.Error("expected regex pattern to match the full path")
+	}
+}
+
+func TestSuggestTestMain(t *testing.T) {
+	config := &leakcheck.Config{
+		TestMainSuggestThreshold: 2,
+	}
+	analyzer := leakcheck.NewWithConfig(config)
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, analyzer, "suggest_testmain", "suggest_testmain_below", "main_with_verify")
+}
+
+func TestVerifyArgument(t *testing.T) {
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, leakcheck.Analyzer, "verify_argument")
+}
+
+func TestCheckExamples(t *testing.T) {
+	config := &leakcheck.Config{
+		CheckExamples: true,
+	}
+	analyzer := leakcheck.NewWithConfig(config)
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, analyzer, "examples", "examples_with_main", "examples_no_import")
+}
+
+func TestSuggestedFix(t *testing.T) {
+	testdata := analysistest.TestData()
+	results := analysistest.RunWithSuggestedFixes(t, testdata, leakcheck.Analyzer, "suggested_fix")
+
+	// The insertion point is right after the opening brace of each test body
+	want := map[string]string{
+		"TestMultiLine": "suggested_fix_test.go:15:35",
+		"TestEmpty":     "suggested_fix_test.go:19:31",
+		"TestSameLine":  "suggested_fix_test.go:21:35",
+		"TestUnnamed":   "suggested_fix_test.go:23:31",
+	}
+	for _, r := range results {
+		for _, finding := range r.Result.(*leakcheck.Result).Findings {
+			insertion := finding.Insertion
+			got := fmt.Sprintf("%s:%d:%d", filepath.Base(insertion.Filename), insertion.Line, insertion.Column)
+			if got != want[finding.TestFunc] {
+				t.Errorf("insertion point of %s = %s, want %s", finding.TestFunc, got, want[finding.TestFunc])
+			}
+		}
+	}
+}
+
+func TestSuggestedFixImport(t *testing.T) {
+	// The fix imports goleak in files that don't, whether or not other files
+	// of the package do
+	testdata := analysistest.TestData()
+	analysistest.RunWithSuggestedFixes(t, testdata, leakcheck.Analyzer, "suggested_fix_import", "suggested_fix_other_file")
+}
+
+func TestCheckHelpers(t *testing.T) {
+	config := &leakcheck.Config{
+		CheckHelpers: true,
+	}
+	analyzer := leakcheck.NewWithConfig(config)
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, analyzer, "helpers")
+}
+
+func TestCheckOptions(t *testing.T) {
+	config := &leakcheck.Config{
+		CheckOptions: true,
+	}
+	analyzer := leakcheck.NewWithConfig(config)
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, analyzer, "verify_options")
+
+	// Options of a fork goleak doesn't have are unknown
+	config = &leakcheck.Config{
+		CheckOptions:      true,
+		GoleakImportPaths: []string{"third_party/goleak"},
+	}
+	analysistest.Run(t, testdata, leakcheck.NewWithConfig(config), "verify_options_fork")
+}
+
+func TestTestPrefixes(t *testing.T) {
+	config := &leakcheck.Config{
+		TestPrefixes: []string{"Test", "ITest"},
+	}
+	analyzer := leakcheck.NewWithConfig(config)
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, analyzer, "test_prefixes")
+}
+
+func TestPackageRules(t *testing.T) {
+	config := &leakcheck.Config{
+		ExcludeFunctions: "TestOwned",
+		PackageRules: []leakcheck.PackageRule{
+			{Packages: "^package_.*", ExcludeFunctions: "TestOwned"},
+			{Packages: "package_rules", ExcludeFunctions: "TestLegacy*"},
+			{Packages: "other", ExcludeFunctions: "Test*"},
+		},
+	}
+	analyzer := leakcheck.NewWithConfig(config)
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, analyzer, "package_rules")
+}
+
+func TestExcludeFunctions(t *testing.T) {
+	config := &leakcheck.Config{
+		ExcludeFunctions: "TestLegacy*",
+	}
+	analyzer := leakcheck.NewWithConfig(config)
+	testdata := analysistest.TestData()
+	results := analysistest.Run(t, testdata, analyzer, "exclude_functions")
+	for _, r := range results {
+		result := r.Result.(*leakcheck.Result)
+		for _, test := range result.Tests {
+			if test.TestFunc == "TestLegacyWithoutGoleak" && test.Coverage != leakcheck.CoverageExcluded {
+				t.Errorf("expected %s to be excluded, got %v", test.TestFunc, test.Coverage)
+			}
+		}
+	}
+}
+
+func TestCheckRedundant(t *testing.T) {
+	config := &leakcheck.Config{
+		CheckRedundant: true,
+	}
+	analyzer := leakcheck.NewWithConfig(config)
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, analyzer, "redundant_defer", "main_with_verify")
+}
+
+func TestSuppression(t *testing.T) {
+	config := &leakcheck.Config{
+		ExcludeFunctions: "TestExcludedByName",
+	}
+	analyzer := leakcheck.NewWithConfig(config)
+	testdata := analysistest.TestData()
+	results := analysistest.Run(t, testdata, analyzer, "suppress", "suppress_no_import")
+
+	for _, r := range results {
+		result := r.Result.(*leakcheck.Result)
+		for _, test := range result.Tests {
+			want := leakcheck.CoverageExcluded
+			switch test.TestFunc {
+			case "TestReported", "TestNolintOtherLinter", "TestNotSuppressed":
+				want = leakcheck.CoverageNone
+			case "TestWithGoleak":
+				want = leakcheck.CoverageDefer
+			}
+			if test.Coverage != want {
+				t.Errorf("%s.%s: got %v, want %v", result.Package, test.TestFunc, test.Coverage, want)
+			}
+		}
+	}
+}
+
+func TestDocCommentSkip(t *testing.T) {
+	testdata := analysistest.TestData()
+	results := analysistest.Run(t, testdata, leakcheck.Analyzer, "doc_skip")
+
+	for _, r := range results {
+		for _, test := range r.Result.(*leakcheck.Result).Tests {
+			want := leakcheck.CoverageNone
+			switch test.TestFunc {
+			case "TestWithGoleak":
+				want = leakcheck.CoverageDefer
+			case "TestDocSkipped", "TestDirectiveSkipped", "TestDocSkippedVerify":
+				want = leakcheck.CoverageExcluded
+			}
+			if test.Coverage != want {
+				t.Errorf("%s: got %v, want %v", test.TestFunc, test.Coverage, want)
+			}
+		}
+	}
+}
+
+func TestPackageIgnore(t *testing.T) {
+	testdata := analysistest.TestData()
+	results := analysistest.Run(t, testdata, leakcheck.Analyzer, "package_ignore", "package_ignore_file")
+
+	tests := 0
+	for _, r := range results {
+		for _, test := range r.Result.(*leakcheck.Result).Tests {
+			tests++
+			if test.Coverage != leakcheck.CoverageExcluded {
+				t.Errorf("%s.%s: got %v, want %v", test.Package, test.TestFunc, test.Coverage, leakcheck.CoverageExcluded)
+			}
+		}
+	}
+	if tests == 0 {
+		t.Error("expected the acknowledged tests to be listed as excluded")
+	}
+}
+
+func TestStrict(t *testing.T) {
+	config := &leakcheck.Config{
+		Strict: true,
+	}
+	analyzer := leakcheck.NewWithConfig(config)
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, analyzer, "strict", "strict_testmain")
+
+	// Outside strict mode only the plain trailing call is reported
+	chdir(t, filepath.Join(testdata, "src"))
+	findings, err := leakcheck.Analyze(&leakcheck.Config{}, "./strict", "./strict_testmain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reported []string
+	for _, finding := range findings {
+		reported = append(reported, finding.TestFunc)
+	}
+	if fmt.Sprint(reported) != "[TestTrailingCall]" {
+		t.Errorf("unexpected findings outside strict mode: %v", reported)
+	}
+}
+
+func TestRelatedInformation(t *testing.T) {
+	testdata := analysistest.TestData()
+	results := analysistest.Run(t, testdata, leakcheck.Analyzer, "basic", "main_without_verify")
+
+	related := make(map[string][]string)
+	for _, r := range results {
+		for _, diag := range r.Diagnostics {
+			for _, rel := range diag.Related {
+				pos := r.Pass.Fset.Position(rel.Pos)
+				related[diag.Message] = append(related[diag.Message], fmt.Sprintf("%s:%d: %s", filepath.Base(pos.Filename), pos.Line, rel.Message))
+			}
+		}
+	}
+
+	tests := []struct {
+		message string
+		want    []string
+	}{
+		{
+			"test function TestWithoutGoleak is not covered by goleak (missing defer goleak.VerifyNone(t))",
+			[]string{"basic_test.go:16: insert defer goleak.VerifyNone(t) here"},
+		},
+		{
+			"test function TestWithoutVerify is not covered by goleak (TestMain exists but doesn't call goleak.VerifyTestMain)",
+			[]string{
+				"main_without_verify_test.go:20: TestMain can cover every test with goleak.VerifyTestMain(m)",
+				"main_without_verify_test.go:11: insert defer goleak.VerifyNone(t) here",
+			},
+		},
+	}
+	for _, tt := range tests {
+		if got := related[tt.message]; fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("related information for %q:\n got %v\nwant %v", tt.message, got, tt.want)
+		}
+	}
+}
+
+func TestCheckSuites(t *testing.T) {
+	config := &leakcheck.Config{
+		CheckSuites: true,
+	}
+	analyzer := leakcheck.NewWithConfig(config)
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, analyzer, "suites")
+}
+
+func TestGoleakImportPaths(t *testing.T) {
+	config := &leakcheck.Config{
+		GoleakImportPaths: []string{"go.uber.org/goleak", `"third_party/goleak"`},
+	}
+	analyzer := leakcheck.NewWithConfig(config)
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, analyzer, "goleak_paths", "basic")
+}
+
+func TestVerifyFuncs(t *testing.T) {
+	config := &leakcheck.Config{
+		GoleakImportPaths:   []string{"third_party/goleak"},
+		VerifyFuncs:         []string{"VerifyNoneWithContext"},
+		VerifyTestMainFuncs: []string{"VerifyTestMainWithContext"},
+	}
+	analyzer := leakcheck.NewWithConfig(config)
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, analyzer, "verify_funcs", "verify_funcs_main")
+}
+
+func TestVerifyStoredFunc(t *testing.T) {
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, leakcheck.Analyzer, "verify_value")
+}
+
+func TestResultStats(t *testing.T) {
+	testdata := analysistest.TestData()
+	results := analysistest.Run(t, testdata, leakcheck.Analyzer, "basic")
+
+	for _, r := range results {
+		result := r.Result.(*leakcheck.Result)
+		if result.Stats.Files != len(r.Pass.Files) {
+			t.Errorf("expected %d files, got %d", len(r.Pass.Files), result.Stats.Files)
+		}
+		if result.Stats.Duration <= 0 {
+			t.Errorf("expected a positive duration, got %v", result.Stats.Duration)
+		}
+	}
+}
+
+func TestSkipGenerated(t *testing.T) {
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, leakcheck.Analyzer, "generated")
+
+	// A configuration built by hand leaves SkipGenerated off
+	chdir(t, filepath.Join(testdata, "src"))
+	findings, err := leakcheck.Analyze(&leakcheck.Config{}, "./generated")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reported []string
+	for _, finding := range findings {
+		reported = append(reported, finding.TestFunc)
+	}
+	sort.Strings(reported)
+	if fmt.Sprint(reported) != "[TestGeneratedWithoutGoleak TestWithoutGoleak]" {
+		t.Errorf("unexpected findings with SkipGenerated off: %v", reported)
+	}
+}
+
+func TestUnreachableDefer(t *testing.T) {
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, leakcheck.Analyzer, "unreachable_defer")
+}
+
+func TestIgnoredTopFunctions(t *testing.T) {
+	config := &leakcheck.Config{
+		IgnoredTopFunctions: []string{"ignored_top_functions.(*flusher).run"},
+	}
+	analyzer := leakcheck.NewWithConfig(config)
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, analyzer, "ignored_top_functions")
+}
+
+func TestIncludeVendor(t *testing.T) {
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, leakcheck.NewWithConfig(&leakcheck.Config{IncludeVendor: true}), "vendored/vendor/example.com/owned")
+
+	// Only a whole vendor path element marks a vendored file
+	tests := []struct {
+		filename string
+		want     bool
+	}{
+		{"/repo/vendor/example.com/owned/owned_test.go", true},
+		{`C:\repo\vendor\example.com\owned\owned_test.go`, true},
+		{"/repo/myvendor/owned_test.go", false},
+		{"/repo/pkg/vendor_test.go", false},
+	}
+	for _, tt := range tests {
+		if got := leakcheck.ShouldExcludeFile(tt.filename, leakcheck.DefaultConfig()); got != tt.want {
+			t.Errorf("ShouldExcludeFile(%q) = %v, want %v", tt.filename, got, tt.want)
+		}
+		if leakcheck.ShouldExcludeFile(tt.filename, &leakcheck.Config{IncludeVendor: true}) {
+			t.Errorf("ShouldExcludeFile(%q) = true with IncludeVendor", tt.filename)
+		}
+	}
+}
+
+func TestExcludeDirs(t *testing.T) {
+	config := &leakcheck.Config{
+		ExcludeDirs: []string{"third_party", "internal/gen/", "/abs/skip"},
+	}
+	tests := []struct {
+		filename string
+		want     bool
+	}{
+		{"/repo/third_party/lib/lib_test.go", true},
+		{"third_party/lib_test.go", true},
+		{`C:\repo\third_party\lib_test.go`, true},
+		{"/repo/pkg/internal/gen/gen_test.go", true},
+		{"/abs/skip/pkg/pkg_test.go", true},
+		{"/repo/abs/skip/pkg_test.go", false},
+		{"/repo/my_third_party/lib_test.go", false},
+		{"/repo/internal/generated/gen_test.go", false},
+		{"/repo/pkg/third_party_test.go", false},
+	}
+	for _, tt := range tests {
+		if got := leakcheck.ShouldExcludeFile(tt.filename, config); got != tt.want {
+			t.Errorf("ShouldExcludeFile(%q) = %v, want %v", tt.filename, got, tt.want)
+		}
+	}
+}
+
+func TestFlagConditionalCoverage(t *testing.T) {
+	testdata := analysistest.TestData()
+	analyzer := leakcheck.NewWithConfig(&leakcheck.Config{FlagConditionalCoverage: true})
+	analysistest.Run(t, testdata, analyzer, "conditional_coverage")
+
+	// Strict mode doesn't count conditional coverage, so there is nothing to note
+	analyzer = leakcheck.NewWithConfig(&leakcheck.Config{Strict: true, FlagConditionalCoverage: true})
+	analysistest.Run(t, testdata, analyzer, "strict")
+}
+
+func TestCheckTestMainSetup(t *testing.T) {
+	testdata := analysistest.TestData()
+	analyzer := leakcheck.NewWithConfig(&leakcheck.Config{CheckTestMainSetup: true})
+	analysistest.Run(t, testdata, analyzer, "testmain_setup", "testmain_setup_run", "testmain_setup_ignore")
+}
+
+func TestAnalyzerFlags(t *testing.T) {
+	config := &leakcheck.Config{}
+	analyzer := leakcheck.NewWithConfig(config)
+	for name, value := range map[string]string{
+		"exclude-functions": "TestLegacy*",
+		"test-prefixes":     "Test, ITest",
+		"strict":            "true",
+	} {
+		if err := analyzer.Flags.Set(name, value); err != nil {
+			t.Fatalf("setting -%s: %v", name, err)
+		}
+	}
+	if config.ExcludeFunctions != "TestLegacy*" {
+		t.Errorf("unexpected ExcludeFunctions %q", config.ExcludeFunctions)
+	}
+	if fmt.Sprint(config.TestPrefixes) != "[Test ITest]" {
+		t.Errorf("unexpected TestPrefixes %q", config.TestPrefixes)
+	}
+	if !config.Strict || !config.CheckSubtests || !config.CheckParallel {
+		t.Errorf("-strict did not enable the strict checks: %+v", config)
+	}
+	if err := analyzer.Flags.Set("concurrency", "0"); err == nil {
+		t.Error("expected an error for -concurrency=0")
+	}
+
+	// The flags take effect when the analyzer runs
+	analyzer = leakcheck.New()
+	if err := analyzer.Flags.Set("exclude-functions", "TestLegacy*"); err != nil {
+		t.Fatal(err)
+	}
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, analyzer, "exclude_functions")
+}
+
+func TestGoVersion(t *testing.T) {
+	testdata := analysistest.TestData()
+	// t.Cleanup only covers tests of code targeting Go 1.14 or later
+	analysistest.Run(t, testdata, leakcheck.NewWithConfig(&leakcheck.Config{GoVersion: "1.13"}), "cleanup_go113")
+	analysistest.Run(t, testdata, leakcheck.NewWithConfig(&leakcheck.Config{GoVersion: "go1.14"}), "cleanup_go114")
+}
@@ -0,0 +1,75 @@
+package leakcheck
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// manifest lists the packages checked when Config.ManifestFile is set
+type manifest struct {
+	path     string
+	patterns []*regexp.Regexp
+}
+
+// readManifest reads the manifest file at path, one package per line: an
+// import path, a glob in which * matches within a path element, or a pattern
+// with ... as in go list, e.g. example.com/store/... for the store package
+// and every package below it. Blank lines and lines starting with # are
+// skipped. An empty path reads no manifest, which includes every package.
+func readManifest(path string) (*manifest, error) {
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("manifest-file: %w", err)
+	}
+	defer f.Close()
+
+	m := &manifest{path: path}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		m.patterns = append(m.patterns, manifestPattern(line))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("manifest-file: %s: %w", path, err)
+	}
+	return m, nil
+}
+
+// manifestPattern compiles a manifest entry into a regular expression
+// matching the whole import path. A trailing /... also matches the package
+// itself, as in go list.
+func manifestPattern(entry string) *regexp.Regexp {
+	prefix, tree := strings.CutSuffix(entry, "/...")
+	expr := regexp.QuoteMeta(prefix)
+	expr = strings.ReplaceAll(expr, `\.\.\.`, `.*`)
+	expr = strings.ReplaceAll(expr, `\*`, `[^/]*`)
+	if tree {
+		expr += `(/.*)?`
+	}
+	return regexp.MustCompile("^" + expr + "$")
+}
+
+// includes checks if the manifest lists the package pkgPath. External test
+// packages and generated test mains follow the package they test, and a nil
+// manifest includes every package.
+func (m *manifest) includes(pkgPath string) bool {
+	if m == nil {
+		return true
+	}
+	pkgPath = strings.TrimSuffix(strings.TrimSuffix(pkgPath, ".test"), "_test")
+	for _, pattern := range m.patterns {
+		if pattern.MatchString(pkgPath) {
+			return true
+		}
+	}
+	return false
+}
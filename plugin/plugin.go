@@ -0,0 +1,68 @@
+// Package main provides a golangci-lint plugin for leakcheck.
+//
+// Build it with go build -buildmode=plugin and register it in .golangci.yml:
+//
+//	linters-settings:
+//	  custom:
+//	    leakcheck:
+//	      path: leakcheck.so
+//	      description: check that all tests are covered by goleak
+//	      settings:
+//	        exclude-packages: vendor,internal
+//	        exclude-files: mock_test.go
+package main
+
+import (
+	"fmt"
+
+	"github.com/rleungx/leakcheck"
+	"golang.org/x/tools/go/analysis"
+)
+
+// driverSettings are the settings applied to the findings of a whole run by
+// the leakcheck drivers or command line tool, which the plugin doesn't use
+var driverSettings = []string{"dedupe", "max-findings"}
+
+// New is the entrypoint looked up by golangci-lint. conf holds the plugin
+// settings from .golangci.yml, which may be nil when none are given.
+func New(conf any) ([]*analysis.Analyzer, error) {
+	config, err := decodeSettings(conf)
+	if err != nil {
+		return nil, err
+	}
+	return []*analysis.Analyzer{leakcheck.NewWithConfig(config)}, nil
+}
+
+// decodeSettings maps the plugin settings onto a leakcheck configuration
+func decodeSettings(conf any) (*leakcheck.Config, error) {
+	config := leakcheck.DefaultConfig()
+	if conf == nil {
+		return config, nil
+	}
+
+	settings, ok := conf.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("leakcheck: settings must be a map, got %T", conf)
+	}
+
+	// golangci-lint runs the analyzer package by package, leaving nothing to
+	// aggregate the findings of a run
+	for _, key := range driverSettings {
+		if _, ok := settings[key]; ok {
+			return nil, fmt.Errorf("leakcheck: %q is not supported by the plugin, only by the command line tool", key)
+		}
+	}
+
+	if err := config.ApplySettings(settings); err != nil {
+		return nil, fmt.Errorf("leakcheck: %w", err)
+	}
+	// Fail when golangci-lint loads the plugin rather than on every package
+	if err := config.Validate(); err != nil && !config.IgnoreBadPatterns {
+		return nil, fmt.Errorf("leakcheck: %w", err)
+	}
+	return config, nil
+}
+
+// main is never called; it only exists so that the package also builds as
+// part of go build ./... rather than solely with -buildmode=plugin
+func main() {}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// golangciConfig is the part of .golangci.yml relevant to the plugin
+const golangciConfig = `
+linters-settings:
+  custom:
+    leakcheck:
+      path: leakcheck.so
+      settings:
+        exclude-packages:
+          - vendor
+          - internal
+        exclude-files: mock_test.go
+        concurrency: 4
+        timeout: 10m
+        check-subtests: true
+        test-prefixes: Test, ITest
+`
+
+func TestDecodeSettings(t *testing.T) {
+	var raw struct {
+		LintersSettings struct {
+			Custom map[string]struct {
+				Settings any `yaml:"settings"`
+			} `yaml:"custom"`
+		} `yaml:"linters-settings"`
+	}
+	if err := yaml.Unmarshal([]byte(golangciConfig), &raw); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := decodeSettings(raw.LintersSettings.Custom["leakcheck"].Settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ExcludePackages != "vendor,internal" {
+		t.Errorf("unexpected exclude packages %q", config.ExcludePackages)
+	}
+	if config.ExcludeFiles != "mock_test.go" {
+		t.Errorf("unexpected exclude files %q", config.ExcludeFiles)
+	}
+	if config.Concurrency != 4 {
+		t.Errorf("unexpected concurrency %d", config.Concurrency)
+	}
+	if config.Timeout != 10*time.Minute {
+		t.Errorf("unexpected timeout %v", config.Timeout)
+	}
+	if len(config.TestPrefixes) != 2 || config.TestPrefixes[0] != "Test" || config.TestPrefixes[1] != "ITest" {
+		t.Errorf("unexpected test prefixes %q", config.TestPrefixes)
+	}
+	if !config.CheckSubtests || config.CheckParallel {
+		t.Errorf("unexpected checks: subtests=%v parallel=%v", config.CheckSubtests, config.CheckParallel)
+	}
+}
+
+func TestDecodeSettingsErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		conf any
+	}{
+		{"not a map", []any{"vendor"}},
+		{"unknown key", map[string]any{"exclude-folders": "vendor"}},
+		{"bad concurrency", map[string]any{"concurrency": "four"}},
+		{"bad timeout", map[string]any{"timeout": "soon"}},
+		{"bad pattern", map[string]any{"exclude-files": []any{1}}},
+		{"invalid regexp", map[string]any{"exclude-functions": "Test(Slow"}},
+		{"driver setting", map[string]any{"dedupe": true}},
+		{"command line setting", map[string]any{"max-findings": 50}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeSettings(tt.conf); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	analyzers, err := New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(analyzers) != 1 || analyzers[0].Name != "leakcheck" {
+		t.Fatalf("unexpected analyzers %v", analyzers)
+	}
+}
@@ -0,0 +1,356 @@
+package leakcheck
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// Reporter receives findings one at a time, decoupling their production from
+// how they are presented. Report is called for every finding, in order, then
+// Flush once at the end. Reporters that can't write a finding right away, such
+// as those producing a single document, buffer it until Flush. Errors writing
+// a finding are returned by Flush.
+type Reporter interface {
+	Report(Finding)
+	Flush() error
+}
+
+// Formats of the built-in reporters, as accepted by NewReporter
+const (
+	FormatText       = "text"
+	FormatJSON       = "json"
+	FormatSARIF      = "sarif"
+	FormatCheckstyle = "checkstyle"
+	FormatGitHub     = "github"
+)
+
+// NewReporter returns the built-in reporter for format writing to w
+func NewReporter(format string, w io.Writer) (Reporter, error) {
+	switch format {
+	case FormatText:
+		return NewTextReporter(w), nil
+	case FormatJSON:
+		return NewJSONReporter(w), nil
+	case FormatSARIF:
+		return NewSARIFReporter(w), nil
+	case FormatCheckstyle:
+		return NewCheckstyleReporter(w), nil
+	case FormatGitHub:
+		return NewGitHubReporter(w), nil
+	default:
+		return nil, fmt.Errorf("unknown format %q, want %s, %s, %s, %s or %s", format, FormatText, FormatJSON, FormatSARIF, FormatCheckstyle, FormatGitHub)
+	}
+}
+
+// AnalyzeReport is like AnalyzeContext but also streams the findings to
+// reporter: those of each package are reported as soon as its analysis
+// completes, so in completion rather than load order, and never concurrently.
+// The reporter is flushed at the end, even when the run fails or is canceled,
+// so that it can close what the findings already reported were written to.
+// With config.Dedupe, the first repeat of an issue to complete is reported.
+func AnalyzeReport(ctx context.Context, config *Config, reporter Reporter, patterns ...string) ([]*Result, error) {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	seen := make(map[string]bool)
+	results, err := analyzeContext(ctx, config, 0, func(_ string, results []*Result, _, _ int) {
+		for _, result := range results {
+			for _, finding := range result.Findings {
+				if config.Dedupe {
+					key := dedupeKey(finding)
+					if seen[key] {
+						continue
+					}
+					seen[key] = true
+				}
+				reporter.Report(finding)
+			}
+		}
+	}, patterns...)
+	flushErr := reporter.Flush()
+	if err != nil {
+		return nil, err
+	}
+	return results, flushErr
+}
+
+// textReporter writes each finding as file:line:col: message, like go vet
+type textReporter struct {
+	w   io.Writer
+	err error
+}
+
+// NewTextReporter returns the default reporter, which writes each finding as
+// a file:line:col: message line as soon as it is reported
+func NewTextReporter(w io.Writer) Reporter {
+	return &textReporter{w: w}
+}
+
+func (r *textReporter) Report(finding Finding) {
+	if r.err == nil {
+		_, r.err = fmt.Fprintf(r.w, "%s: %s\n", finding.Position, finding.Message)
+	}
+}
+
+func (r *textReporter) Flush() error {
+	return r.err
+}
+
+// githubReporter writes each finding as a GitHub Actions workflow command
+type githubReporter struct {
+	w   io.Writer
+	err error
+}
+
+// NewGitHubReporter returns a reporter writing each finding as soon as it is
+// reported as a GitHub Actions workflow command, such as
+// ::warning file=a_test.go,line=10,col=1::message, which the runner turns into
+// an annotation shown inline on pull requests. GitHub matches the file
+// against the repository, so paths should be relative to its root.
+func NewGitHubReporter(w io.Writer) Reporter {
+	return &githubReporter{w: w}
+}
+
+func (r *githubReporter) Report(finding Finding) {
+	if r.err == nil {
+		_, r.err = fmt.Fprintf(r.w, "::%s file=%s,line=%d,col=%d::%s\n", githubLevel(finding.Severity),
+			githubEscapeProperty(finding.Position.Filename), finding.Position.Line, finding.Position.Column, githubEscapeData(finding.Message))
+	}
+}
+
+func (r *githubReporter) Flush() error {
+	return r.err
+}
+
+// githubLevel maps a severity to the workflow command of its annotation
+func githubLevel(severity Severity) string {
+	switch severity {
+	case SeverityHigh:
+		return "error"
+	case SeverityLow:
+		return "notice"
+	default:
+		return "warning"
+	}
+}
+
+// githubEscapeData escapes the message of a workflow command, which ends at
+// the line break, as the Actions toolkit does
+func githubEscapeData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// githubEscapeProperty escapes a property value of a workflow command, which
+// is also delimited by , and :
+func githubEscapeProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
+
+// jsonFinding is the JSON encoding of a finding
+type jsonFinding struct {
+	Package  string `json:"package"`
+	TestFunc string `json:"test,omitempty"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Reason   string `json:"reason"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+
+	Fingerprint string `json:"fingerprint"`
+}
+
+// jsonReporter writes each finding as a JSON object on its own line
+type jsonReporter struct {
+	enc *json.Encoder
+	err error
+}
+
+// NewJSONReporter returns a reporter writing each finding as soon as it is
+// reported, as a JSON object on its own line (JSON Lines)
+func NewJSONReporter(w io.Writer) Reporter {
+	return &jsonReporter{enc: json.NewEncoder(w)}
+}
+
+func (r *jsonReporter) Report(finding Finding) {
+	if r.err != nil {
+		return
+	}
+	r.err = r.enc.Encode(jsonFinding{
+		Package:  finding.Package,
+		TestFunc: finding.TestFunc,
+		File:     finding.Position.Filename,
+		Line:     finding.Position.Line,
+		Column:   finding.Position.Column,
+		Reason:   finding.Reason.String(),
+		Severity: finding.Severity.String(),
+		Message:  finding.Message,
+
+		Fingerprint: finding.Fingerprint(),
+	})
+}
+
+func (r *jsonReporter) Flush() error {
+	return r.err
+}
+
+// bufferedReporter collects the findings and writes them as one document on Flush
+type bufferedReporter struct {
+	findings []Finding
+	write    func([]Finding) error
+}
+
+func (r *bufferedReporter) Report(finding Finding) {
+	r.findings = append(r.findings, finding)
+}
+
+func (r *bufferedReporter) Flush() error {
+	err := r.write(r.findings)
+	r.findings = nil
+	return err
+}
+
+// NewCheckstyleReporter returns a reporter writing the findings as a
+// checkstyle XML document on Flush, see WriteCheckstyle
+func NewCheckstyleReporter(w io.Writer) Reporter {
+	return &bufferedReporter{write: func(findings []Finding) error {
+		return WriteCheckstyle(w, findings)
+	}}
+}
+
+// NewSARIFReporter returns a reporter writing the findings as a SARIF 2.1.0
+// log on Flush, as consumed by GitHub code scanning
+func NewSARIFReporter(w io.Writer) Reporter {
+	return &bufferedReporter{write: func(findings []Finding) error {
+		return writeSARIF(w, findings)
+	}}
+}
+
+// SARIF version and schema of the logs written by NewSARIFReporter
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifToolURI = "https://github.com/rleungx/leakcheck"
+
+	sarifFingerprintKey = "leakcheckFingerprint/v1"
+)
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID              string            `json:"ruleId"`
+	Level               string            `json:"level"`
+	Message             sarifMessage      `json:"message"`
+	Locations           []sarifLocation   `json:"locations"`
+	PartialFingerprints map[string]string `json:"partialFingerprints"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
+
+// writeSARIF writes findings as a SARIF log with one rule per reason found
+func writeSARIF(w io.Writer, findings []Finding) error {
+	driver := sarifDriver{Name: analyzerName, InformationURI: sarifToolURI, Rules: []sarifRule{}}
+	results := make([]sarifResult, 0, len(findings))
+	seen := make(map[Reason]bool)
+	for _, finding := range findings {
+		if !seen[finding.Reason] {
+			seen[finding.Reason] = true
+			driver.Rules = append(driver.Rules, sarifRule{
+				ID:               finding.Reason.String(),
+				ShortDescription: sarifMessage{Text: finding.Reason.description()},
+			})
+		}
+		results = append(results, sarifResult{
+			RuleID:  finding.Reason.String(),
+			Level:   sarifLevel(finding.Severity),
+			Message: sarifMessage{Text: finding.Message},
+			Locations: []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: sarifURI(finding.Position.Filename)},
+				Region:           sarifRegion{StartLine: finding.Position.Line, StartColumn: finding.Position.Column},
+			}}},
+			// Lets code scanning track the result across commits that move it
+			PartialFingerprints: map[string]string{sarifFingerprintKey: finding.Fingerprint()},
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{
+		Version: sarifVersion,
+		Schema:  sarifSchema,
+		Runs:    []sarifRun{{Tool: sarifTool{Driver: driver}, Results: results}},
+	})
+}
+
+// sarifLevel maps a severity to a SARIF result level
+func sarifLevel(severity Severity) string {
+	switch severity {
+	case SeverityHigh:
+		return "error"
+	case SeverityLow:
+		return "note"
+	default:
+		return "warning"
+	}
+}
+
+// sarifURI returns filename as a URI reference: relative paths, e.g. with
+// -path-mode relative, stay relative and absolute ones become file URIs
+func sarifURI(filename string) string {
+	uri := filepath.ToSlash(filename)
+	if filepath.IsAbs(filename) {
+		if !strings.HasPrefix(uri, "/") {
+			uri = "/" + uri
+		}
+		return "file://" + uri
+	}
+	return uri
+}
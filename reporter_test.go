@@ -0,0 +1,247 @@
+package leakcheck_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"go/token"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/rleungx/leakcheck"
+)
+
+// reporterFindings are the findings written by the reporter tests
+var reporterFindings = []leakcheck.Finding{
+	{
+		TestFunc: "TestA",
+		Package:  "example.com/a",
+		Reason:   leakcheck.ReasonMissingDefer,
+		Severity: leakcheck.SeverityMedium,
+		Position: token.Position{Filename: "a/a_test.go", Line: 10, Column: 1},
+		Message:  "test function TestA is not covered by goleak (missing defer goleak.VerifyNone(t))",
+	},
+	{
+		TestFunc: "TestB",
+		Package:  "example.com/b",
+		Reason:   leakcheck.ReasonNoImport,
+		Severity: leakcheck.SeverityHigh,
+		Position: token.Position{Filename: "/src/b/b_test.go", Line: 3, Column: 1},
+		Message:  "test function TestB is not covered by goleak (goleak not imported)",
+	},
+}
+
+// report writes findings with the built-in reporter for format
+func report(t *testing.T, format string, findings []leakcheck.Finding) string {
+	t.Helper()
+	var buf bytes.Buffer
+	reporter, err := leakcheck.NewReporter(format, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, finding := range findings {
+		reporter.Report(finding)
+	}
+	if err := reporter.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestTextReporter(t *testing.T) {
+	got := report(t, leakcheck.FormatText, reporterFindings)
+	want := "a/a_test.go:10:1: test function TestA is not covered by goleak (missing defer goleak.VerifyNone(t))\n" +
+		"/src/b/b_test.go:3:1: test function TestB is not covered by goleak (goleak not imported)\n"
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestJSONReporter(t *testing.T) {
+	lines := strings.Split(strings.TrimSuffix(report(t, leakcheck.FormatJSON, reporterFindings), "\n"), "\n")
+	if len(lines) != len(reporterFindings) {
+		t.Fatalf("expected one line per finding, got %q", lines)
+	}
+	var finding map[string]any
+	if err := json.Unmarshal([]byte(lines[1]), &finding); err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]any{
+		"package":     "example.com/b",
+		"test":        "TestB",
+		"file":        "/src/b/b_test.go",
+		"line":        float64(3),
+		"column":      float64(1),
+		"reason":      "no-import",
+		"severity":    "high",
+		"fingerprint": reporterFindings[1].Fingerprint(),
+	} {
+		if finding[key] != want {
+			t.Errorf("%s: got %v, want %v", key, finding[key], want)
+		}
+	}
+}
+
+func TestSARIFReporter(t *testing.T) {
+	var log struct {
+		Version string `json:"version"`
+		Runs    []struct {
+			Tool struct {
+				Driver struct {
+					Rules []struct {
+						ID string `json:"id"`
+					} `json:"rules"`
+				} `json:"driver"`
+			} `json:"tool"`
+			Results []struct {
+				RuleID              string            `json:"ruleId"`
+				Level               string            `json:"level"`
+				PartialFingerprints map[string]string `json:"partialFingerprints"`
+				Locations           []struct {
+					PhysicalLocation struct {
+						ArtifactLocation struct {
+							URI string `json:"uri"`
+						} `json:"artifactLocation"`
+						Region struct {
+							StartLine int `json:"startLine"`
+						} `json:"region"`
+					} `json:"physicalLocation"`
+				} `json:"locations"`
+			} `json:"results"`
+		} `json:"runs"`
+	}
+	if err := json.Unmarshal([]byte(report(t, leakcheck.FormatSARIF, reporterFindings)), &log); err != nil {
+		t.Fatal(err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 {
+		t.Fatalf("unexpected log %+v", log)
+	}
+	run := log.Runs[0]
+	if len(run.Tool.Driver.Rules) != 2 || run.Tool.Driver.Rules[0].ID != "missing-defer" {
+		t.Errorf("unexpected rules %+v", run.Tool.Driver.Rules)
+	}
+	if len(run.Results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(run.Results))
+	}
+	// Relative paths stay relative, absolute ones become file URIs
+	for i, want := range []struct {
+		level, uri string
+		line       int
+	}{
+		{"warning", "a/a_test.go", 10},
+		{"error", "file:///src/b/b_test.go", 3},
+	} {
+		result := run.Results[i]
+		location := result.Locations[0].PhysicalLocation
+		if result.Level != want.level || location.ArtifactLocation.URI != want.uri || location.Region.StartLine != want.line {
+			t.Errorf("result %d: got %+v", i, result)
+		}
+		if len(result.PartialFingerprints) != 1 {
+			t.Errorf("result %d: expected one partial fingerprint, got %v", i, result.PartialFingerprints)
+		}
+		for _, fingerprint := range result.PartialFingerprints {
+			if fingerprint != reporterFindings[i].Fingerprint() {
+				t.Errorf("result %d: unexpected fingerprint %s", i, fingerprint)
+			}
+		}
+	}
+}
+
+func TestGitHubReporter(t *testing.T) {
+	got := report(t, leakcheck.FormatGitHub, reporterFindings)
+	want := "::warning file=a/a_test.go,line=10,col=1::test function TestA is not covered by goleak (missing defer goleak.VerifyNone(t))\n" +
+		"::error file=/src/b/b_test.go,line=3,col=1::test function TestB is not covered by goleak (goleak not imported)\n"
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Workflow commands end at the line break and delimit properties with , and :
+	got = report(t, leakcheck.FormatGitHub, []leakcheck.Finding{{
+		Severity: leakcheck.SeverityLow,
+		Position: token.Position{Filename: "C:/a,b/a_test.go", Line: 7, Column: 2},
+		Message:  "100% covered\r\nby: goleak",
+	}})
+	want = "::notice file=C%3A/a%2Cb/a_test.go,line=7,col=2::100%25 covered%0D%0Aby: goleak\n"
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestNewReporterUnknownFormat(t *testing.T) {
+	if _, err := leakcheck.NewReporter("yaml", &bytes.Buffer{}); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+// collectingReporter is a user-supplied reporter keeping findings in memory.
+// If cancel is set, it is called on the first finding.
+type collectingReporter struct {
+	findings []leakcheck.Finding
+	flushed  bool
+	cancel   context.CancelFunc
+}
+
+func (r *collectingReporter) Report(finding leakcheck.Finding) {
+	r.findings = append(r.findings, finding)
+	if r.cancel != nil {
+		r.cancel()
+	}
+}
+
+func (r *collectingReporter) Flush() error {
+	r.flushed = true
+	return nil
+}
+
+func TestAnalyzeReport(t *testing.T) {
+	chdir(t, "testdata/src")
+
+	reporter := &collectingReporter{}
+	results, err := leakcheck.AnalyzeReport(context.Background(), &leakcheck.Config{}, reporter, "./basic", "./no_import")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []leakcheck.Finding
+	for _, result := range results {
+		want = append(want, result.Findings...)
+	}
+	if !reporter.flushed {
+		t.Error("the reporter was not flushed")
+	}
+	if len(reporter.findings) != 3 || len(reporter.findings) != len(want) {
+		t.Fatalf("expected the 3 findings of the results, got %v", reporter.findings)
+	}
+	// Packages are reported as they complete, not in load order
+	byPosition := func(a, b leakcheck.Finding) int {
+		return strings.Compare(a.Position.String(), b.Position.String())
+	}
+	slices.SortFunc(want, byPosition)
+	slices.SortFunc(reporter.findings, byPosition)
+	for i := range want {
+		if reporter.findings[i].Position != want[i].Position {
+			t.Errorf("finding %d not reported: %v", i, want[i])
+		}
+	}
+}
+
+func TestAnalyzeReportStreams(t *testing.T) {
+	chdir(t, "testdata/src")
+
+	// The findings of the first package reach the reporter before the run
+	// ends, here by canceling it
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reporter := &collectingReporter{cancel: cancel}
+	_, err := leakcheck.AnalyzeReport(ctx, &leakcheck.Config{Concurrency: 1}, reporter, "./basic", "./no_import")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v, want the run canceled", err)
+	}
+	if len(reporter.findings) == 0 {
+		t.Error("no finding was reported before the run was canceled")
+	}
+	if !reporter.flushed {
+		t.Error("the reporter was not flushed")
+	}
+}
@@ -0,0 +1,146 @@
+package leakcheck
+
+import (
+	"go/ast"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// Names used by testify suites
+const (
+	testifySuitePath = "github.com/stretchr/testify/suite"
+	suiteTypeName    = "Suite"
+	suiteRunFunc     = "Run"
+	suiteTMethod     = "T"
+	tearDownTest     = "TearDownTest"
+	tearDownSuite    = "TearDownSuite"
+)
+
+// suiteReceiver returns the name of the suite type fd is a method of, or an
+// empty string if fd isn't a method or its receiver isn't a testify suite
+func suiteReceiver(info *types.Info, fd *ast.FuncDecl) string {
+	if fd.Recv == nil || info == nil {
+		return ""
+	}
+	fn, ok := info.Defs[fd.Name].(*types.Func)
+	if !ok {
+		return ""
+	}
+	recv := fn.Type().(*types.Signature).Recv()
+	if recv == nil {
+		return ""
+	}
+	named := namedType(recv.Type())
+	if named == nil || !isSuiteType(named) {
+		return ""
+	}
+	return named.Obj().Name()
+}
+
+// namedType returns the named type of typ, dereferencing a pointer
+func namedType(typ types.Type) *types.Named {
+	if ptr, ok := typ.(*types.Pointer); ok {
+		typ = ptr.Elem()
+	}
+	named, _ := typ.(*types.Named)
+	return named
+}
+
+// isSuiteType checks if named is a struct embedding testify's suite.Suite
+func isSuiteType(named *types.Named) bool {
+	st, ok := named.Underlying().(*types.Struct)
+	if !ok {
+		return false
+	}
+	for i := 0; i < st.NumFields(); i++ {
+		field := st.Field(i)
+		if !field.Embedded() {
+			continue
+		}
+		embedded := namedType(field.Type())
+		if embedded != nil && embedded.Obj().Name() == suiteTypeName && embedded.Obj().Pkg() != nil && unvendoredPath(embedded.Obj().Pkg().Path()) == testifySuitePath {
+			return true
+		}
+	}
+	return false
+}
+
+// collectCoveredSuites returns the names of the suite types whose TearDownTest
+// or TearDownSuite method calls goleak.VerifyNone(s.T()) with its receiver
+func collectCoveredSuites(pass *analysis.Pass, goleak goleakNames) map[string]bool {
+	covered := make(map[string]bool)
+	for _, file := range pass.Files {
+		for _, decl := range file.Decls {
+			fd, ok := decl.(*ast.FuncDecl)
+			if !ok || fd.Body == nil || fd.Name == nil || (fd.Name.Name != tearDownTest && fd.Name.Name != tearDownSuite) {
+				continue
+			}
+			suite := suiteReceiver(pass.TypesInfo, fd)
+			if suite == "" || len(fd.Recv.List) == 0 || len(fd.Recv.List[0].Names) == 0 {
+				continue
+			}
+			if callsVerifyNoneWithSuite(pass.TypesInfo, fd.Body, fd.Recv.List[0].Names[0], goleak) {
+				covered[suite] = true
+			}
+		}
+	}
+	return covered
+}
+
+// callsVerifyNoneWithSuite checks if body calls goleak.VerifyNone(recv.T())
+func callsVerifyNoneWithSuite(info *types.Info, body *ast.BlockStmt, recv *ast.Ident, goleak goleakNames) bool {
+	found := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return !found
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || !isGoleakCall(info, sel, goleak, goleak.verify...) || len(call.Args) == 0 {
+			return !found
+		}
+		// The argument must be recv.T()
+		arg, ok := call.Args[0].(*ast.CallExpr)
+		if !ok || len(arg.Args) != 0 {
+			return !found
+		}
+		argSel, ok := arg.Fun.(*ast.SelectorExpr)
+		if ok && argSel.Sel.Name == suiteTMethod && refersTo(info, argSel.X, recv) {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// runsCoveredSuite checks if body calls suite.Run with one of the covered suites
+func runsCoveredSuite(info *types.Info, body *ast.BlockStmt, covered map[string]bool) bool {
+	if body == nil || info == nil || len(covered) == 0 {
+		return false
+	}
+	found := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) != 2 {
+			return !found
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || sel.Sel.Name != suiteRunFunc {
+			return !found
+		}
+		ident, ok := sel.X.(*ast.Ident)
+		if !ok {
+			return !found
+		}
+		pkgName, ok := info.Uses[ident].(*types.PkgName)
+		if !ok || unvendoredPath(pkgName.Imported().Path()) != testifySuitePath {
+			return !found
+		}
+		if named := namedType(info.TypeOf(call.Args[1])); named != nil && covered[named.Obj().Name()] {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
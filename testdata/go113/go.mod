@@ -0,0 +1,7 @@
+module go113
+
+go 1.13
+
+require go.uber.org/goleak v1.3.0
+
+replace go.uber.org/goleak => ./goleak
@@ -0,0 +1 @@
+package go113
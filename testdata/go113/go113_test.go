@@ -0,0 +1,15 @@
+package go113
+
+import (
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+func TestWithCleanup(t *testing.T) {
+	t.Cleanup(func() { goleak.VerifyNone(t) })
+}
+
+func TestWithDefer(t *testing.T) {
+	defer goleak.VerifyNone(t)
+}
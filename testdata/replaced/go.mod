@@ -0,0 +1,7 @@
+module replaced
+
+go 1.23.0
+
+require go.uber.org/goleak v1.3.0
+
+replace go.uber.org/goleak => ./fork
@@ -0,0 +1,14 @@
+package replaced
+
+import (
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+func TestWithLeak(t *testing.T) {
+	defer leak.VerifyNone(t)
+}
+
+func TestWithoutLeak(t *testing.T) {
+}
@@ -0,0 +1,11 @@
+package blank_import
+
+import (
+	"testing"
+
+	_ "go.uber.org/goleak" // want "goleak is imported with a blank identifier in package blank_import, so goleak.VerifyNone and goleak.VerifyTestMain can't be called; import it by name or remove the import"
+)
+
+// Blank import can't cover anything - should trigger warning
+func TestWithBlankImport(t *testing.T) { // want "test function TestWithBlankImport is not covered by goleak \\(goleak not imported\\)"
+}
@@ -0,0 +1,9 @@
+//go:build slow && integration
+
+package build_tags
+
+import "testing"
+
+// Tagged with an excluded build tag - should not trigger warning
+func TestIntegration(t *testing.T) {
+}
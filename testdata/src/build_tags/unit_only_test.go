@@ -0,0 +1,9 @@
+//go:build !integration
+
+package build_tags
+
+import "testing"
+
+// Only built without the excluded tag, which it doesn't require - should trigger warning
+func TestUnitOnly(t *testing.T) { // want "test function TestUnitOnly is not covered by goleak \\(goleak not imported\\)"
+}
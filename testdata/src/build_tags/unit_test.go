@@ -0,0 +1,7 @@
+package build_tags
+
+import "testing"
+
+// Untagged - should trigger warning
+func TestUnit(t *testing.T) { // want "test function TestUnit is not covered by goleak \\(goleak not imported\\)"
+}
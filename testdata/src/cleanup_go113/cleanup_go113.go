@@ -0,0 +1 @@
+package cleanup_go113
@@ -0,0 +1,16 @@
+package cleanup_go113
+
+import (
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+// t.Cleanup doesn't exist before Go 1.14, so it doesn't cover the test
+func TestWithCleanup(t *testing.T) { // want "test function TestWithCleanup is not covered by goleak \\(missing defer goleak.VerifyNone\\(t\\)\\)"
+	t.Cleanup(func() { goleak.VerifyNone(t) })
+}
+
+func TestWithDefer(t *testing.T) {
+	defer goleak.VerifyNone(t)
+}
@@ -0,0 +1,14 @@
+package columns
+
+import "testing"
+
+// TestDocumented is reported at its func keyword, not at its doc comment
+func TestDocumented(t *testing.T) { // want "test function TestDocumented is not covered by goleak"
+}
+
+// TestLongDoc is reported at its func keyword too, past the whole comment
+//
+//	go test -run TestLongDoc
+func TestLongDoc(t *testing.T) { // want "test function TestLongDoc is not covered by goleak"
+	_ = t
+}
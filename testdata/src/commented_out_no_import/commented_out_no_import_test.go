@@ -0,0 +1,10 @@
+package commented_out_no_import
+
+import (
+	"testing"
+)
+
+// Verification and import removed by a refactor - should trigger warning and hint
+func TestCommentedOut(t *testing.T) { // want "test function TestCommentedOut is not covered by goleak \\(goleak not imported\\)"
+	/* defer goleak.VerifyNone(t) */ // want "found commented-out goleak coverage in test function TestCommentedOut \\(restore the commented-out goleak verification\\)"
+}
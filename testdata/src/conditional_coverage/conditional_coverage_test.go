@@ -0,0 +1,47 @@
+package conditional_coverage
+
+import (
+	"os"
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+// Unconditional defer - should not trigger warning
+func TestUnconditional(t *testing.T) {
+	defer goleak.VerifyNone(t)
+}
+
+// Skipped early, the defer still runs whenever the test does - should not trigger warning
+func TestSkippedEarly(t *testing.T) {
+	if testing.Short() {
+		t.Skip("slow")
+	}
+	defer goleak.VerifyNone(t)
+}
+
+// Not verified in short mode - should trigger warning
+func TestShortOnly(t *testing.T) {
+	if !testing.Short() {
+		defer goleak.VerifyNone(t) // want "goleak verification in test function TestShortOnly is conditional \\(it is nested in an if, loop or closure, so some runs of the test aren't verified\\)"
+	}
+}
+
+// Cleanup registered behind an environment guard - should trigger warning
+func TestEnvGuardedCleanup(t *testing.T) {
+	if os.Getenv("LEAKCHECK") != "" {
+		t.Cleanup(func() { goleak.VerifyNone(t) }) // want "goleak verification in test function TestEnvGuardedCleanup is conditional"
+	}
+}
+
+// Conditional verification backed by an unconditional one - should not trigger warning
+func TestAlsoUnconditional(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	if !testing.Short() {
+		defer goleak.VerifyNone(t)
+	}
+}
+
+// Uncovered tests are reported as usual - should trigger warning
+func TestUncovered(t *testing.T) { // want "test function TestUncovered is not covered by goleak \\(missing defer goleak.VerifyNone\\(t\\)\\)"
+}
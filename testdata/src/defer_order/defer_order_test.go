@@ -0,0 +1,41 @@
+package defer_order
+
+import (
+	"context"
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+func serve(ctx context.Context) {}
+
+// VerifyNone deferred first, runs last - should not trigger warning
+func TestVerifyFirst(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go serve(ctx)
+}
+
+// VerifyNone deferred after cancel, runs before it - should trigger warning
+func TestVerifyAfterCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer goleak.VerifyNone(t) // want "defer goleak.VerifyNone in test function TestVerifyAfterCancel is not the first defer \\(it runs before the cleanup deferred earlier; defer it first so it runs last\\)"
+	go serve(ctx)
+}
+
+// A defer inside a closure belongs to the closure - should not trigger warning
+func TestClosureDefer(t *testing.T) {
+	func() {
+		defer t.Log("done")
+	}()
+	defer goleak.VerifyNone(t)
+}
+
+// Only the first verification counts - should not trigger warning
+func TestSecondVerify(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	defer t.Log("done")
+	defer goleak.VerifyNone(t)
+}
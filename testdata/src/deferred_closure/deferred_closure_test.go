@@ -0,0 +1,53 @@
+package deferred_closure
+
+import (
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+// Deferred function literal - should not trigger warning
+func TestDeferredLiteral(t *testing.T) {
+	defer func() { goleak.VerifyNone(t) }()
+}
+
+// Deferred closure variable - should not trigger warning
+func TestClosureVariable(t *testing.T) {
+	cleanup := func() {
+		goleak.VerifyNone(t)
+	}
+	defer cleanup()
+}
+
+// Closure variable declared with var - should not trigger warning
+func TestDeclaredClosureVariable(t *testing.T) {
+	var cleanup = func() { goleak.VerifyNone(t) }
+	defer cleanup()
+}
+
+// Closure variable that isn't deferred - should trigger warning
+func TestClosureVariableNotDeferred(t *testing.T) { // want "test function TestClosureVariableNotDeferred is not covered by goleak \\(missing defer goleak.VerifyNone\\(t\\)\\)"
+	cleanup := func() { goleak.VerifyNone(t) }
+	_ = cleanup
+}
+
+// Closure variable reassigned before the defer - should trigger warning
+func TestReassignedClosureVariable(t *testing.T) { // want "test function TestReassignedClosureVariable is not covered by goleak \\(missing defer goleak.VerifyNone\\(t\\)\\)"
+	cleanup := func() { goleak.VerifyNone(t) }
+	cleanup = func() {}
+	defer cleanup()
+}
+
+// Closure variable verifying another test's t - should trigger warning
+func TestClosureVariableOtherT(t *testing.T) { // want "test function TestClosureVariableOtherT is not covered by goleak \\(missing defer goleak.VerifyNone\\(t\\)\\)"
+	other := &testing.T{}
+	cleanup := func() { goleak.VerifyNone(other) }
+	defer cleanup()
+}
+
+// Closure variable declared outside the test - should trigger warning
+var verifyLater = func(t *testing.T) { goleak.VerifyNone(t) }
+
+func TestPackageClosureVariable(t *testing.T) { // want "test function TestPackageClosureVariable is not covered by goleak \\(missing defer goleak.VerifyNone\\(t\\)\\)"
+	defer verifyLater(t)
+}
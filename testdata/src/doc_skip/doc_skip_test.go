@@ -0,0 +1,52 @@
+package doc_skip
+
+import (
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+func TestWithGoleak(t *testing.T) {
+	defer goleak.VerifyNone(t)
+}
+
+// TestDocSkipped starts a helper process that outlives the test.
+//
+// leakcheck:skip the helper is reaped by the integration harness
+func TestDocSkipped(t *testing.T) {
+}
+
+// TestDirectiveSkipped has the marker written as a directive.
+//
+//leakcheck:skip
+func TestDirectiveSkipped(t *testing.T) {
+}
+
+// TestDocSkippedVerify is skipped with everything in its body - should not trigger warning
+//
+// leakcheck:skip verifies a fork of the process
+func TestDocSkippedVerify(t *testing.T) {
+	goleak.VerifyTestMain(nil)
+}
+
+// leakcheck:skip in a regular comment, detached from the test - should trigger warning
+
+func TestDetachedComment(t *testing.T) { // want "test function TestDetachedComment is not covered by goleak \\(missing defer goleak.VerifyNone\\(t\\)\\)"
+}
+
+// In the body - should trigger warning
+func TestBodyComment(t *testing.T) { // want "test function TestBodyComment is not covered by goleak \\(missing defer goleak.VerifyNone\\(t\\)\\)"
+	// leakcheck:skip
+}
+
+// Trailing comment - should trigger warning
+func TestTrailingComment(t *testing.T) { // leakcheck:skip // want "test function TestTrailingComment is not covered by goleak \\(missing defer goleak.VerifyNone\\(t\\)\\)"
+}
+
+// The marker must start a line of the doc comment, as in leakcheck:skip - should trigger warning
+func TestMentioned(t *testing.T) { // want "test function TestMentioned is not covered by goleak \\(missing defer goleak.VerifyNone\\(t\\)\\)"
+}
+
+// leakcheck:skipped is another word - should trigger warning
+func TestOtherWord(t *testing.T) { // want "test function TestOtherWord is not covered by goleak \\(missing defer goleak.VerifyNone\\(t\\)\\)"
+}
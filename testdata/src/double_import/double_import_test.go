@@ -0,0 +1,32 @@
+package double_import
+
+import (
+	"testing"
+
+	"go.uber.org/goleak"
+	leak "go.uber.org/goleak"
+)
+
+// Covered through the plain import - should not trigger warning
+func TestPlain(t *testing.T) {
+	defer goleak.VerifyNone(t)
+}
+
+// Covered through the aliased import - should not trigger warning
+func TestAliased(t *testing.T) {
+	defer leak.VerifyNone(t)
+}
+
+// Registered through the aliased import - should not trigger warning
+func TestAliasedCleanup(t *testing.T) {
+	t.Cleanup(func() { leak.VerifyNone(t) })
+}
+
+// Not covered - should trigger warning
+func TestUncovered(t *testing.T) { // want "test function TestUncovered is not covered by goleak \\(missing defer goleak.VerifyNone\\(t\\)\\)"
+}
+
+// Misused option through the aliased import - should trigger warnings
+func TestAliasedOption(t *testing.T) { // want "test function TestAliasedOption is not covered by goleak"
+	leak.VerifyNone(t, leak.IgnoreCurrent()) // want "leak.IgnoreCurrent\\(\\) is evaluated when leak.VerifyNone runs and hides leaked goroutines"
+}
@@ -0,0 +1,32 @@
+package examples
+
+import (
+	"fmt"
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+func TestCovered(t *testing.T) {
+	defer goleak.VerifyNone(t)
+}
+
+// Runnable example without TestMain - should trigger warning
+func ExampleRunnable() { // want "example function ExampleRunnable is not covered by goleak \\(examples require TestMain with goleak.VerifyTestMain\\)"
+	fmt.Println("hello")
+	// Output: hello
+}
+
+// Runnable example with unordered output - should trigger warning
+func ExampleUnordered() { // want "example function ExampleUnordered is not covered by goleak \\(examples require TestMain with goleak.VerifyTestMain\\)"
+	fmt.Println("a")
+	fmt.Println("b")
+	// Unordered output:
+	// b
+	// a
+}
+
+// Example without output comment is only compiled, not run - should not trigger warning
+func ExampleCompiledOnly() {
+	fmt.Println("hello")
+}
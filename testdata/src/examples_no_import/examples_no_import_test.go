@@ -0,0 +1,9 @@
+package examples_no_import
+
+import "fmt"
+
+// Runnable example in a package without goleak - should trigger warning
+func ExampleNoImport() { // want "example function ExampleNoImport is not covered by goleak \\(examples require TestMain with goleak.VerifyTestMain\\)"
+	fmt.Println("hello")
+	// Output: hello
+}
@@ -0,0 +1,18 @@
+package examples_with_main
+
+import (
+	"fmt"
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+// Runnable example covered by TestMain - should not trigger warning
+func ExampleCovered() {
+	fmt.Println("hello")
+	// Output: hello
+}
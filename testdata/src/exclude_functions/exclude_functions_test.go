@@ -0,0 +1,19 @@
+package exclude_functions
+
+import (
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+// Test without goleak - should trigger warning
+func TestWithoutGoleak(t *testing.T) { // want "test function TestWithoutGoleak is not covered by goleak \\(missing defer goleak.VerifyNone\\(t\\)\\)"
+}
+
+// Excluded by name - should not trigger warning
+func TestLegacyWithoutGoleak(t *testing.T) {
+}
+
+func TestWithGoleak(t *testing.T) {
+	defer goleak.VerifyNone(t)
+}
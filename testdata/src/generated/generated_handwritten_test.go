@@ -0,0 +1,7 @@
+package generated
+
+import "testing"
+
+// Test without goleak - should trigger warning
+func TestWithoutGoleak(t *testing.T) { // want "test function TestWithoutGoleak is not covered by goleak \\(goleak not imported\\)"
+}
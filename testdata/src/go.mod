@@ -2,4 +2,9 @@ module src
 
 go 1.23.0
 
-require go.uber.org/goleak v1.3.0
+require (
+	github.com/stretchr/testify v1.10.0
+	go.uber.org/goleak v1.3.0
+)
+
+replace github.com/stretchr/testify => ./internal/testify
@@ -0,0 +1,16 @@
+package goleak_paths
+
+import (
+	"testing"
+
+	"third_party/goleak"
+)
+
+// Covered through the custom goleak import path - should not trigger warning
+func TestWithCustomGoleak(t *testing.T) {
+	defer goleak.VerifyNone(t)
+}
+
+// Test without goleak - should trigger warning
+func TestWithoutGoleak(t *testing.T) { // want "test function TestWithoutGoleak is not covered by goleak \\(missing defer goleak.VerifyNone\\(t\\)\\)"
+}
@@ -0,0 +1,16 @@
+package group_no_import // want "package group_no_import has 3 test\\(s\\) and does not import goleak"
+
+import (
+	"testing"
+)
+
+// Suppressed tests are left out of the count
+func TestSuppressed(t *testing.T) { //nolint:leakcheck
+}
+
+// Reported once for the whole package - should not trigger warning here
+func TestFirst(t *testing.T) {
+}
+
+func TestSecond(t *testing.T) {
+}
@@ -0,0 +1,9 @@
+package group_no_import
+
+import (
+	"testing"
+)
+
+// Counted at the package's first test file - should not trigger warning here
+func TestThird(t *testing.T) {
+}
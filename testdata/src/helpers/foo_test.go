@@ -0,0 +1,34 @@
+package helpers
+
+import "testing"
+
+// Covered by a deferred helper - should not trigger warning
+func TestWithHelper(t *testing.T) {
+	defer VerifyLeaks(t)
+}
+
+// Deferring an unrelated helper - should trigger warning
+func TestWithOtherHelper(t *testing.T) { // want "test function TestWithOtherHelper is not covered by goleak \\(missing defer goleak.VerifyNone\\(t\\)\\)"
+	defer Setup(t)
+}
+
+// Helper called with a variable other than the test's t - should trigger warning
+func TestWithHelperWrongArg(t *testing.T) { // want "test function TestWithHelperWrongArg is not covered by goleak \\(missing defer goleak.VerifyNone\\(t\\)\\)"
+	other := &testing.T{}
+	defer VerifyLeaks(other)
+}
+
+// Covered by a helper taking testing.TB - should not trigger warning
+func TestWithTBHelper(t *testing.T) {
+	defer VerifyLeaksTB(t)
+}
+
+// Covered by a helper registering the verification with t.Cleanup - should not trigger warning
+func TestWithCleanupHelper(t *testing.T) {
+	SetupLeakCheck(t)
+}
+
+// A helper verifying right away only checks the start of the test - should trigger warning
+func TestWithHelperNotDeferred(t *testing.T) { // want "test function TestWithHelperNotDeferred is not covered by goleak \\(missing defer goleak.VerifyNone\\(t\\)\\)"
+	VerifyLeaks(t)
+}
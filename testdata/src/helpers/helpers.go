@@ -0,0 +1,26 @@
+package helpers
+
+import (
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+// VerifyLeaks is a goleak helper declared in a regular, non-test file
+func VerifyLeaks(t *testing.T) {
+	goleak.VerifyNone(t)
+}
+
+// Unrelated helper that doesn't verify anything
+func Setup(t *testing.T) {}
+
+// VerifyLeaksTB works for tests and benchmarks alike
+func VerifyLeaksTB(tb testing.TB) {
+	tb.Helper()
+	goleak.VerifyNone(tb)
+}
+
+// SetupLeakCheck registers the verification to run once the calling test ends
+func SetupLeakCheck(t *testing.T) {
+	t.Cleanup(func() { goleak.VerifyNone(t) })
+}
@@ -0,0 +1,6 @@
+package ignored_top_functions
+
+// flusher runs in the background for the lifetime of the process
+type flusher struct{}
+
+func (f *flusher) run() {}
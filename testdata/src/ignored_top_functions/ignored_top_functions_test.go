@@ -0,0 +1,35 @@
+package ignored_top_functions
+
+import (
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+const flusherRun = "ignored_top_functions.(*flusher).run"
+
+// Ignores the expected function - should not trigger warning
+func TestIgnoresFlusher(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreTopFunction("ignored_top_functions.(*flusher).run"))
+}
+
+// IgnoreAnyFunction is broader and also accepted - should not trigger warning
+func TestIgnoresAnyFlusher(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent(), goleak.IgnoreAnyFunction("ignored_top_functions.(*flusher).run"))
+}
+
+// No options - should trigger warning
+func TestMissingIgnore(t *testing.T) {
+	defer goleak.VerifyNone(t) // want `goleak.VerifyNone does not ignore the expected goroutines of "ignored_top_functions.\(\*flusher\).run" \(missing goleak.IgnoreTopFunction\)`
+}
+
+// Ignores another function - should trigger warning
+func TestIgnoresOther(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreTopFunction("ignored_top_functions.other")) // want `goleak.VerifyNone does not ignore the expected goroutines of "ignored_top_functions.\(\*flusher\).run"`
+}
+
+// Options that can't be seen - should not trigger warning
+func TestOptionsVariable(t *testing.T) {
+	opts := []goleak.Option{goleak.IgnoreTopFunction(flusherRun)}
+	defer goleak.VerifyNone(t, opts...)
+}
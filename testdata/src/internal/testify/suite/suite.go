@@ -0,0 +1,23 @@
+// Package suite is a minimal stand-in for github.com/stretchr/testify/suite,
+// providing just enough API for the analyzer's suite fixtures to type-check.
+package suite
+
+import "testing"
+
+// Suite is embedded by test suites
+type Suite struct {
+	t *testing.T
+}
+
+// T returns the current testing context
+func (s *Suite) T() *testing.T {
+	return s.t
+}
+
+// TestingSuite is implemented by every suite
+type TestingSuite interface {
+	T() *testing.T
+}
+
+// Run runs the test methods of a suite
+func Run(t *testing.T, suite TestingSuite) {}
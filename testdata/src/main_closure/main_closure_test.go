@@ -0,0 +1,21 @@
+package main_closure
+
+import (
+	"os"
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+// TestMain calls VerifyTestMain from a closure declared in its body
+func TestMain(m *testing.M) {
+	run := func() int {
+		goleak.VerifyTestMain(m)
+		return 0
+	}
+	os.Exit(run())
+}
+
+// Covered through the closure in TestMain - should not trigger warning
+func TestCoveredByClosure(t *testing.T) {
+}
@@ -0,0 +1,21 @@
+package main_closure_outside
+
+import (
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+// TestMain doesn't verify anything itself
+func TestMain(m *testing.M) {
+	m.Run()
+}
+
+// A package-level closure declared after TestMain is not part of it
+var verifyMain = func(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+// TestMain doesn't call VerifyTestMain - should trigger warning
+func TestNotCovered(t *testing.T) { // want "test function TestNotCovered is not covered by goleak \\(TestMain exists but doesn't call goleak.VerifyTestMain\\)"
+}
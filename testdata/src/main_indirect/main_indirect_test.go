@@ -0,0 +1,20 @@
+package main_indirect
+
+import (
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+// TestMain delegates to a setup function that calls VerifyTestMain
+func TestMain(m *testing.M) {
+	setup(m)
+}
+
+func setup(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+// Covered through the setup function - should not trigger warning
+func TestCoveredBySetup(t *testing.T) {
+}
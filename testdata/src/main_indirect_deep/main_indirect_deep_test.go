@@ -0,0 +1,24 @@
+package main_indirect_deep
+
+import (
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+// TestMain reaches VerifyTestMain only through two levels of calls
+func TestMain(m *testing.M) {
+	setup(m)
+}
+
+func setup(m *testing.M) {
+	verify(m)
+}
+
+func verify(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+// Only one level of indirection is followed - should trigger warning
+func TestNotCovered(t *testing.T) { // want "test function TestNotCovered is not covered by goleak \\(TestMain exists but doesn't call goleak.VerifyTestMain\\)"
+}
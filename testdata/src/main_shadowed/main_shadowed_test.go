@@ -0,0 +1,29 @@
+package main_shadowed
+
+import (
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+// verifier has a VerifyTestMain method, but it is not goleak's
+type verifier struct{}
+
+func (verifier) VerifyTestMain(m *testing.M) {
+	m.Run()
+}
+
+// TestMain calls VerifyTestMain on a local variable shadowing the import
+func TestMain(m *testing.M) {
+	goleak := verifier{}
+	goleak.VerifyTestMain(m)
+}
+
+// Not covered, since TestMain doesn't verify - should trigger warning
+func TestShadowed(t *testing.T) { // want "test function TestShadowed is not covered by goleak \\(TestMain exists but doesn't call goleak.VerifyTestMain\\)"
+}
+
+// Covered by its own defer - should not trigger warning
+func TestWithGoleak(t *testing.T) {
+	defer goleak.VerifyNone(t)
+}
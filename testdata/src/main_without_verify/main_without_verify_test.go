@@ -3,7 +3,7 @@ package main_without_verify
 import (
 	"testing"
 
-	"go.uber.org/goleak"
+	"go.uber.org/goleak" // want "goleak is imported but never used for verification in package main_without_verify \\(no goleak.VerifyNone or goleak.VerifyTestMain calls\\)"
 )
 
 // Test with TestMain that doesn't call goleak.VerifyTestMain - should trigger warning
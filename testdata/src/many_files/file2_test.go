@@ -0,0 +1,19 @@
+package many_files
+
+import (
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+// Covered - should not trigger warning
+func TestCovered2(t *testing.T) {
+	defer goleak.VerifyNone(t)
+}
+
+// Uncovered - should trigger warning
+func TestUncovered2(t *testing.T) { // want "test function TestUncovered2 is not covered by goleak \\(missing defer goleak.VerifyNone\\(t\\)\\)"
+	done := make(chan struct{})
+	go close(done)
+	<-done
+}
@@ -0,0 +1,48 @@
+package nested_closures
+
+import (
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+// Closures in package-level variables belong to no test function
+var verifyLater = func(t *testing.T) {
+	defer goleak.VerifyNone(t)
+}
+
+// newCase returns a test-shaped closure; its defer covers no test function
+func newCase() func(t *testing.T) {
+	return func(t *testing.T) {
+		defer goleak.VerifyNone(t)
+	}
+}
+
+// Only the subtest is parallel, the per-test verification doesn't race
+func TestParallelSubtest(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	t.Run("sub", func(t *testing.T) {
+		t.Parallel()
+	})
+}
+
+// The closure verifies its own t, not the test's
+func TestClosureWithOwnT(t *testing.T) { // want "test function TestClosureWithOwnT is not covered by goleak \\(missing defer goleak.VerifyNone\\(t\\)\\)"
+	check := func(t *testing.T) {
+		defer goleak.VerifyNone(t)
+	}
+	_ = check
+}
+
+// A test declared after the helpers above is not covered by their defers
+func TestAfterHelpers(t *testing.T) { // want "test function TestAfterHelpers is not covered by goleak \\(missing defer goleak.VerifyNone\\(t\\)\\)"
+	verifyLater(t)
+	t.Run("case", newCase())
+}
+
+// A closure capturing the test's t still covers it
+func TestClosureCapturingT(t *testing.T) {
+	func() {
+		defer goleak.VerifyNone(t)
+	}()
+}
@@ -0,0 +1,57 @@
+package nested_defer
+
+import (
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+func work() {}
+
+// Defer inside an if block - should not trigger warning
+func TestDeferInIf(t *testing.T) {
+	if true {
+		defer goleak.VerifyNone(t)
+	}
+	go work()
+}
+
+// Defer inside a plain block - should not trigger warning
+func TestDeferInBlock(t *testing.T) {
+	{
+		defer goleak.VerifyNone(t)
+	}
+	go work()
+}
+
+// Defer inside a loop - should not trigger warning
+func TestDeferInFor(t *testing.T) {
+	for i := 0; i < 1; i++ {
+		defer goleak.VerifyNone(t)
+	}
+	go work()
+}
+
+// Defer inside a switch case - should not trigger warning
+func TestDeferInSwitch(t *testing.T) {
+	switch {
+	case !testing.Short():
+		defer goleak.VerifyNone(t)
+	}
+	go work()
+}
+
+// Defer after other statements - should not trigger warning
+func TestDeferNotFirst(t *testing.T) {
+	t.Log("setup")
+	go work()
+	defer goleak.VerifyNone(t)
+}
+
+// Nested defer with another test's T - should trigger warning
+func TestDeferOtherT(t *testing.T) { // want "test function TestDeferOtherT is not covered by goleak \\(missing defer goleak.VerifyNone\\(t\\)\\)"
+	other := &testing.T{}
+	if true {
+		defer goleak.VerifyNone(other)
+	}
+}
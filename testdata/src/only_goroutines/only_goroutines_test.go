@@ -0,0 +1,35 @@
+package only_goroutines
+
+import (
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+// Starts a goroutine without coverage - should trigger warning
+func TestSpawns(t *testing.T) { // want "test function TestSpawns is not covered by goleak \\(missing defer goleak.VerifyNone\\(t\\)\\)"
+	done := make(chan struct{})
+	go close(done)
+	<-done
+}
+
+// Starts a goroutine from a closure without coverage - should trigger warning
+func TestSpawnsInClosure(t *testing.T) { // want "test function TestSpawnsInClosure is not covered by goleak \\(missing defer goleak.VerifyNone\\(t\\)\\)"
+	start := func(f func()) { go f() }
+	start(func() {})
+}
+
+// Pure computation - should not trigger warning
+func TestPlain(t *testing.T) {
+	if 1+1 != 2 {
+		t.Fatal("math is broken")
+	}
+}
+
+// Covered and spawning - should not trigger warning
+func TestCovered(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	done := make(chan struct{})
+	go close(done)
+	<-done
+}
@@ -0,0 +1,17 @@
+package only_goroutines_no_import
+
+import "testing"
+
+// Starts a goroutine without goleak - should trigger warning
+func TestSpawns(t *testing.T) { // want "test function TestSpawns is not covered by goleak \\(goleak not imported\\)"
+	done := make(chan struct{})
+	go close(done)
+	<-done
+}
+
+// Pure computation - should not trigger warning
+func TestPlain(t *testing.T) {
+	if 1+1 != 2 {
+		t.Fatal("math is broken")
+	}
+}
@@ -0,0 +1,4 @@
+// Package package_ignore is checked for leaks by a separate soak harness.
+//
+//leakcheck:package-ignore leaks are checked by the soak harness
+package package_ignore
@@ -0,0 +1,7 @@
+package package_ignore
+
+import "testing"
+
+// Acknowledged with the rest of the package - should not trigger warning
+func TestAcknowledged(t *testing.T) {
+}
@@ -0,0 +1,7 @@
+package package_ignore_file_test
+
+import "testing"
+
+// The sentinel file also covers the external test package - should not trigger warning
+func TestExternal(t *testing.T) {
+}
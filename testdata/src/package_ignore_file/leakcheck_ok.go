@@ -0,0 +1,5 @@
+//go:build ignore
+
+// The tests of this package are checked for leaks by a separate soak
+// harness, so leakcheck skips the whole package.
+package package_ignore_file
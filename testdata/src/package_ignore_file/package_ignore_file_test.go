@@ -0,0 +1,7 @@
+package package_ignore_file
+
+import "testing"
+
+// Acknowledged by the sentinel file - should not trigger warning
+func TestAcknowledged(t *testing.T) {
+}
@@ -0,0 +1,11 @@
+package package_rules
+
+import "testing"
+
+// Excluded by the top-level exclude-functions, but the package rule replaces it - should trigger warning
+func TestOwned(t *testing.T) { // want "test function TestOwned is not covered by goleak \\(goleak not imported\\)"
+}
+
+// Excluded by the exclude-functions of the most specific package rule - should not trigger warning
+func TestLegacyBehavior(t *testing.T) {
+}
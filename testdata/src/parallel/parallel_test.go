@@ -0,0 +1,23 @@
+package parallel
+
+import (
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+// Parallel test relying on per-test verification - should trigger warning
+func TestParallelWithDefer(t *testing.T) { // want "parallel test function TestParallelWithDefer is not reliably covered by goleak \\(per-test goleak.VerifyNone\\(t\\) races with other parallel tests, use goleak.VerifyTestMain in TestMain\\)"
+	t.Parallel()
+	defer goleak.VerifyNone(t)
+}
+
+// Sequential test with per-test verification - should not trigger warning
+func TestSequentialWithDefer(t *testing.T) {
+	defer goleak.VerifyNone(t)
+}
+
+// Parallel test without any coverage - reported as missing defer
+func TestParallelWithoutDefer(t *testing.T) { // want "test function TestParallelWithoutDefer is not covered by goleak \\(missing defer goleak.VerifyNone\\(t\\)\\)"
+	t.Parallel()
+}
@@ -0,0 +1,17 @@
+package parallel_with_main
+
+import (
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+// Parallel test covered by TestMain - should not trigger warning
+func TestParallelCoveredByMain(t *testing.T) {
+	t.Parallel()
+	defer goleak.VerifyNone(t)
+}
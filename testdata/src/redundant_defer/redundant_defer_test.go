@@ -0,0 +1,20 @@
+package redundant_defer
+
+import (
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+// Already covered by TestMain - should trigger a note at the defer
+func TestWithDefer(t *testing.T) {
+	defer goleak.VerifyNone(t) // want "defer goleak.VerifyNone in test function TestWithDefer is redundant \\(TestMain already calls goleak.VerifyTestMain\\)"
+}
+
+// Covered by TestMain only - should not trigger warning
+func TestWithoutDefer(t *testing.T) {
+}
@@ -0,0 +1,33 @@
+package require_defer
+
+import (
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+// Marked but relying on TestMain - should trigger warning
+//
+//leakcheck:require-defer localizes leaks in the worker pool
+func TestMarkedWithoutDefer(t *testing.T) { // want "test function TestMarkedWithoutDefer is not covered by goleak \\(marked //leakcheck:require-defer, so goleak.VerifyTestMain doesn't count; missing defer goleak.VerifyNone\\(t\\)\\)"
+}
+
+// Marked and verifying itself - should not trigger a redundant note
+//
+//leakcheck:require-defer
+func TestMarkedWithDefer(t *testing.T) {
+	defer goleak.VerifyNone(t)
+}
+
+// Covered by TestMain only - should not trigger warning
+func TestUnmarked(t *testing.T) {
+}
+
+// Already covered by TestMain - should trigger a note at the defer
+func TestUnmarkedWithDefer(t *testing.T) {
+	defer goleak.VerifyNone(t) // want "defer goleak.VerifyNone in test function TestUnmarkedWithDefer is redundant \\(TestMain already calls goleak.VerifyTestMain\\)"
+}
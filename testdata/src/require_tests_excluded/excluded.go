@@ -0,0 +1,6 @@
+package require_tests_excluded
+
+// Start spawns a goroutine, but the package is excluded from the check
+func Start() {
+	go func() {}()
+}
@@ -0,0 +1,6 @@
+package require_tests_none // want "package require_tests_none has no test files \\(package has no tests, so nothing verifies it doesn't leak goroutines\\)"
+
+// Start spawns a goroutine that no test checks
+func Start() {
+	go func() {}()
+}
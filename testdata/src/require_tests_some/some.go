@@ -0,0 +1,6 @@
+package require_tests_some
+
+// Start spawns a goroutine checked by the package's tests
+func Start() {
+	go func() {}()
+}
@@ -0,0 +1,12 @@
+package require_tests_some
+
+import (
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+func TestStart(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	Start()
+}
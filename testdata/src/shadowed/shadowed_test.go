@@ -0,0 +1,27 @@
+package shadowed
+
+import (
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+// checker has a VerifyNone method, but it is not goleak's
+type checker struct{}
+
+func (checker) VerifyNone(t *testing.T) {}
+
+// A local variable shadows the import - should trigger warning
+func TestShadowed(t *testing.T) { // want "test function TestShadowed is not covered by goleak \\(missing defer goleak.VerifyNone\\(t\\)\\)"
+	goleak := checker{}
+	defer goleak.VerifyNone(t)
+}
+
+// The shadowing variable is scoped to a block - should not trigger warning
+func TestShadowedInBlock(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	{
+		goleak := checker{}
+		goleak.VerifyNone(t)
+	}
+}
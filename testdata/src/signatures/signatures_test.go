@@ -0,0 +1,29 @@
+package signatures
+
+import (
+	"testing"
+)
+
+// Real test - should trigger warning
+func TestRealTest(t *testing.T) { // want "test function TestRealTest is not covered by goleak \\(goleak not imported\\)"
+	Testhelper(t, "real")
+}
+
+// Test-prefixed helper with an extra parameter - go test doesn't run it
+func Testhelper(t *testing.T, name string) {
+}
+
+// Test-prefixed helper with a result - go test doesn't run it
+func Testfixture(t *testing.T) int {
+	return 0
+}
+
+// Test-prefixed helper taking a benchmark - go test doesn't run it
+func Testbench(b *testing.B) {
+}
+
+type runner struct{}
+
+// Methods are never tests
+func (runner) TestMethod(t *testing.T) {
+}
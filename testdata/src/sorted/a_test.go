@@ -0,0 +1,16 @@
+package sorted
+
+import (
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+// Uncovered - should trigger warning
+func TestFirst(t *testing.T) { // want "test function TestFirst is not covered by goleak \\(missing defer goleak.VerifyNone\\(t\\)\\)"
+}
+
+// Uncovered and misusing VerifyTestMain, which is recorded before the missing defers - should trigger warnings
+func TestSecond(t *testing.T) { // want "test function TestSecond is not covered by goleak \\(missing defer goleak.VerifyNone\\(t\\)\\)"
+	goleak.VerifyTestMain(nil) // want "goleak.VerifyTestMain in test function TestSecond doesn't cover the test"
+}
@@ -0,0 +1,7 @@
+package sorted
+
+import "testing"
+
+// Uncovered - should trigger warning
+func TestThird(t *testing.T) { // want "test function TestThird is not covered by goleak \\(missing defer goleak.VerifyNone\\(t\\)\\)"
+}
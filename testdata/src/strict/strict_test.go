@@ -0,0 +1,38 @@
+package strict
+
+import (
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+// Unconditional defer - should not trigger warning
+func TestTopLevelDefer(t *testing.T) {
+	defer goleak.VerifyNone(t)
+}
+
+// Verification registered with t.Cleanup - should not trigger warning
+func TestCleanup(t *testing.T) {
+	t.Cleanup(func() {
+		goleak.VerifyNone(t)
+	})
+}
+
+// Plain trailing call, skipped when the test fails early - should trigger warning in both modes
+func TestTrailingCall(t *testing.T) { // want "test function TestTrailingCall is not covered by goleak \\(missing defer goleak.VerifyNone\\(t\\)\\)"
+	goleak.VerifyNone(t)
+}
+
+// Conditional defer - should trigger warning in strict mode only
+func TestConditionalDefer(t *testing.T) { // want "test function TestConditionalDefer is not covered by goleak \\(missing defer goleak.VerifyNone\\(t\\)\\)"
+	if !testing.Short() {
+		defer goleak.VerifyNone(t)
+	}
+}
+
+// Conditional t.Cleanup - should trigger warning in strict mode only
+func TestConditionalCleanup(t *testing.T) { // want "test function TestConditionalCleanup is not covered by goleak \\(missing defer goleak.VerifyNone\\(t\\)\\)"
+	for i := 0; i < 1; i++ {
+		t.Cleanup(func() { goleak.VerifyNone(t) })
+	}
+}
@@ -0,0 +1,19 @@
+package strict_testmain
+
+import (
+	"os"
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+// VerifyTestMain only runs when the variable is unset - should trigger warnings in strict mode only
+func TestMain(m *testing.M) {
+	if os.Getenv("SKIP_LEAK_CHECK") == "" {
+		goleak.VerifyTestMain(m)
+	}
+	os.Exit(m.Run())
+}
+
+func TestCovered(t *testing.T) { // want "test function TestCovered is not covered by goleak \\(TestMain exists but doesn't call goleak.VerifyTestMain\\)"
+}
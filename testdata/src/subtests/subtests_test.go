@@ -0,0 +1,35 @@
+package subtests
+
+import (
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+func work() {}
+
+func TestSubtests(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	// Subtest with goroutines and its own coverage - should not trigger warning
+	t.Run("covered", func(t *testing.T) {
+		defer goleak.VerifyNone(t)
+		go work()
+	})
+
+	// Subtest with goroutines but no coverage - should trigger warning
+	t.Run("uncovered", func(t *testing.T) { // want "subtest in TestSubtests starts goroutines but is not covered by goleak \\(missing defer goleak.VerifyNone\\(t\\) in subtest\\)"
+		go work()
+	})
+
+	// Subtest verifying the parent's t instead of its own - should trigger warning
+	t.Run("parent t", func(st *testing.T) { // want "subtest in TestSubtests starts goroutines but is not covered by goleak \\(missing defer goleak.VerifyNone\\(t\\) in subtest\\)"
+		defer goleak.VerifyNone(t)
+		go work()
+	})
+
+	// Subtest without goroutines - should not trigger warning
+	t.Run("no goroutines", func(t *testing.T) {
+		work()
+	})
+}
@@ -0,0 +1,61 @@
+package subtests_covered
+
+import (
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+func work() {}
+
+// Every subtest verifies its own goroutines - should not trigger warning
+func TestDelegates(t *testing.T) {
+	for _, name := range []string{"a", "b"} {
+		t.Run(name, func(t *testing.T) {
+			defer goleak.VerifyNone(t)
+			go work()
+		})
+	}
+}
+
+// Nested subtests count through the subtest that runs them - should not trigger warning
+func TestNested(t *testing.T) {
+	t.Run("outer", func(t *testing.T) {
+		defer goleak.VerifyNone(t)
+		t.Run("inner", func(t *testing.T) {
+			go work()
+		})
+	})
+}
+
+// The parent starts a goroutine of its own - should trigger warning
+func TestParentGoroutine(t *testing.T) { // want "test function TestParentGoroutine is not covered by goleak"
+	go work()
+	t.Run("covered", func(t *testing.T) {
+		defer goleak.VerifyNone(t)
+	})
+}
+
+// One subtest does not verify - should trigger warning
+func TestUncoveredSubtest(t *testing.T) { // want "test function TestUncoveredSubtest is not covered by goleak"
+	t.Run("covered", func(t *testing.T) {
+		defer goleak.VerifyNone(t)
+	})
+	t.Run("uncovered", func(t *testing.T) {
+		work()
+	})
+}
+
+func runCase(t *testing.T) {
+	defer goleak.VerifyNone(t)
+}
+
+// A subtest run by a named function can't be checked - should trigger warning
+func TestNamedSubtest(t *testing.T) { // want "test function TestNamedSubtest is not covered by goleak"
+	t.Run("named", runCase)
+}
+
+// No subtests at all - should trigger warning
+func TestNoSubtests(t *testing.T) { // want "test function TestNoSubtests is not covered by goleak"
+	work()
+}
@@ -0,0 +1,31 @@
+package suggest_testmain
+
+import (
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+func work() {}
+
+// First test starting goroutines - the package-level suggestion is reported here
+func TestFirstWithGoroutine(t *testing.T) { // want "package suggest_testmain has 2 tests that start goroutines but no TestMain; consider adding TestMain with goleak.VerifyTestMain\\(m\\)"
+	defer goleak.VerifyNone(t)
+	go work()
+}
+
+func TestSecondWithGoroutine(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		work()
+	}()
+	<-done
+}
+
+// Test without goroutines - not counted
+func TestWithoutGoroutine(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	work()
+}
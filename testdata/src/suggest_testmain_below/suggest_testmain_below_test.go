@@ -0,0 +1,15 @@
+package suggest_testmain_below
+
+import (
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+func work() {}
+
+// Only one test starts goroutines - below the threshold, no suggestion
+func TestWithGoroutine(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	go work()
+}
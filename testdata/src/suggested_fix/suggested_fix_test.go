@@ -0,0 +1,25 @@
+package suggested_fix
+
+import (
+	"testing"
+
+	gl "go.uber.org/goleak"
+)
+
+func work() {}
+
+func TestCovered(t *testing.T) {
+	defer gl.VerifyNone(t)
+}
+
+func TestMultiLine(t *testing.T) { // want "test function TestMultiLine is not covered by goleak"
+	work()
+}
+
+func TestEmpty(t *testing.T) {} // want "test function TestEmpty is not covered by goleak"
+
+func TestSameLine(tt *testing.T) { work() } // want "test function TestSameLine is not covered by goleak"
+
+func TestUnnamed(*testing.T) { // want "test function TestUnnamed is not covered by goleak"
+	work()
+}
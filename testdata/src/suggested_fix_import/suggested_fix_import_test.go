@@ -0,0 +1,13 @@
+package suggested_fix_import
+
+import (
+	"testing"
+)
+
+func TestFirst(t *testing.T) { // want "test function TestFirst is not covered by goleak \\(goleak not imported\\)"
+	t.Log("first")
+}
+
+func TestSecond(t *testing.T) { // want "test function TestSecond is not covered by goleak \\(goleak not imported\\)"
+	t.Log("second")
+}
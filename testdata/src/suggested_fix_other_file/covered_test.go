@@ -0,0 +1,11 @@
+package suggested_fix_other_file
+
+import (
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+func TestCovered(t *testing.T) {
+	defer goleak.VerifyNone(t)
+}
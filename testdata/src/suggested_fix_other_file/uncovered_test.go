@@ -0,0 +1,7 @@
+package suggested_fix_other_file
+
+import "testing"
+
+func TestUncovered(t *testing.T) { // want "test function TestUncovered is not covered by goleak \\(missing defer goleak.VerifyNone\\(t\\)\\)"
+	t.Log("uncovered")
+}
@@ -0,0 +1,36 @@
+package suppress
+
+import (
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+func TestWithGoleak(t *testing.T) {
+	defer goleak.VerifyNone(t)
+}
+
+// Not suppressed - should trigger warning
+func TestReported(t *testing.T) { // want "test function TestReported is not covered by goleak \\(missing defer goleak.VerifyNone\\(t\\)\\)"
+}
+
+// Excluded by name - should not trigger warning
+func TestExcludedByName(t *testing.T) {
+}
+
+func TestNolint(t *testing.T) { //nolint
+}
+
+//nolint:all
+func TestNolintAll(t *testing.T) {
+}
+
+//leakcheck:ignore starts a helper process
+func TestIgnored(t *testing.T) {
+}
+
+// A trailing directive only suppresses its own line, not the test right below
+// it - should trigger warning
+var _ = goleak.VerifyNone //nolint
+func TestNotSuppressed(t *testing.T) { // want "test function TestNotSuppressed is not covered by goleak \\(missing defer goleak.VerifyNone\\(t\\)\\)"
+}
@@ -0,0 +1,23 @@
+package suppress_no_import
+
+import "testing"
+
+// Not suppressed - should trigger warning
+func TestReported(t *testing.T) { // want "test function TestReported is not covered by goleak \\(goleak not imported\\)"
+}
+
+// Excluded by name - should not trigger warning
+func TestExcludedByName(t *testing.T) {
+}
+
+func TestNolint(t *testing.T) { //nolint:leakcheck // exercised by the integration suite
+}
+
+// Suppressed by a directive in the doc comment - should not trigger warning
+//
+//leakcheck:ignore
+func TestIgnored(t *testing.T) {
+}
+
+func TestNolintOtherLinter(t *testing.T) { //nolint:errcheck // want "test function TestNolintOtherLinter is not covered by goleak \\(goleak not imported\\)"
+}
@@ -0,0 +1,29 @@
+package test_prefixes
+
+import (
+	"os"
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+// TestMain is still recognized with custom prefixes - should not be reported itself
+func TestMain(m *testing.M) {
+	os.Exit(m.Run())
+}
+
+// Standard test without goleak - should trigger warning
+func TestStandard(t *testing.T) { // want "test function TestStandard is not covered by goleak \\(TestMain exists but doesn't call goleak.VerifyTestMain\\)"
+}
+
+// Integration test with goleak - should not trigger warning
+func ITestWithGoleak(t *testing.T) {
+	defer goleak.VerifyNone(t)
+}
+
+// Integration test without goleak - should trigger warning
+func ITestWithoutGoleak(t *testing.T) { // want "test function ITestWithoutGoleak is not covered by goleak \\(TestMain exists but doesn't call goleak.VerifyTestMain\\)"
+}
+
+// Not matching any prefix - should not trigger warning
+func helperWithoutGoleak(t *testing.T) {}
@@ -0,0 +1,17 @@
+package testmain_exit
+
+import (
+	"os"
+	"testing"
+
+	"third_party/goleak"
+)
+
+// The exit code reaches os.Exit - should not trigger warning
+func TestMain(m *testing.M) {
+	code := goleak.VerifyTestMainCode(m)
+	os.Exit(code)
+}
+
+func TestCovered(t *testing.T) {
+}
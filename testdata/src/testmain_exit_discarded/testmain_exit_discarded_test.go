@@ -0,0 +1,16 @@
+package testmain_exit_discarded
+
+import (
+	"testing"
+
+	"third_party/goleak"
+)
+
+// The exit code is thrown away - should trigger warning
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMainCode(m)     // want "the exit code returned by goleak.VerifyTestMainCode in TestMain is discarded, so leaks don't fail the tests; pass it to os.Exit"
+	_ = goleak.VerifyTestMainCode(m) // want "the exit code returned by goleak.VerifyTestMainCode in TestMain is discarded, so leaks don't fail the tests; pass it to os.Exit"
+}
+
+func TestCovered(t *testing.T) {
+}
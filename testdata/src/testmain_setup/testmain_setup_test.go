@@ -0,0 +1,33 @@
+package testmain_setup
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+func serve() {
+	time.Sleep(time.Hour)
+}
+
+// Goroutines started before the tests run - should trigger warnings
+func TestMain(m *testing.M) {
+	go serve() // want "goroutine started in TestMain before the tests run is still running when goleak verifies them; stop it before, or ignore it with goleak.IgnoreCurrent\\(\\)"
+	done := make(chan struct{})
+	go func() { // want "goroutine started in TestMain before the tests run"
+		<-done
+	}()
+	// Only started when called, which may be after the tests - should not trigger warning
+	start := func() {
+		go serve()
+	}
+	_ = start
+	goleak.VerifyTestMain(m)
+	// After the tests - should not trigger warning
+	go serve()
+	close(done)
+}
+
+func TestCovered(t *testing.T) {
+}
@@ -0,0 +1,20 @@
+package testmain_setup_ignore
+
+import (
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+func worker(stop chan struct{}) {
+	<-stop
+}
+
+// The goroutines running before the tests are ignored - should not trigger warning
+func TestMain(m *testing.M) {
+	go worker(make(chan struct{}))
+	goleak.VerifyTestMain(m, goleak.IgnoreCurrent())
+}
+
+func TestCovered(t *testing.T) {
+}
@@ -0,0 +1,25 @@
+package testmain_setup_run
+
+import (
+	"os"
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+func worker(stop chan struct{}) {
+	<-stop
+}
+
+// A goroutine started before m.Run is still running in every test - should trigger warning
+func TestMain(m *testing.M) {
+	stop := make(chan struct{})
+	go worker(stop) // want "goroutine started in TestMain before the tests run"
+	code := m.Run()
+	close(stop)
+	os.Exit(code)
+}
+
+func TestCovered(t *testing.T) {
+	defer goleak.VerifyNone(t)
+}
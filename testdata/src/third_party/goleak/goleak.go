@@ -0,0 +1,36 @@
+// Package goleak stands in for a copy of goleak vendored under a custom path.
+package goleak
+
+import (
+	"context"
+	"testing"
+)
+
+// Option mirrors goleak.Option
+type Option interface{}
+
+// IgnoreCurrent mirrors goleak.IgnoreCurrent
+func IgnoreCurrent() Option { return nil }
+
+// IgnoreGoroutine stands in for an option of a fork that goleak doesn't have
+func IgnoreGoroutine(id int) Option { return nil }
+
+// Stacks returns no option and isn't one
+func Stacks() []string { return nil }
+
+// VerifyNone mirrors goleak.VerifyNone
+func VerifyNone(t testing.TB, options ...Option) {}
+
+// VerifyTestMain mirrors goleak.VerifyTestMain
+func VerifyTestMain(m *testing.M) {}
+
+// VerifyNoneWithContext stands in for a fork's verification that stops
+// waiting for goroutines to exit when ctx is done
+func VerifyNoneWithContext(t testing.TB, ctx context.Context) {}
+
+// VerifyTestMainWithContext is the TestMain counterpart of VerifyNoneWithContext
+func VerifyTestMainWithContext(m *testing.M, ctx context.Context) {}
+
+// VerifyTestMainCode stands in for a fork's TestMain verification that
+// returns the exit code instead of exiting
+func VerifyTestMainCode(m *testing.M) int { return 0 }
@@ -0,0 +1,46 @@
+package unreachable_defer
+
+import (
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+func work() {}
+
+// Defer after return - should trigger warning at the defer
+func TestDeferAfterReturn(t *testing.T) {
+	go work()
+	return
+	defer goleak.VerifyNone(t) // want "defer goleak.VerifyNone in test function TestDeferAfterReturn is unreachable \\(it follows an unconditional return, panic or t.Fatal, so the test is not covered\\)"
+}
+
+// Defer after t.Fatal - should trigger warning at the defer
+func TestDeferAfterFatal(t *testing.T) {
+	t.Fatal("not implemented")
+	defer goleak.VerifyNone(t) // want "defer goleak.VerifyNone in test function TestDeferAfterFatal is unreachable \\(it follows an unconditional return, panic or t.Fatal, so the test is not covered\\)"
+}
+
+// Conditional return - should not trigger warning
+func TestDeferAfterConditionalReturn(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+	defer goleak.VerifyNone(t)
+	go work()
+}
+
+// A label can be reached with goto - should not trigger warning
+func TestDeferAfterLabel(t *testing.T) {
+	goto verify
+	return
+verify:
+	defer goleak.VerifyNone(t)
+}
+
+// Defer before return - should not trigger warning
+func TestDeferBeforeReturn(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	go work()
+	return
+}
@@ -0,0 +1,26 @@
+package verify_argument
+
+import (
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+// Renamed testing parameter - should not trigger warning
+func TestRenamedParam(tt *testing.T) {
+	defer goleak.VerifyNone(tt)
+}
+
+// Verifying an unrelated variable - should trigger warning
+func TestWrongVariable(t *testing.T) { // want "test function TestWrongVariable is not covered by goleak \\(missing defer goleak.VerifyNone\\(t\\)\\)"
+	other := &testing.T{}
+	defer goleak.VerifyNone(other)
+}
+
+// Verifying a shadowing variable with the same name - should trigger warning
+func TestShadowedParam(t *testing.T) { // want "test function TestShadowedParam is not covered by goleak \\(missing defer goleak.VerifyNone\\(t\\)\\)"
+	{
+		t := &testing.T{}
+		defer goleak.VerifyNone(t)
+	}
+}
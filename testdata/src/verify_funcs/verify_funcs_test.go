@@ -0,0 +1,23 @@
+package verify_funcs
+
+import (
+	"context"
+	"testing"
+
+	"third_party/goleak"
+)
+
+// Covered by the fork's verification function - should not trigger warning
+func TestWithContextVerify(t *testing.T) {
+	defer goleak.VerifyNoneWithContext(t, context.Background())
+}
+
+// Covered through a t.Cleanup - should not trigger warning
+func TestWithContextCleanup(t *testing.T) {
+	t.Cleanup(func() { goleak.VerifyNoneWithContext(t, context.Background()) })
+}
+
+// VerifyNone is no longer configured - should trigger warning
+func TestWithVerifyNone(t *testing.T) { // want "test function TestWithVerifyNone is not covered by goleak \\(missing defer goleak.VerifyNone\\(t\\)\\)"
+	defer goleak.VerifyNone(t)
+}
@@ -0,0 +1,16 @@
+package verify_funcs_main
+
+import (
+	"context"
+	"testing"
+
+	"third_party/goleak"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMainWithContext(m, context.Background())
+}
+
+// Covered by the fork's TestMain verification - should not trigger warning
+func TestCoveredByMain(t *testing.T) {
+}
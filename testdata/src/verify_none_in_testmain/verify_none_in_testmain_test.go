@@ -0,0 +1,32 @@
+package verify_none_in_testmain
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+// stderrT reports leaks from TestMain, which has no *testing.T
+type stderrT struct{}
+
+func (stderrT) Error(args ...interface{}) {
+	fmt.Fprintln(os.Stderr, args...)
+}
+
+// VerifyNone instead of VerifyTestMain - should trigger warning
+func TestMain(m *testing.M) {
+	code := m.Run()
+	goleak.VerifyNone(stderrT{}) // want "goleak.VerifyNone in TestMain doesn't cover the package's tests; call goleak.VerifyTestMain\\(m\\) instead of m.Run, which runs the tests and then fails the binary on leaks"
+	os.Exit(code)
+}
+
+// Not covered by the VerifyNone in TestMain - should trigger warning
+func TestNotCovered(t *testing.T) { // want "test function TestNotCovered is not covered by goleak \\(TestMain exists but doesn't call goleak.VerifyTestMain\\)"
+}
+
+// Own verification - should not trigger warning
+func TestCovered(t *testing.T) {
+	defer goleak.VerifyNone(t)
+}
@@ -0,0 +1,26 @@
+package verify_none_with_testmain
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+// stderrT reports leaks from TestMain, which has no *testing.T
+type stderrT struct{}
+
+func (stderrT) Error(args ...interface{}) {
+	fmt.Fprintln(os.Stderr, args...)
+}
+
+// VerifyNone checks setup before VerifyTestMain runs the tests - should not trigger warning
+func TestMain(m *testing.M) {
+	goleak.VerifyNone(stderrT{})
+	goleak.VerifyTestMain(m)
+}
+
+// Covered by TestMain - should not trigger warning
+func TestCovered(t *testing.T) {
+}
@@ -0,0 +1,7 @@
+package verify_options
+
+type pool struct{}
+
+func (p *pool) run() {}
+
+func worker() {}
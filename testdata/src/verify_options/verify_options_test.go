@@ -0,0 +1,57 @@
+package verify_options
+
+import (
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+// Snapshot taken when the defer statement runs - should not trigger warning
+func TestIgnoreCurrentDeferred(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+}
+
+// Snapshot taken right before verification - should trigger warning
+func TestIgnoreCurrentInline(t *testing.T) { // want "test function TestIgnoreCurrentInline is not covered by goleak \\(missing defer goleak.VerifyNone\\(t\\)\\)"
+	goleak.VerifyNone(t, goleak.IgnoreCurrent()) // want "goleak.IgnoreCurrent\\(\\) is evaluated when goleak.VerifyNone runs and hides leaked goroutines; defer the verification call directly or take the snapshot at the start of the test"
+}
+
+// Snapshot taken inside a deferred closure - should trigger warning
+func TestIgnoreCurrentInClosure(t *testing.T) {
+	defer func() {
+		goleak.VerifyNone(t, goleak.IgnoreCurrent()) // want "goleak.IgnoreCurrent\\(\\) is evaluated when goleak.VerifyNone runs"
+	}()
+}
+
+// Existing functions and methods - should not trigger warning
+func TestIgnoreExisting(t *testing.T) {
+	defer goleak.VerifyNone(t,
+		goleak.IgnoreTopFunction("verify_options.worker"),
+		goleak.IgnoreAnyFunction("verify_options.(*pool).run"),
+		goleak.IgnoreTopFunction("verify_options.worker.func1"),
+		goleak.IgnoreTopFunction("example.com/unknown.Func"),
+	)
+}
+
+// Every known option in a single call - should not trigger warning
+func TestKnownOptions(t *testing.T) {
+	defer goleak.VerifyNone(t,
+		goleak.IgnoreCurrent(),
+		goleak.IgnoreTopFunction("verify_options.worker"),
+		goleak.IgnoreAnyFunction("verify_options.worker"),
+	)
+}
+
+// Cleanup is only accepted by VerifyTestMain - should trigger warning
+func TestCleanupOption(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.Cleanup(func(int) {})) // want "goleak.Cleanup is only accepted by goleak.VerifyTestMain, goleak.VerifyNone fails the test with it"
+}
+
+// Functions that don't exist - should trigger warning
+func TestIgnoreMissing(t *testing.T) {
+	defer goleak.VerifyNone(t,
+		goleak.IgnoreTopFunction("verify_options.missing"),      // want "goleak.IgnoreTopFunction ignores \"verify_options.missing\", which does not exist"
+		goleak.IgnoreAnyFunction("verify_options.(*pool).stop"), // want "goleak.IgnoreAnyFunction ignores \"verify_options.\\(\\*pool\\).stop\", which does not exist"
+		goleak.IgnoreTopFunction("worker"),                      // want "goleak.IgnoreTopFunction ignores \"worker\", which does not exist"
+	)
+}
@@ -0,0 +1,22 @@
+package verify_options_fork
+
+import (
+	"testing"
+
+	"third_party/goleak"
+)
+
+// Option goleak has - should not trigger warning
+func TestKnownOption(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+}
+
+// Option only the fork has - should trigger warning
+func TestUnknownOption(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreGoroutine(1)) // want "goleak.IgnoreGoroutine is not a known goleak option; check its name and the goleak version"
+}
+
+// Other values the fork's options accept aren't options - should not trigger warning
+func TestNotAnOption(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.Stacks())
+}
@@ -0,0 +1,37 @@
+package verify_testmain_in_test
+
+import (
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+var testingM *testing.M
+
+// Verifies every test from TestMain - should not trigger warning
+func TestMain(m *testing.M) {
+	testingM = m
+	goleak.VerifyTestMain(m)
+}
+
+// VerifyTestMain in a test - should trigger warning
+func TestVerifyTestMain(t *testing.T) {
+	goleak.VerifyTestMain(testingM) // want "goleak.VerifyTestMain in test function TestVerifyTestMain doesn't cover the test and exits the process mid-test; call it from TestMain, or defer goleak.VerifyNone\\(t\\) in the test"
+}
+
+// VerifyTestMain in a subtest - should trigger warning
+func TestVerifyTestMainInSubtest(t *testing.T) {
+	t.Run("sub", func(t *testing.T) {
+		goleak.VerifyTestMain(testingM) // want "goleak.VerifyTestMain in test function TestVerifyTestMainInSubtest doesn't cover the test"
+	})
+}
+
+// A helper delegating from TestMain is not a test - should not trigger warning
+func verifyAll(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+// Correct per-test verification - should not trigger warning
+func TestVerifyNone(t *testing.T) {
+	defer goleak.VerifyNone(t)
+}
@@ -0,0 +1,31 @@
+package verify_value
+
+import (
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+// Deferred call through a variable holding goleak.VerifyNone - should not trigger warning
+func TestDeferStoredFunc(t *testing.T) {
+	verify := goleak.VerifyNone
+	defer verify(t)
+}
+
+// Deferred call through a declared variable - should not trigger warning
+func TestDeferDeclaredFunc(t *testing.T) {
+	var verify func(goleak.TestingT, ...goleak.Option) = goleak.VerifyNone
+	defer verify(t)
+}
+
+// Plain call through the variable - should trigger warning
+func TestCallStoredFunc(t *testing.T) { // want "test function TestCallStoredFunc is not covered by goleak \\(missing defer goleak.VerifyNone\\(t\\)\\)"
+	verify := goleak.VerifyNone
+	verify(t)
+}
+
+// Deferred call through a variable holding another function - should trigger warning
+func TestDeferOtherFunc(t *testing.T) { // want "test function TestDeferOtherFunc is not covered by goleak \\(missing defer goleak.VerifyNone\\(t\\)\\)"
+	verify := func(goleak.TestingT, ...goleak.Option) {}
+	defer verify(t)
+}
@@ -0,0 +1,19 @@
+package xtest_main_external_test
+
+import (
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+// Covers the tests of this package only - should not trigger warning
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+// Covered by TestMain - should not trigger warning
+func TestExternal(t *testing.T) {
+	done := make(chan struct{})
+	go close(done)
+	<-done
+}
@@ -0,0 +1,22 @@
+package xtest_main_external
+
+import (
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+// The internal test package has no TestMain of its own - should trigger warning
+func TestInternal(t *testing.T) { // want "test function TestInternal is not covered by goleak \\(missing defer goleak.VerifyNone\\(t\\)\\)"
+	done := make(chan struct{})
+	go close(done)
+	<-done
+}
+
+// Covered by its own defer - should not trigger warning
+func TestInternalCovered(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	done := make(chan struct{})
+	go close(done)
+	<-done
+}
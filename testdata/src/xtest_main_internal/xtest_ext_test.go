@@ -0,0 +1,10 @@
+package xtest_main_internal_test
+
+import "testing"
+
+// The external test package has no TestMain of its own - should trigger warning
+func TestExternal(t *testing.T) { // want "test function TestExternal is not covered by goleak \\(goleak not imported\\)"
+	done := make(chan struct{})
+	go close(done)
+	<-done
+}
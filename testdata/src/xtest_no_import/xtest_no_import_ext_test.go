@@ -0,0 +1,7 @@
+package xtest_no_import_test
+
+import "testing"
+
+// Neither test package imports goleak - should trigger warning
+func TestExternal(t *testing.T) { // want "test function TestExternal is not covered by goleak \\(goleak not imported\\)"
+}
@@ -0,0 +1,7 @@
+package xtest_no_import
+
+import "testing"
+
+// Neither test package imports goleak - should trigger warning
+func TestInternal(t *testing.T) { // want "test function TestInternal is not covered by goleak \\(goleak not imported\\)"
+}
@@ -0,0 +1,125 @@
+package leakcheck
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// goleakReport starts the error goleak reports leaked goroutines with
+const goleakReport = "found unexpected goroutines"
+
+// LeakedTests records the tests that leaked goroutines at runtime, as seen
+// in the output of go test -json
+type LeakedTests struct {
+	tests map[testKey]bool
+}
+
+// testKey identifies a test function by its package import path and name
+type testKey struct {
+	pkg, test string
+}
+
+// testEvent is the part of a go test -json event LeakedTests needs
+type testEvent struct {
+	Action  string
+	Package string
+	Test    string
+	Output  string
+}
+
+// ParseTestJSON reads the event stream of go test -json and returns the tests
+// involved in a goleak report: the test whose verification failed, and every
+// function named on a "created by" line of the leaked goroutines' stacks.
+// The latter is what identifies a test without coverage, whose goroutines
+// are only caught by a later test or by goleak.VerifyTestMain. Lines that
+// aren't JSON, such as build output, are skipped.
+func ParseTestJSON(r io.Reader) (*LeakedTests, error) {
+	// Output is split into one event per line, so gather it per test first
+	var order []testKey
+	outputs := make(map[testKey]*strings.Builder)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 || line[0] != '{' {
+			continue
+		}
+		var event testEvent
+		if err := json.Unmarshal(line, &event); err != nil {
+			return nil, fmt.Errorf("test output line %d: %w", n, err)
+		}
+		if event.Action != "output" {
+			continue
+		}
+		key := testKey{event.Package, event.Test}
+		output := outputs[key]
+		if output == nil {
+			output = &strings.Builder{}
+			outputs[key] = output
+			order = append(order, key)
+		}
+		output.WriteString(event.Output)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	leaked := &LeakedTests{tests: make(map[testKey]bool)}
+	for _, key := range order {
+		_, report, found := strings.Cut(outputs[key].String(), goleakReport)
+		if !found {
+			continue
+		}
+		if key.test != "" {
+			// Subtests fail along with their test function
+			name, _, _ := strings.Cut(key.test, "/")
+			leaked.tests[testKey{key.pkg, name}] = true
+		}
+		for _, line := range strings.Split(report, "\n") {
+			if creator, ok := strings.CutPrefix(strings.TrimSpace(line), "created by "); ok {
+				if pkg, name, ok := splitFuncName(creator); ok {
+					leaked.tests[testKey{pkg, name}] = true
+				}
+			}
+		}
+	}
+	return leaked, nil
+}
+
+// splitFuncName splits the function of a "created by" stack line, such as
+// example.com/pkg.TestFoo.func1 in goroutine 7, into the import path of its
+// package and the name of the top-level function it belongs to
+func splitFuncName(creator string) (pkg, name string, ok bool) {
+	creator, _, _ = strings.Cut(creator, " ")
+	slash := strings.LastIndex(creator, "/")
+	dot := strings.Index(creator[slash+1:], ".")
+	if dot < 0 {
+		return "", "", false
+	}
+	pkg, rest := creator[:slash+1+dot], creator[slash+1+dot+1:]
+	name, _, _ = strings.Cut(rest, ".")
+	return pkg, name, name != ""
+}
+
+// Len returns the number of leaked tests
+func (l *LeakedTests) Len() int {
+	return len(l.tests)
+}
+
+// FilterLeaked returns the findings about a test function that leaked
+// goroutines at runtime, matched by package and name, so that the tests
+// known to leak are fixed first
+func FilterLeaked(findings []Finding, leaked *LeakedTests) []Finding {
+	var kept []Finding
+	for _, finding := range findings {
+		if finding.TestFunc != "" && leaked.tests[testKey{finding.Package, finding.TestFunc}] {
+			kept = append(kept, finding)
+		}
+	}
+	return kept
+}
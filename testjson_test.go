@@ -0,0 +1,57 @@
+package leakcheck_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rleungx/leakcheck"
+)
+
+// testJSON is go test -json output in which goleak reports leaks of a covered
+// test, of a subtest, and from TestMain of goroutines started by two uncovered
+// tests. A panic trace also names a test, but isn't a leak report.
+const testJSON = `# example.com/pkg
+{"Action":"run","Package":"example.com/pkg","Test":"TestCovered"}
+{"Action":"output","Package":"example.com/pkg","Test":"TestCovered","Output":"    pkg_test.go:12: found unexpected goroutines:\n"}
+{"Action":"output","Package":"example.com/pkg","Test":"TestCovered","Output":"        [Goroutine 7 in state chan receive, with example.com/pkg.TestCovered.func1 on top of the stack:\n"}
+{"Action":"output","Package":"example.com/pkg","Test":"TestCovered","Output":"        created by example.com/pkg.TestCovered in goroutine 6\n"}
+{"Action":"fail","Package":"example.com/pkg","Test":"TestCovered"}
+{"Action":"output","Package":"example.com/pkg","Test":"TestSub/case","Output":"    pkg_test.go:30: found unexpected goroutines:\n"}
+{"Action":"output","Package":"example.com/pkg","Test":"TestPanics","Output":"panic: boom\n"}
+{"Action":"output","Package":"example.com/pkg","Test":"TestPanics","Output":"created by example.com/pkg.TestPanics in goroutine 9\n"}
+{"Action":"output","Package":"example.com/pkg","Output":"goleak: Errors on successful test run: found unexpected goroutines:\n"}
+{"Action":"output","Package":"example.com/pkg","Output":"[Goroutine 8 in state select, with example.com/pkg.worker on top of the stack:\n"}
+{"Action":"output","Package":"example.com/pkg","Output":"created by example.com/pkg.TestUncovered.func1 in goroutine 7\n"}
+{"Action":"output","Package":"example.com/pkg","Output":"\tcreated by example.com/pkg_test.TestExternal\n"}
+{"Action":"fail","Package":"example.com/pkg"}
+`
+
+func TestFilterLeaked(t *testing.T) {
+	leaked, err := leakcheck.ParseTestJSON(strings.NewReader(testJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	finding := func(pkg, testFunc string) leakcheck.Finding {
+		return leakcheck.Finding{Package: pkg, TestFunc: testFunc}
+	}
+	findings := []leakcheck.Finding{
+		finding("example.com/pkg", "TestUncovered"),
+		finding("example.com/pkg_test", "TestExternal"),
+		finding("example.com/pkg", "TestSub"),
+		finding("example.com/pkg", "TestPanics"),
+		finding("example.com/pkg", "TestClean"),
+		finding("example.com/pkg", ""),
+		finding("example.com/other", "TestUncovered"),
+	}
+	want := findings[:3]
+	if got := leakcheck.FilterLeaked(findings, leaked); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestParseTestJSONMalformed(t *testing.T) {
+	if _, err := leakcheck.ParseTestJSON(strings.NewReader(`{"Action":`)); err == nil {
+		t.Error("expected an error for a truncated event")
+	}
+}